@@ -13,6 +13,7 @@ import (
 	"energy-prediction/internal/blockchain"
 	"energy-prediction/internal/database"
 	"energy-prediction/internal/handlers"
+	"energy-prediction/internal/ml"
 	"energy-prediction/internal/mqtt"
 
 	"github.com/gin-contrib/cors"
@@ -49,11 +50,37 @@ func main() {
 		log.Printf("Warning: Failed to seed data: %v", err)
 	}
 
-	// Initialize blockchain simulation
-	blockchain.Init()
+	// Give seeded meters a secret so they can sign HTTP submissions
+	if n, err := auth.ProvisionMissingMeters(database.DB); err != nil {
+		log.Printf("Warning: Failed to provision meter secrets: %v", err)
+	} else if n > 0 {
+		log.Printf("✓ Provisioned secrets for %d meters", n)
+	}
+
+	// Forget expired nonces of signed meter requests
+	nonceSweeper := auth.StartNonceSweeper()
+	defer nonceSweeper.Stop()
+
+	// Initialize blockchain simulation (restores persisted blocks)
+	if err := blockchain.Init(); err != nil {
+		log.Fatalf("Failed to initialize blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	// Select the price model used for new predictions
+	ml.Configure()
+
+	// Start the ingestion pipeline fed by MQTT and the HTTP fallback
+	pipeline := mqtt.StartPipeline()
+	defer pipeline.Stop()
+
+	// Track which meters are still reporting
+	liveness := mqtt.StartLivenessMonitor()
+	defer liveness.Stop()
 
 	// Start MQTT subscriber (optional - may fail if broker not running)
-	mqttClient, err := mqtt.NewSubscriber()
+	mqttConfig := mqtt.LoadConnectionConfig("energy-prediction-subscriber")
+	mqttClient, err := mqtt.NewSubscriber(mqttConfig)
 	if err != nil {
 		log.Printf("Warning: MQTT not available: %v", err)
 		log.Println("The system will work without real-time meter data.")
@@ -105,7 +132,10 @@ func main() {
 			"status":     "running",
 			"database":   dbStatus,
 			"mqtt":       mqttStatus,
+			"mqttConfig": mqttConfig.Info(),
 			"blockchain": blockchain.GetStats(),
+			"ingestion":  pipeline.Stats(),
+			"models":     ml.Models(),
 			"timestamp":  time.Now().Format(time.RFC3339),
 		})
 	})
@@ -138,6 +168,8 @@ func main() {
 		houseGroup.PUT("/:house_id", handlers.UpdateHouse)
 		houseGroup.DELETE("/:house_id", handlers.DeleteHouse)
 		houseGroup.GET("/:house_id/forecast", handlers.GetForecast)
+		houseGroup.GET("/:house_id/readings", handlers.GetHouseReadings)
+		houseGroup.GET("/:house_id/data-quality", handlers.GetHouseDataQuality)
 	}
 
 	// ========== Prediction Endpoints (Protected) ==========
@@ -146,22 +178,16 @@ func main() {
 	{
 		predGroup.GET("", handlers.GetPredictions)
 		predGroup.GET("/:prediction_id", handlers.GetPrediction)
+		predGroup.GET("/:prediction_id/explain", handlers.ExplainPrediction)
 	}
 
-	// ========== Simulation Endpoint (Public - for Simulator) ==========
+	// ========== Simulation Endpoint (Meter-signed - for Simulator) ==========
 	// This allows the simulator to send data via HTTP if MQTT is not available
-	router.POST("/api/simulate", func(c *gin.Context) {
-		var data mqtt.MeterData
-		if err := c.ShouldBindJSON(&data); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		// Process the data as if it came from MQTT
-		mqtt.ProcessMeterData(data)
-
-		c.JSON(http.StatusOK, gin.H{"status": "received", "meterId": data.MeterID})
-	})
+	router.POST("/api/simulate", auth.MeterAuthMiddleware(), handlers.SubmitMeterData)
+	// SenML packs (RFC 8428) from off-the-shelf meters
+	router.POST("/api/ingest/senml", auth.MeterAuthMiddleware(), handlers.SubmitSenML)
+	// DSMR P1 telegrams from Dutch and Belgian meters
+	router.POST("/api/ingest/dsmr", auth.MeterAuthMiddleware(), handlers.SubmitDSMR)
 
 	// Statistics endpoint
 	router.GET("/api/statistics", auth.JWTMiddleware(), handlers.GetStatistics)
@@ -169,6 +195,9 @@ func main() {
 	// Weather endpoint (Public)
 	router.GET("/api/weather/:city", handlers.GetWeather)
 
+	// Prediction signing keys (Public - lets third parties verify attestations)
+	router.GET("/api/blockchain/pubkey", handlers.GetSigningKeys)
+
 	// ========== Blockchain Endpoints (Protected) ==========
 	blockchainGroup := router.Group("/api/blockchain")
 	blockchainGroup.Use(auth.JWTMiddleware())
@@ -177,6 +206,8 @@ func main() {
 		blockchainGroup.GET("/stats", handlers.GetBlockchainStats)
 		blockchainGroup.GET("/verify/:tx_hash", handlers.VerifyTransaction)
 		blockchainGroup.GET("/block/:number", handlers.GetBlockByNumber)
+		blockchainGroup.GET("/integrity", handlers.GetChainIntegrity)
+		blockchainGroup.GET("/proof/:tx_hash", handlers.GetInclusionProof)
 	}
 
 	// ========== Admin Endpoints (Protected + Admin) ==========
@@ -186,6 +217,15 @@ func main() {
 		adminGroup.GET("/users", handlers.AdminGetUsers)
 		adminGroup.PUT("/users/:user_id/role", handlers.AdminChangeRole)
 		adminGroup.GET("/dashboard", handlers.AdminDashboard)
+		adminGroup.POST("/backtests", handlers.AdminRunBacktest)
+		adminGroup.GET("/backtests", handlers.AdminGetBacktests)
+		adminGroup.GET("/blockchain/outbox", handlers.AdminGetBlockchainOutbox)
+		adminGroup.POST("/blockchain/outbox/redrive", handlers.AdminRedriveBlockchainOutbox)
+		adminGroup.GET("/dead-letters", handlers.AdminGetDeadLetters)
+		adminGroup.POST("/dead-letters/reprocess", handlers.AdminReprocessDeadLetters)
+		adminGroup.DELETE("/dead-letters", handlers.AdminPurgeDeadLetters)
+		adminGroup.POST("/meters/:meter_id/rotate", handlers.AdminRotateMeterSecret)
+		adminGroup.POST("/meters/:meter_id/revoke", handlers.AdminRevokeMeterSecret)
 	}
 
 	// SPA Routing: Serve index.html for any unknown route (except /api and /auth)
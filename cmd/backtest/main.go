@@ -0,0 +1,96 @@
+// Backtest - Offline comparison of price models.
+// It replays a historical window of predictions through one or more models,
+// compares their prices with the recorded actual prices and stores the
+// errors, so model versions can be compared over time.
+//
+// Configuration:
+//   - DB_PATH: SQLite database to replay (default data/energy.db)
+//   - ML_MODEL_FILE: trained model artifacts to include, comma separated
+//   - BACKTEST_MODELS: model IDs to compare, comma separated (default all)
+//   - BACKTEST_FROM / BACKTEST_TO: window as RFC 3339 timestamps or dates;
+//     a date for BACKTEST_TO includes the whole day (default all history)
+//   - BACKTEST_CUTOFF: only replay predictions from this time on; trained
+//     models raise it to their own training cutoff (default none)
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/ml"
+
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	log.Println("========================================")
+	log.Println("  EnergyPulse - Price Model Backtest")
+	log.Println("========================================")
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "data/energy.db"
+	}
+	from := parseWindow("BACKTEST_FROM", false)
+	to := parseWindow("BACKTEST_TO", true)
+	cutoff := parseWindow("BACKTEST_CUTOFF", false)
+
+	var modelIDs []string
+	for _, id := range strings.Split(os.Getenv("BACKTEST_MODELS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			modelIDs = append(modelIDs, id)
+		}
+	}
+
+	if err := database.Connect(dbPath); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+
+	// Results are stored next to the gateway's tables
+	if err := database.AutoMigrate(); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	// Register trained artifacts
+	ml.Configure()
+
+	runs, err := ml.RunBacktest(modelIDs, from, to, cutoff)
+	if err != nil {
+		log.Fatalf("Backtest failed: %v", err)
+	}
+
+	log.Printf("Run %s over %d samples", runs[0].RunID, runs[0].Samples)
+	if cutoff := runs[0].Cutoff; cutoff != nil {
+		log.Printf("Predictions before the cutoff %s were left out", cutoff.Format(time.RFC3339))
+	}
+	log.Printf("%-24s %8s %8s %8s %9s", "Model", "MAE", "MAPE", "RMSE", "Bias")
+	for _, run := range runs {
+		log.Printf("%-24s %8.4f %7.2f%% %8.4f %+9.4f",
+			run.ModelName+"-"+run.ModelVersion, run.MAE, run.MAPE, run.RMSE, run.Bias)
+	}
+	log.Println("✓ Results saved, see GET /admin/backtests?runId=" + runs[0].RunID)
+}
+
+// parseWindow reads a window bound from the environment, zero if unset
+func parseWindow(key string, endOfDay bool) time.Time {
+	value := os.Getenv(key)
+	if value == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if endOfDay {
+			t = t.Add(24 * time.Hour)
+		}
+		return t
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: expected RFC 3339 timestamp or YYYY-MM-DD", key, value)
+	}
+	return t
+}
@@ -4,15 +4,20 @@ package main
 
 import (
 	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"energy-prediction/internal/auth"
 	"energy-prediction/internal/database"
 	"energy-prediction/internal/models"
+	meters "energy-prediction/internal/mqtt"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -38,16 +43,16 @@ func main() {
 	log.Println("  Simulating 20 IoT Smart Meters")
 	log.Println("========================================")
 
-	// Get broker URL from environment
-	brokerURL := os.Getenv("MQTT_BROKER")
-	if brokerURL == "" {
-		brokerURL = "tcp://localhost:1883"
-	}
+	// Broker URL, TLS and credentials come from the same MQTT_* variables as
+	// the API gateway
+	cfg := meters.LoadConnectionConfig("energy-meter-simulator")
+	brokerURL := cfg.Info().BrokerURL
 
 	// Configure MQTT client
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(brokerURL)
-	opts.SetClientID("energy-meter-simulator")
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		log.Fatalf("Invalid MQTT configuration: %v", err)
+	}
 	opts.SetCleanSession(true)
 	opts.SetAutoReconnect(true)
 	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
@@ -119,6 +124,7 @@ func publishAllMeters(client mqtt.Client) {
 	hour := now.Hour()
 
 	var meterIDs []string
+	secrets := make(map[string]string) // meter secrets for signing HTTP submissions
 
 	// Try to get meter IDs from database
 	if database.DB != nil {
@@ -131,6 +137,12 @@ func publishAllMeters(client mqtt.Client) {
 				}
 			}
 		}
+		var credentials []models.MeterCredential
+		if err := database.DB.Where("status = ?", models.CredentialActive).Find(&credentials).Error; err == nil {
+			for _, cred := range credentials {
+				secrets[cred.MeterID] = cred.Secret
+			}
+		}
 	}
 
 	// Fallback if DB empty or unavailable
@@ -165,20 +177,48 @@ func publishAllMeters(client mqtt.Client) {
 				log.Printf("MQTT Published: %s -> %.2f kWh, %.1f°C", meterID, data.ConsumptionKwh, data.Temperature)
 			}
 		} else {
-			// Fallback: Send via HTTP
+			// Fallback: Send via HTTP, signed with the meter's secret
 			// Note: In production we'd put the URL in env var
-			resp, err := http.Post("http://localhost:8080/api/simulate", "application/json", bytes.NewBuffer(payload))
+			secret, ok := secrets[meterID]
+			if !ok {
+				log.Printf("HTTP Skipped %s: meter has no active secret", meterID)
+				continue
+			}
+			resp, err := postSigned("http://localhost:8080/api/simulate", meterID, secret, payload)
 			if err != nil {
 				log.Printf("HTTP Failed to send data for %s: %v", meterID, err)
 			} else {
 				resp.Body.Close()
-				log.Printf("HTTP Sent: %s -> %.2f kWh, %.1f°C", meterID, data.ConsumptionKwh, data.Temperature)
+				log.Printf("HTTP Sent: %s -> %.2f kWh, %.1f°C (%s)", meterID, data.ConsumptionKwh, data.Temperature, resp.Status)
 			}
 		}
 	}
 	log.Println("---")
 }
 
+// postSigned sends a reading signed with the meter's secret (HMAC-SHA256
+// over timestamp, nonce and body)
+func postSigned(url, meterID, secret string, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := cryptorand.Read(nonce); err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderMeterID, meterID)
+	req.Header.Set(auth.HeaderMeterTimestamp, timestamp)
+	req.Header.Set(auth.HeaderMeterNonce, nonceHex)
+	req.Header.Set(auth.HeaderMeterSignature, auth.SignMeterRequest(secret, timestamp, nonceHex, payload))
+	return http.DefaultClient.Do(req)
+}
+
 // generateMeterData creates realistic meter data
 func generateMeterData(meterID string, timestamp time.Time, hour int) MeterData {
 	// Base consumption by hour (Italian household patterns)
@@ -0,0 +1,132 @@
+// Model Trainer - Offline training of the ridge regression price model.
+// It learns from the stored predictions with their readings, household
+// attributes and actual prices, and writes a model artifact the API gateway
+// loads at startup through ML_MODEL_FILE.
+//
+// Configuration:
+//   - DB_PATH: SQLite database to train from (default data/energy.db)
+//   - ML_MODEL_FILE: where the artifact is written (default data/models/ridge.json)
+//   - TRAIN_LAMBDA: L2 penalty on the standardized weights (default 1)
+//   - TRAIN_WINDOW: only train on the most recent history, e.g. 2160h (default all)
+//   - TRAIN_CUTOFF: train on samples before this RFC 3339 timestamp or date,
+//     validate on the rest (default set by TRAIN_HOLDOUT)
+//   - TRAIN_HOLDOUT: share of the newest samples held out for validation when
+//     TRAIN_CUTOFF is unset (default 0.2)
+//
+// The artifact records its cutoff, and backtests only replay the predictions
+// from it on. With TRAIN_HOLDOUT=0 it is fitted to all history.
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/ml"
+
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	log.Println("========================================")
+	log.Println("  EnergyPulse - Price Model Training")
+	log.Println("========================================")
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "data/energy.db"
+	}
+	outPath := os.Getenv("ML_MODEL_FILE")
+	if outPath == "" {
+		outPath = "data/models/ridge.json"
+	}
+
+	lambda := 1.0
+	if value := os.Getenv("TRAIN_LAMBDA"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid TRAIN_LAMBDA %q", value)
+		}
+		lambda = parsed
+	}
+	holdout := 0.2
+	if value := os.Getenv("TRAIN_HOLDOUT"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed >= 1 {
+			log.Fatalf("Invalid TRAIN_HOLDOUT %q, expected a share in [0, 1)", value)
+		}
+		holdout = parsed
+	}
+	var from time.Time
+	if value := os.Getenv("TRAIN_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			log.Fatalf("Invalid TRAIN_WINDOW %q", value)
+		}
+		from = time.Now().Add(-window)
+	}
+	var cutoff time.Time
+	if value := os.Getenv("TRAIN_CUTOFF"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			if parsed, err = time.Parse(time.RFC3339, value); err != nil {
+				log.Fatalf("Invalid TRAIN_CUTOFF %q: expected RFC 3339 timestamp or YYYY-MM-DD", value)
+			}
+		}
+		cutoff = parsed
+	}
+
+	if err := database.Connect(dbPath); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+
+	samples, err := ml.LoadSamples(from, time.Time{})
+	if err != nil {
+		log.Fatalf("Failed to load training data: %v", err)
+	}
+	log.Printf("Samples loaded:       %d", len(samples))
+
+	// Train before the cutoff and validate after it, so the model never sees
+	// the future
+	if split := len(samples) - int(float64(len(samples))*holdout); cutoff.IsZero() && split < len(samples) {
+		cutoff = samples[split].Time
+	}
+	training := samples
+	var validation []ml.Sample
+	if !cutoff.IsZero() {
+		split := sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(cutoff) })
+		training, validation = samples[:split], samples[split:]
+		log.Printf("Training cutoff:      %s (%d samples before, %d after)", cutoff.Format(time.RFC3339), len(training), len(validation))
+	}
+
+	model, err := ml.TrainRidge(training, lambda)
+	if err != nil {
+		log.Fatalf("Training failed: %v", err)
+	}
+	if !cutoff.IsZero() {
+		model.TrainedUntil = cutoff
+	}
+	if len(validation) > 0 {
+		baseline, _ := ml.Get(ml.DefaultModel)
+		logMetrics("Holdout "+ml.ModelID(model), ml.Evaluate(model, validation))
+		logMetrics("Holdout "+ml.DefaultModel, ml.Evaluate(baseline, validation))
+	}
+	if err := model.Save(outPath); err != nil {
+		log.Fatalf("Failed to save model: %v", err)
+	}
+
+	log.Printf("✓ Trained %s on %d samples (residual %.4f log €/kWh)", ml.ModelID(model), model.Samples, model.ResidualStd)
+	log.Printf("✓ Model written to %s", outPath)
+	log.Printf("  Start the API gateway with ML_MODEL_FILE=%s ML_MODEL=%s to use it", outPath, ml.ModelID(model))
+}
+
+// logMetrics prints the errors of one model
+func logMetrics(label string, m ml.Metrics) {
+	log.Printf("%s: %d samples, MAE %.4f, MAPE %.2f%%, RMSE %.4f, bias %+.4f",
+		label, m.Samples, m.MAE, m.MAPE, m.RMSE, m.Bias)
+}
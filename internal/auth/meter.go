@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Headers of a signed meter request
+const (
+	HeaderMeterID        = "X-Meter-ID"
+	HeaderMeterTimestamp = "X-Meter-Timestamp" // Unix seconds
+	HeaderMeterNonce     = "X-Meter-Nonce"
+	HeaderMeterSignature = "X-Meter-Signature" // hex HMAC-SHA256, see SignMeterRequest
+)
+
+// ContextMeterID holds the authenticated meter of a signed request
+const ContextMeterID = "meterId"
+
+// defaultSignatureWindow is how far a request timestamp may be from the server clock
+const defaultSignatureWindow = 5 * time.Minute
+
+// maxMeterBody is the largest signed request body accepted
+const maxMeterBody = 1 << 20
+
+// GenerateMeterSecret returns a random 256-bit secret, hex encoded
+func GenerateMeterSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// ProvisionMeter issues a new secret for a meter, replacing and re-activating
+// any previous one. Returns the secret, which is not retrievable later.
+func ProvisionMeter(db *gorm.DB, meterID string) (*models.MeterCredential, string, error) {
+	secret, err := GenerateMeterSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var credential models.MeterCredential
+	result := db.Where("meter_id = ?", meterID).Limit(1).Find(&credential)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected > 0 {
+		now := time.Now()
+		credential.Version++
+		credential.RotatedAt = &now
+	} else {
+		credential = models.MeterCredential{MeterID: meterID, Version: 1}
+	}
+	credential.Secret = secret
+	credential.Status = models.CredentialActive
+	credential.RevokedAt = nil
+
+	if err := db.Save(&credential).Error; err != nil {
+		return nil, "", err
+	}
+	return &credential, secret, nil
+}
+
+// ProvisionMissingMeters issues secrets to household meters that never had
+// one, such as the seeded demo meters. Revoked credentials are left alone.
+// Returns the number of meters provisioned.
+func ProvisionMissingMeters(db *gorm.DB) (int, error) {
+	var meterIDs []string
+	err := db.Model(&models.Household{}).
+		Where("meter_id <> '' AND meter_id NOT IN (?)", db.Model(&models.MeterCredential{}).Select("meter_id")).
+		Distinct().Pluck("meter_id", &meterIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find meters without a secret: %w", err)
+	}
+
+	for _, meterID := range meterIDs {
+		if _, _, err := ProvisionMeter(db, meterID); err != nil {
+			return 0, fmt.Errorf("failed to provision meter %s: %w", meterID, err)
+		}
+	}
+	return len(meterIDs), nil
+}
+
+// SignMeterRequest computes the signature of a meter request:
+// hex(HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + body))
+func SignMeterRequest(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureWindow returns how old (or how far ahead) a signed request may be.
+//
+// Configuration:
+//   - METER_SIGNATURE_WINDOW: accepted clock difference for signed requests (default 5m)
+func signatureWindow() time.Duration {
+	value := os.Getenv("METER_SIGNATURE_WINDOW")
+	if value == "" {
+		return defaultSignatureWindow
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return defaultSignatureWindow
+	}
+	return d
+}
+
+// VerifyMeterRequest checks the signature of a meter request and records its
+// nonce. A request is rejected if the meter has no active secret, the
+// timestamp is outside the signature window, the signature does not match
+// or the nonce was already used.
+func VerifyMeterRequest(meterID, timestamp, nonce, signature string, body []byte, now time.Time) error {
+	if meterID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("missing meter signature headers")
+	}
+	if len(nonce) > 64 {
+		return errors.New("nonce too long")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	window := signatureWindow()
+	if skew := now.Sub(time.Unix(unix, 0)); skew > window || skew < -window {
+		return fmt.Errorf("timestamp outside the %v signature window", window)
+	}
+
+	var credential models.MeterCredential
+	result := database.DB.Where("meter_id = ? AND status = ?", meterID, models.CredentialActive).Limit(1).Find(&credential)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("meter has no active credential")
+	}
+
+	expected := SignMeterRequest(credential.Secret, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+
+	used := database.DB.Create(&models.MeterNonce{MeterID: meterID, Nonce: nonce, CreatedAt: now})
+	if used.Error != nil {
+		return errors.New("nonce already used")
+	}
+	return nil
+}
+
+// SweepNonces forgets nonces that can no longer pass the timestamp check.
+// Returns the number of nonces deleted.
+func SweepNonces(now time.Time) (int64, error) {
+	result := database.DB.Where("created_at < ?", now.Add(-2*signatureWindow())).Delete(&models.MeterNonce{})
+	return result.RowsAffected, result.Error
+}
+
+// NonceSweeper periodically deletes expired meter nonces
+type NonceSweeper struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartNonceSweeper deletes expired nonces once per signature window
+func StartNonceSweeper() *NonceSweeper {
+	s := &NonceSweeper{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run(signatureWindow())
+	return s
+}
+
+// Stop stops the sweeper and waits for the current sweep to finish
+func (s *NonceSweeper) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// run sweeps nonces every interval
+func (s *NonceSweeper) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := SweepNonces(time.Now()); err != nil {
+				log.Printf("Failed to sweep meter nonces: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// MeterAuthMiddleware authenticates requests signed with a meter secret.
+// Bodies over 1 MB are refused with 413 before the signature is checked.
+// The authenticated meter ID is stored in the context; handlers must check
+// that it matches the meter in the payload.
+func MeterAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMeterBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds %d bytes", maxMeterBody)})
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		meterID := c.GetHeader(HeaderMeterID)
+		err = VerifyMeterRequest(meterID, c.GetHeader(HeaderMeterTimestamp), c.GetHeader(HeaderMeterNonce),
+			c.GetHeader(HeaderMeterSignature), body, time.Now())
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Meter authentication failed: " + err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set(ContextMeterID, meterID)
+		c.Next()
+	}
+}
+
+// GetMeterID extracts the authenticated meter ID from Gin context.
+func GetMeterID(c *gin.Context) string {
+	meterID, exists := c.Get(ContextMeterID)
+	if !exists {
+		return ""
+	}
+	return meterID.(string)
+}
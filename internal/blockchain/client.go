@@ -1,6 +1,6 @@
-// Package blockchain provides simulated blockchain logging for predictions.
-// In a real implementation, this would connect to Ethereum via go-ethereum.
-// For the course project, we simulate the blockchain to demonstrate the concept.
+// Package blockchain provides blockchain logging for predictions.
+// By default the chain is simulated locally to demonstrate the concept; the
+// Ledger interface also allows logging to a real Ethereum-compatible node.
 package blockchain
 
 import (
@@ -8,18 +8,32 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"energy-prediction/internal/config"
 	"energy-prediction/internal/database"
 	"energy-prediction/internal/models"
 )
 
-// SimulatedBlockchain represents our local blockchain simulation
+// SimulatedBlockchain represents our local blockchain simulation.
+// Transactions wait in a mempool until the block producer seals them.
 type SimulatedBlockchain struct {
 	mu          sync.Mutex
 	blockNumber uint64
 	blocks      []Block
+	txIndex     map[string]txLocation
+	mempool     []Transaction
+
+	sealMu   sync.Mutex // serializes block production
+	interval time.Duration
+	maxTxs   int
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
 }
 
 // Block represents a simulated blockchain block
@@ -27,54 +41,128 @@ type Block struct {
 	Number       uint64
 	Timestamp    time.Time
 	Transactions []Transaction
+	MerkleRoot   string
 	PrevHash     string
 	Hash         string
 }
 
 // Transaction represents a blockchain transaction
 type Transaction struct {
-	Hash         string
-	PredictionID uint
-	Data         string
-	GasUsed      uint64
+	Hash         string `json:"hash"`
+	PredictionID uint   `json:"predictionId"`
+	Data         string `json:"data"`
+	GasUsed      uint64 `json:"gasUsed"`
 }
 
-// Global blockchain instance
+// txLocation points to a transaction inside chain.blocks
+type txLocation struct {
+	block int
+	index int
+}
+
+// Block production defaults, overridable via environment variables
+const (
+	defaultBlockInterval = 5 * time.Second
+	defaultMaxBlockTxs   = 100
+)
+
+// Global simulated blockchain instance (nil when another backend is active)
 var chain *SimulatedBlockchain
 
-// Init initializes the simulated blockchain
-func Init() {
-	chain = &SimulatedBlockchain{
+// genesisPrevHash is the prev-hash of the genesis block
+const genesisPrevHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// newSimulatedBlockchain restores the simulated chain and starts the block producer.
+// Previously persisted blocks are reloaded from the database; a genesis
+// block is only created the first time the chain is started. Log rows still
+// pending from a previous run are put back into the mempool.
+//
+// Configuration:
+//   - BLOCKCHAIN_BLOCK_INTERVAL: how often a block is sealed (default 5s)
+//   - BLOCKCHAIN_MAX_BLOCK_TXS: seal early once this many txs are pending (default 100)
+func newSimulatedBlockchain() (*SimulatedBlockchain, error) {
+	bc := &SimulatedBlockchain{
 		blockNumber: 15000000, // Start from a realistic block number
 		blocks:      make([]Block, 0),
+		txIndex:     make(map[string]txLocation),
+		interval:    config.Duration("BLOCKCHAIN_BLOCK_INTERVAL", defaultBlockInterval),
+		maxTxs:      config.Int("BLOCKCHAIN_MAX_BLOCK_TXS", defaultMaxBlockTxs),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	blocks, err := loadChain()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blockchain: %w", err)
 	}
 
-	// Create genesis block
-	genesis := Block{
-		Number:    chain.blockNumber,
-		Timestamp: time.Now(),
-		PrevHash:  "0x0000000000000000000000000000000000000000000000000000000000000000",
+	if len(blocks) > 0 {
+		for _, block := range blocks {
+			bc.appendBlock(block)
+		}
+
+		// Warn if the stored prev-hash links no longer match
+		for i := 1; i < len(blocks); i++ {
+			if blocks[i].PrevHash != blocks[i-1].Hash {
+				log.Printf("Warning: blockchain link broken at block %d", blocks[i].Number)
+				break
+			}
+		}
+
+		log.Printf("✓ Simulated blockchain restored: %d blocks, head at block %d", len(blocks), bc.blockNumber)
+	} else {
+		// Create genesis block
+		genesis := Block{
+			Number:    bc.blockNumber,
+			Timestamp: time.Now(),
+			PrevHash:  genesisPrevHash,
+		}
+		genesis.MerkleRoot = merkleRoot(genesis.Transactions)
+		genesis.Hash = calculateBlockHash(&genesis)
+
+		if err := saveBlock(database.DB, &genesis); err != nil {
+			return nil, fmt.Errorf("failed to save genesis block: %w", err)
+		}
+		bc.appendBlock(genesis)
+
+		log.Println("✓ Simulated blockchain initialized at block", bc.blockNumber)
 	}
-	genesis.Hash = calculateBlockHash(&genesis)
-	chain.blocks = append(chain.blocks, genesis)
 
-	log.Println("✓ Simulated blockchain initialized at block", chain.blockNumber)
+	if err := bc.restorePending(); err != nil {
+		return nil, fmt.Errorf("failed to restore pending transactions: %w", err)
+	}
+
+	go bc.run()
+	log.Printf("✓ Block producer started (interval %v, max %d txs per block)", bc.interval, bc.maxTxs)
+	return bc, nil
 }
 
-// LogPrediction logs a prediction to the simulated blockchain.
-// Returns the transaction hash.
-func LogPrediction(prediction *models.Prediction) (string, error) {
-	chain.mu.Lock()
-	defer chain.mu.Unlock()
+// Close seals any pending transactions and stops the block producer
+func (bc *SimulatedBlockchain) Close() {
+	select {
+	case <-bc.done:
+		return // already stopped
+	default:
+	}
+	close(bc.stop)
+	<-bc.done
+}
+
+// Flush immediately seals all pending transactions into blocks
+func Flush() error {
+	if chain == nil {
+		return ErrNotSupported
+	}
+	return chain.sealPending(true)
+}
 
+// LogPrediction submits a prediction to the mempool of the simulated blockchain.
+// Returns the transaction hash. The log row stays "pending" until the block
+// producer seals the transaction into a block.
+func (bc *SimulatedBlockchain) LogPrediction(prediction *models.Prediction) (string, error) {
 	// Create transaction data
-	data := fmt.Sprintf("PREDICTION|%d|%s|%.4f|%d|%s",
-		prediction.ID,
-		prediction.MeterID,
-		prediction.PredictedPrice,
-		prediction.Confidence,
-		prediction.Timestamp.Format(time.RFC3339),
-	)
+	data := predictionPayload(prediction)
 
 	// Generate transaction hash
 	txHash := generateTxHash(data, prediction.ID)
@@ -90,38 +178,65 @@ func LogPrediction(prediction *models.Prediction) (string, error) {
 		GasUsed:      gasUsed,
 	}
 
-	// Add to current block or create new block
-	chain.blockNumber++
-	prevHash := chain.blocks[len(chain.blocks)-1].Hash
-
-	newBlock := Block{
-		Number:       chain.blockNumber,
-		Timestamp:    time.Now(),
-		Transactions: []Transaction{tx},
-		PrevHash:     prevHash,
-	}
-	newBlock.Hash = calculateBlockHash(&newBlock)
-	chain.blocks = append(chain.blocks, newBlock)
-
-	// Create blockchain log entry
-	confirmedAt := time.Now()
+	// Create blockchain log entry (confirmed once the block is sealed)
 	blockchainLog := models.BlockchainLog{
 		PredictionID:    prediction.ID,
 		TransactionHash: txHash,
-		BlockNumber:     chain.blockNumber,
 		GasUsed:         gasUsed,
-		Status:          "confirmed",
-		ContractAddress: "0x742d35Cc6634C0532925a3b844Bc9e7595f4e2E1",
-		ConfirmedAt:     &confirmedAt,
+		Status:          "pending",
+		ContractAddress: contractAddress,
 	}
 
 	if err := database.DB.Create(&blockchainLog).Error; err != nil {
 		return "", fmt.Errorf("failed to save blockchain log: %w", err)
 	}
 
+	bc.submit(tx)
 	return txHash, nil
 }
 
+// predictionPayload builds the transaction data logged for a prediction.
+// Format: PREDICTION|id|meterId|price|confidence|timestamp[|model|version[|seed[|features]]]
+// The model fields are omitted for predictions made before models were
+// versioned, the seed for those made before predictions were reproducible and
+// the household features (see featuresField) for those made before they
+// were recorded.
+func predictionPayload(prediction *models.Prediction) string {
+	data := fmt.Sprintf("PREDICTION|%d|%s|%.4f|%d|%s",
+		prediction.ID,
+		prediction.MeterID,
+		prediction.PredictedPrice,
+		prediction.Confidence,
+		prediction.Timestamp.Format(time.RFC3339),
+	)
+	if prediction.ModelName != "" || prediction.Seed != 0 || prediction.Features != nil {
+		data += "|" + prediction.ModelName + "|" + prediction.ModelVersion
+	}
+	if prediction.Seed != 0 || prediction.Features != nil {
+		data += "|" + strconv.FormatInt(prediction.Seed, 10)
+	}
+	if prediction.Features != nil {
+		data += "|" + featuresField(prediction.Features)
+	}
+	return data
+}
+
+// featuresField encodes household features as one payload field:
+// region;members;heatingType;areaSqm;yearBuilt, the region escaped so it
+// cannot contain a separator. Returns "" for nil.
+func featuresField(f *models.HouseholdFeatures) string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join([]string{
+		url.PathEscape(f.Region),
+		strconv.Itoa(f.Members),
+		string(f.HeatingType),
+		strconv.FormatFloat(f.AreaSqm, 'g', -1, 64),
+		strconv.Itoa(f.YearBuilt),
+	}, ";")
+}
+
 // generateTxHash creates a transaction hash from the data
 func generateTxHash(data string, predictionID uint) string {
 	input := fmt.Sprintf("%s|%d|%d", data, predictionID, time.Now().UnixNano())
@@ -129,64 +244,82 @@ func generateTxHash(data string, predictionID uint) string {
 	return "0x" + hex.EncodeToString(hash[:])
 }
 
-// calculateBlockHash computes the hash of a block
+// calculateBlockHash computes the hash of a block.
+// The Merkle root commits the hash to the contents of every transaction.
 func calculateBlockHash(block *Block) string {
-	input := fmt.Sprintf("%d|%s|%s|%d",
-		block.Number,
-		block.PrevHash,
-		block.Timestamp.Format(time.RFC3339Nano),
-		len(block.Transactions),
-	)
-	hash := sha256.Sum256([]byte(input))
-	return "0x" + hex.EncodeToString(hash[:])
+	header := block.Header()
+	return header.computeHash()
 }
 
-// GetBlockNumber returns the current block number
+// GetBlockNumber returns the current block number of the simulated chain
 func GetBlockNumber() uint64 {
+	if chain == nil {
+		return 0
+	}
 	chain.mu.Lock()
 	defer chain.mu.Unlock()
 	return chain.blockNumber
 }
 
-// GetTransaction retrieves a transaction by hash
-func GetTransaction(txHash string) (*Transaction, error) {
+// GetBlock retrieves a sealed block of the simulated chain by number
+func GetBlock(number uint64) (*Block, error) {
+	if chain == nil {
+		return nil, ErrNotSupported
+	}
 	chain.mu.Lock()
 	defer chain.mu.Unlock()
 
-	for _, block := range chain.blocks {
-		for _, tx := range block.Transactions {
-			if tx.Hash == txHash {
-				return &tx, nil
-			}
-		}
+	// Block numbers are consecutive from genesis
+	if len(chain.blocks) == 0 || number < chain.blocks[0].Number || number > chain.blockNumber {
+		return nil, fmt.Errorf("block not found: %d", number)
 	}
-	return nil, fmt.Errorf("transaction not found: %s", txHash)
+	block := chain.blocks[number-chain.blocks[0].Number]
+	return &block, nil
 }
 
-// VerifyTransaction checks if a transaction exists and is valid
-func VerifyTransaction(txHash string) (bool, *models.BlockchainLog, error) {
+// GetTransaction retrieves a sealed transaction by hash
+func (bc *SimulatedBlockchain) GetTransaction(txHash string) (*Transaction, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	loc, ok := bc.txIndex[txHash]
+	if !ok {
+		return nil, fmt.Errorf("transaction not found: %s", txHash)
+	}
+	tx := bc.blocks[loc.block].Transactions[loc.index]
+	return &tx, nil
+}
+
+// VerifyTransaction checks if a transaction exists and is valid.
+// A transaction is only valid if its log row is confirmed and the
+// transaction is actually included in the chain for that prediction.
+func (bc *SimulatedBlockchain) VerifyTransaction(txHash string) (bool, *models.BlockchainLog, error) {
 	var log models.BlockchainLog
 	if err := database.DB.Where("transaction_hash = ?", txHash).First(&log).Error; err != nil {
 		return false, nil, fmt.Errorf("transaction not found")
 	}
-	return log.Status == "confirmed", &log, nil
+
+	tx, err := bc.GetTransaction(txHash)
+	if err != nil {
+		return false, &log, nil
+	}
+
+	return log.Status == "confirmed" && tx.PredictionID == log.PredictionID, &log, nil
 }
 
 // GetStats returns blockchain statistics
-func GetStats() map[string]interface{} {
-	chain.mu.Lock()
-	defer chain.mu.Unlock()
-
-	var totalTx int
-	for _, block := range chain.blocks {
-		totalTx += len(block.Transactions)
-	}
+func (bc *SimulatedBlockchain) GetStats() map[string]interface{} {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
 
 	return map[string]interface{}{
-		"currentBlock":      chain.blockNumber,
-		"totalBlocks":       len(chain.blocks),
-		"totalTransactions": totalTx,
-		"contractAddress":   "0x742d35Cc6634C0532925a3b844Bc9e7595f4e2E1",
-		"network":           "simulated",
+		"currentBlock":        bc.blockNumber,
+		"totalBlocks":         len(bc.blocks),
+		"totalTransactions":   len(bc.txIndex),
+		"pendingTransactions": len(bc.mempool),
+		"blockInterval":       bc.interval.String(),
+		"maxBlockTxs":         bc.maxTxs,
+		"contractAddress":     contractAddress,
+		"network":             "simulated",
 	}
 }
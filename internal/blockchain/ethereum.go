@@ -0,0 +1,379 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"energy-prediction/internal/config"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// Ethereum backend defaults, overridable via environment variables
+const (
+	defaultEthRPCURL          = "http://localhost:8545"
+	defaultEthReceiptInterval = 2 * time.Second
+)
+
+// EthereumLedger logs predictions as calldata transactions to an
+// Ethereum-compatible JSON-RPC node (e.g. a local anvil or ganache dev chain).
+// Transactions are sent with eth_sendTransaction from an account unlocked on
+// the node, so no private key is handled by the gateway. A background poller
+// fills GasUsed and BlockNumber from the real receipts.
+type EthereumLedger struct {
+	rpc  *rpcClient
+	from string
+
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// newEthereumLedger connects to the node and starts the receipt poller.
+//
+// Configuration:
+//   - ETH_RPC_URL: JSON-RPC endpoint (default http://localhost:8545)
+//   - ETH_FROM: sending account (default: first account from eth_accounts)
+//   - ETH_RECEIPT_POLL_INTERVAL: how often pending receipts are checked (default 2s)
+func newEthereumLedger() (*EthereumLedger, error) {
+	url := os.Getenv("ETH_RPC_URL")
+	if url == "" {
+		url = defaultEthRPCURL
+	}
+
+	eth := &EthereumLedger{
+		rpc:      newRPCClient(url),
+		from:     os.Getenv("ETH_FROM"),
+		interval: config.Duration("ETH_RECEIPT_POLL_INTERVAL", defaultEthReceiptInterval),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	var chainID string
+	if err := eth.rpc.call("eth_chainId", nil, &chainID); err != nil {
+		return nil, fmt.Errorf("failed to reach Ethereum node at %s: %w", url, err)
+	}
+
+	if eth.from == "" {
+		var accounts []string
+		if err := eth.rpc.call("eth_accounts", nil, &accounts); err != nil {
+			return nil, fmt.Errorf("failed to list accounts: %w", err)
+		}
+		if len(accounts) == 0 {
+			return nil, fmt.Errorf("node has no unlocked accounts, set ETH_FROM")
+		}
+		eth.from = accounts[0]
+	}
+
+	go eth.pollReceipts()
+	log.Printf("✓ Connected to Ethereum node %s (chain %s, from %s)", url, chainID, eth.from)
+	return eth, nil
+}
+
+// Close stops the receipt poller
+func (eth *EthereumLedger) Close() {
+	eth.once.Do(func() {
+		close(eth.stop)
+		<-eth.done
+	})
+}
+
+// LogPrediction sends the prediction payload as calldata to the contract
+// address. The log row is stored before the transaction is sent, under the
+// prediction's unsent hash, so a failed insert never leaves a transaction on
+// chain without a log row. It takes the real hash once sent and stays
+// "pending" until the receipt is mined. Once the transaction is sent the hash
+// is returned even if the row cannot be updated, since an error would make
+// the outbox send it again; the outbox then records the hash itself.
+func (eth *EthereumLedger) LogPrediction(prediction *models.Prediction) (string, error) {
+	data := predictionPayload(prediction)
+
+	if err := markUnsent(prediction.ID, "pending", ""); err != nil {
+		return "", fmt.Errorf("failed to save blockchain log: %w", err)
+	}
+
+	tx := map[string]string{
+		"from": eth.from,
+		"to":   contractAddress,
+		"data": "0x" + hex.EncodeToString([]byte(data)),
+	}
+
+	var txHash string
+	if err := eth.rpc.call("eth_sendTransaction", []interface{}{tx}, &txHash); err != nil {
+		return "", fmt.Errorf("failed to send transaction: %w", err)
+	}
+
+	var blockchainLog models.BlockchainLog
+	err := database.DB.Where("transaction_hash = ?", unsentHash(prediction.ID)).First(&blockchainLog).Error
+	if err == nil {
+		err = database.DB.Model(&blockchainLog).Updates(map[string]interface{}{
+			"transaction_hash": txHash,
+			"status":           "pending",
+			"error":            "",
+		}).Error
+	}
+	if err != nil {
+		log.Printf("Warning: transaction %s of prediction %d sent but not recorded: %v", txHash, prediction.ID, err)
+		return txHash, nil
+	}
+	blockchainLog.TransactionHash = txHash
+
+	// Dev chains usually mine instantly, so try to confirm right away
+	if err := eth.confirm(&blockchainLog); err != nil {
+		log.Printf("Receipt for %s not available yet: %v", txHash, err)
+	}
+
+	return txHash, nil
+}
+
+// GetTransaction fetches a transaction and its receipt from the node
+func (eth *EthereumLedger) GetTransaction(txHash string) (*Transaction, error) {
+	var tx *rpcTransaction
+	if err := eth.rpc.call("eth_getTransactionByHash", []interface{}{txHash}, &tx); err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("transaction not found: %s", txHash)
+	}
+
+	input, err := decodeHash(tx.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction input: %w", err)
+	}
+
+	result := &Transaction{
+		Hash: tx.Hash,
+		Data: string(input),
+	}
+	if logged, err := parsePredictionPayload(result.Data); err == nil {
+		result.PredictionID = logged.ID
+	}
+
+	receipt, err := eth.receipt(txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt != nil {
+		result.GasUsed, _ = parseHexUint64(receipt.GasUsed)
+	}
+
+	return result, nil
+}
+
+// VerifyTransaction checks the log row, the mined receipt and that the
+// on-chain calldata references the logged prediction.
+func (eth *EthereumLedger) VerifyTransaction(txHash string) (bool, *models.BlockchainLog, error) {
+	var log models.BlockchainLog
+	if err := database.DB.Where("transaction_hash = ?", txHash).First(&log).Error; err != nil {
+		return false, nil, fmt.Errorf("transaction not found")
+	}
+
+	tx, err := eth.GetTransaction(txHash)
+	if err != nil {
+		return false, &log, nil
+	}
+
+	receipt, err := eth.receipt(txHash)
+	if err != nil || receipt == nil || receipt.Status != "0x1" {
+		return false, &log, nil
+	}
+
+	return log.Status == "confirmed" && tx.PredictionID == log.PredictionID, &log, nil
+}
+
+// GetStats returns node statistics
+func (eth *EthereumLedger) GetStats() map[string]interface{} {
+	stats := map[string]interface{}{
+		"contractAddress": contractAddress,
+		"network":         "ethereum",
+		"rpcUrl":          eth.rpc.url,
+		"from":            eth.from,
+	}
+
+	var blockNumber, chainID string
+	if err := eth.rpc.call("eth_blockNumber", nil, &blockNumber); err == nil {
+		stats["currentBlock"], _ = parseHexUint64(blockNumber)
+	} else {
+		stats["error"] = err.Error()
+	}
+	if err := eth.rpc.call("eth_chainId", nil, &chainID); err == nil {
+		stats["chainId"], _ = parseHexUint64(chainID)
+	}
+
+	var pending int64
+	sentLogs(database.DB.Model(&models.BlockchainLog{})).Where("status = ?", "pending").Count(&pending)
+	stats["pendingTransactions"] = pending
+
+	return stats
+}
+
+// pollReceipts periodically confirms pending log rows from mined receipts
+func (eth *EthereumLedger) pollReceipts() {
+	defer close(eth.done)
+
+	ticker := time.NewTicker(eth.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			var logs []models.BlockchainLog
+			if err := sentLogs(database.DB).Where("status = ?", "pending").Order("id ASC").Find(&logs).Error; err != nil {
+				log.Printf("Failed to load pending transactions: %v", err)
+				continue
+			}
+			for i := range logs {
+				if err := eth.confirm(&logs[i]); err != nil {
+					log.Printf("Failed to check receipt for %s: %v", logs[i].TransactionHash, err)
+				}
+			}
+		case <-eth.stop:
+			return
+		}
+	}
+}
+
+// confirm updates a pending log row from its receipt, if it has been mined
+func (eth *EthereumLedger) confirm(blockchainLog *models.BlockchainLog) error {
+	receipt, err := eth.receipt(blockchainLog.TransactionHash)
+	if err != nil || receipt == nil {
+		return err
+	}
+
+	gasUsed, err := parseHexUint64(receipt.GasUsed)
+	if err != nil {
+		return fmt.Errorf("invalid gasUsed: %w", err)
+	}
+	blockNumber, err := parseHexUint64(receipt.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("invalid blockNumber: %w", err)
+	}
+
+	status, txError := "confirmed", ""
+	if receipt.Status != "0x1" {
+		status, txError = "failed", "transaction reverted"
+	}
+
+	confirmedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":       status,
+		"error":        txError,
+		"gas_used":     gasUsed,
+		"block_number": blockNumber,
+		"confirmed_at": confirmedAt,
+	}
+	if err := database.DB.Model(blockchainLog).Updates(updates).Error; err != nil {
+		return err
+	}
+	if status == "confirmed" {
+		database.DB.Model(&models.Prediction{}).Where("id = ?", blockchainLog.PredictionID).Update("blockchain_confirmed", true)
+	} else {
+		requeueReverted(blockchainLog.PredictionID, blockchainLog.TransactionHash)
+	}
+
+	blockchainLog.Status = status
+	blockchainLog.Error = txError
+	blockchainLog.GasUsed = gasUsed
+	blockchainLog.BlockNumber = blockNumber
+	blockchainLog.ConfirmedAt = &confirmedAt
+	return nil
+}
+
+// receipt fetches a transaction receipt; returns nil if not mined yet
+func (eth *EthereumLedger) receipt(txHash string) (*rpcReceipt, error) {
+	var receipt *rpcReceipt
+	if err := eth.rpc.call("eth_getTransactionReceipt", []interface{}{txHash}, &receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// ========== Minimal JSON-RPC client ==========
+
+// rpcClient is a minimal Ethereum JSON-RPC 2.0 client over HTTP
+type rpcClient struct {
+	url    string
+	http   *http.Client
+	nextID uint64
+}
+
+// rpcTransaction holds the fields we need from eth_getTransactionByHash
+type rpcTransaction struct {
+	Hash        string `json:"hash"`
+	Input       string `json:"input"`
+	BlockNumber string `json:"blockNumber"`
+}
+
+// rpcReceipt holds the fields we need from eth_getTransactionReceipt
+type rpcReceipt struct {
+	TransactionHash string `json:"transactionHash"`
+	BlockNumber     string `json:"blockNumber"`
+	GasUsed         string `json:"gasUsed"`
+	Status          string `json:"status"`
+}
+
+func newRPCClient(url string) *rpcClient {
+	return &rpcClient{
+		url:  url,
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// call invokes a JSON-RPC method and decodes the result into result.
+// A null result leaves pointer results nil.
+func (c *rpcClient) call(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      atomic.AddUint64(&c.nextID, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("%s: invalid response (HTTP %d): %w", method, resp.StatusCode, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("%s: rpc error %d: %s", method, rpcResp.Error.Code, rpcResp.Error.Message)
+	}
+	if len(rpcResp.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+// parseHexUint64 parses a 0x-prefixed hex quantity
+func parseHexUint64(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
@@ -0,0 +1,289 @@
+package blockchain
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// Kinds of integrity problems reported by CheckIntegrity
+const (
+	IssueBrokenLink         = "broken_link"
+	IssueMissingBlock       = "missing_block"
+	IssueBlockHashMismatch  = "block_hash_mismatch"
+	IssueMerkleRootMismatch = "merkle_root_mismatch"
+	IssueMalformedPayload   = "malformed_payload"
+	IssuePredictionMissing  = "prediction_missing"
+	IssuePredictionTampered = "prediction_tampered"
+	IssueSignatureInvalid   = "signature_invalid"
+)
+
+// IntegrityIssue describes the first problem found while walking the chain
+type IntegrityIssue struct {
+	Kind         string `json:"kind"`
+	BlockNumber  uint64 `json:"blockNumber"`
+	TxHash       string `json:"txHash,omitempty"`
+	PredictionID uint   `json:"predictionId,omitempty"`
+	Detail       string `json:"detail"`
+}
+
+// IntegrityReport is the result of a full chain verification
+type IntegrityReport struct {
+	Valid               bool            `json:"valid"`
+	BlocksChecked       int             `json:"blocksChecked"`
+	TransactionsChecked int             `json:"transactionsChecked"`
+	PredictionsChecked  int             `json:"predictionsChecked"`
+	HeadBlock           uint64          `json:"headBlock"`
+	FirstIssue          *IntegrityIssue `json:"firstIssue,omitempty"`
+	CheckedAt           time.Time       `json:"checkedAt"`
+}
+
+// CheckIntegrity walks the persisted chain from genesis to head.
+// For every block it recomputes the Merkle root and block hash and checks
+// the prev-hash link and that block numbers are consecutive from a genesis
+// block, then compares each logged PREDICTION payload with the
+// prediction row in the database. It stops at the first problem found.
+//
+// The chain is read from the database rather than memory, so it also works
+// offline (e.g. from cmd/chain-verify) and catches edits made after startup.
+func CheckIntegrity() (*IntegrityReport, error) {
+	blocks, err := loadChain()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{
+		Valid:     true,
+		CheckedAt: time.Now(),
+	}
+
+	for i := range blocks {
+		block := &blocks[i]
+		report.BlocksChecked++
+		report.HeadBlock = block.Number
+
+		if issue := checkBlock(blocks, i); issue != nil {
+			report.Valid = false
+			report.FirstIssue = issue
+			return report, nil
+		}
+
+		for _, tx := range block.Transactions {
+			report.TransactionsChecked++
+
+			issue, err := checkTransaction(block.Number, &tx)
+			if err != nil {
+				return nil, err
+			}
+			if issue != nil {
+				report.Valid = false
+				report.FirstIssue = issue
+				return report, nil
+			}
+			report.PredictionsChecked++
+		}
+	}
+
+	return report, nil
+}
+
+// checkBlock verifies the hashes of blocks[i] and its link to the previous
+// block. The first block must be genesis, and no block may be missing since
+// GetBlock finds blocks by their offset from genesis.
+func checkBlock(blocks []Block, i int) *IntegrityIssue {
+	block := &blocks[i]
+
+	if i == 0 && block.PrevHash != genesisPrevHash {
+		return &IntegrityIssue{
+			Kind:        IssueBrokenLink,
+			BlockNumber: block.Number,
+			Detail:      fmt.Sprintf("first block has prevHash %s, expected genesis %s", block.PrevHash, genesisPrevHash),
+		}
+	}
+
+	if i > 0 && block.Number != blocks[i-1].Number+1 {
+		return &IntegrityIssue{
+			Kind:        IssueMissingBlock,
+			BlockNumber: block.Number,
+			Detail:      fmt.Sprintf("block %d follows block %d", block.Number, blocks[i-1].Number),
+		}
+	}
+
+	if i > 0 && block.PrevHash != blocks[i-1].Hash {
+		return &IntegrityIssue{
+			Kind:        IssueBrokenLink,
+			BlockNumber: block.Number,
+			Detail:      fmt.Sprintf("prevHash %s does not match hash of block %d (%s)", block.PrevHash, blocks[i-1].Number, blocks[i-1].Hash),
+		}
+	}
+
+	if root := merkleRoot(block.Transactions); root != block.MerkleRoot {
+		return &IntegrityIssue{
+			Kind:        IssueMerkleRootMismatch,
+			BlockNumber: block.Number,
+			Detail:      fmt.Sprintf("stored merkle root %s, recomputed %s", block.MerkleRoot, root),
+		}
+	}
+
+	if hash := calculateBlockHash(block); hash != block.Hash {
+		return &IntegrityIssue{
+			Kind:        IssueBlockHashMismatch,
+			BlockNumber: block.Number,
+			Detail:      fmt.Sprintf("stored hash %s, recomputed %s", block.Hash, hash),
+		}
+	}
+
+	return nil
+}
+
+// checkTransaction compares a logged prediction payload with the database row.
+// Returns an error only if the database itself cannot be queried.
+func checkTransaction(blockNumber uint64, tx *Transaction) (*IntegrityIssue, error) {
+	issue := func(kind, detail string) *IntegrityIssue {
+		return &IntegrityIssue{
+			Kind:         kind,
+			BlockNumber:  blockNumber,
+			TxHash:       tx.Hash,
+			PredictionID: tx.PredictionID,
+			Detail:       detail,
+		}
+	}
+
+	logged, err := parsePredictionPayload(tx.Data)
+	if err != nil {
+		return issue(IssueMalformedPayload, err.Error()), nil
+	}
+	if logged.ID != tx.PredictionID {
+		return issue(IssueMalformedPayload, fmt.Sprintf("payload references prediction %d", logged.ID)), nil
+	}
+
+	var prediction models.Prediction
+	result := database.DB.Limit(1).Find(&prediction, tx.PredictionID)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to load prediction %d: %w", tx.PredictionID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return issue(IssuePredictionMissing, "prediction row no longer exists"), nil
+	}
+
+	if diff := comparePrediction(logged, &prediction); diff != "" {
+		return issue(IssuePredictionTampered, diff), nil
+	}
+	if prediction.BlockchainTx != "" && prediction.BlockchainTx != tx.Hash {
+		return issue(IssuePredictionTampered, fmt.Sprintf("blockchainTx is %s", prediction.BlockchainTx)), nil
+	}
+
+	// Predictions logged before signing was introduced carry no signature
+	if prediction.Signature != "" {
+		if err := VerifyPredictionSignature(&prediction); err != nil {
+			return issue(IssueSignatureInvalid, err.Error()), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// parsePredictionPayload decodes data written by predictionPayload
+func parsePredictionPayload(data string) (*models.Prediction, error) {
+	parts := strings.Split(data, "|")
+	if len(parts) < 6 || len(parts) == 7 || len(parts) > 10 || parts[0] != "PREDICTION" {
+		return nil, fmt.Errorf("unexpected payload format: %q", data)
+	}
+
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prediction id: %w", err)
+	}
+	price, err := strconv.ParseFloat(parts[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price: %w", err)
+	}
+	confidence, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid confidence: %w", err)
+	}
+	timestamp, err := time.Parse(time.RFC3339, parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	logged := &models.Prediction{
+		ID:             uint(id),
+		MeterID:        parts[2],
+		PredictedPrice: price,
+		Confidence:     confidence,
+		Timestamp:      timestamp,
+	}
+	if len(parts) >= 8 {
+		logged.ModelName, logged.ModelVersion = parts[6], parts[7]
+	}
+	if len(parts) >= 9 {
+		if logged.Seed, err = strconv.ParseInt(parts[8], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed: %w", err)
+		}
+	}
+	if len(parts) == 10 {
+		if logged.Features, err = parseFeaturesField(parts[9]); err != nil {
+			return nil, fmt.Errorf("invalid household features: %w", err)
+		}
+	}
+	return logged, nil
+}
+
+// parseFeaturesField decodes a field written by featuresField
+func parseFeaturesField(field string) (*models.HouseholdFeatures, error) {
+	values := strings.Split(field, ";")
+	if len(values) != 5 {
+		return nil, fmt.Errorf("expected 5 values, got %d", len(values))
+	}
+	region, err := url.PathUnescape(values[0])
+	if err != nil {
+		return nil, err
+	}
+	members, err := strconv.Atoi(values[1])
+	if err != nil {
+		return nil, err
+	}
+	area, err := strconv.ParseFloat(values[3], 64)
+	if err != nil {
+		return nil, err
+	}
+	yearBuilt, err := strconv.Atoi(values[4])
+	if err != nil {
+		return nil, err
+	}
+	return &models.HouseholdFeatures{
+		Region:      region,
+		Members:     members,
+		HeatingType: models.HeatingType(values[2]),
+		AreaSqm:     area,
+		YearBuilt:   yearBuilt,
+	}, nil
+}
+
+// comparePrediction returns a description of the first field that differs
+// between the logged payload and the stored prediction, or "" if they match.
+func comparePrediction(logged, stored *models.Prediction) string {
+	switch {
+	case logged.MeterID != stored.MeterID:
+		return fmt.Sprintf("meterId logged %q, stored %q", logged.MeterID, stored.MeterID)
+	case fmt.Sprintf("%.4f", logged.PredictedPrice) != fmt.Sprintf("%.4f", stored.PredictedPrice):
+		return fmt.Sprintf("predictedPrice logged %.4f, stored %.4f", logged.PredictedPrice, stored.PredictedPrice)
+	case logged.Confidence != stored.Confidence:
+		return fmt.Sprintf("confidence logged %d, stored %d", logged.Confidence, stored.Confidence)
+	case !logged.Timestamp.Equal(stored.Timestamp.Truncate(time.Second)):
+		return fmt.Sprintf("timestamp logged %s, stored %s", logged.Timestamp.Format(time.RFC3339), stored.Timestamp.Format(time.RFC3339))
+	case logged.ModelName != stored.ModelName || logged.ModelVersion != stored.ModelVersion:
+		return fmt.Sprintf("model logged %q %q, stored %q %q", logged.ModelName, logged.ModelVersion, stored.ModelName, stored.ModelVersion)
+	case logged.Seed != stored.Seed:
+		return fmt.Sprintf("seed logged %d, stored %d", logged.Seed, stored.Seed)
+	case featuresField(logged.Features) != featuresField(stored.Features):
+		return fmt.Sprintf("household features logged %q, stored %q", featuresField(logged.Features), featuresField(stored.Features))
+	}
+	return ""
+}
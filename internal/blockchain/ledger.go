@@ -0,0 +1,152 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// Ledger is a blockchain backend that predictions can be logged to.
+// Implementations: SimulatedBlockchain (default) and EthereumLedger.
+type Ledger interface {
+	// LogPrediction submits a prediction and returns its transaction hash
+	LogPrediction(prediction *models.Prediction) (string, error)
+	// GetTransaction retrieves a transaction from the ledger by hash
+	GetTransaction(txHash string) (*Transaction, error)
+	// VerifyTransaction checks the log row and the ledger for a transaction
+	VerifyTransaction(txHash string) (bool, *models.BlockchainLog, error)
+	// GetStats returns backend statistics for the status endpoints
+	GetStats() map[string]interface{}
+}
+
+// ErrNotSupported is returned by features only the simulated chain provides
+// (blocks, inclusion proofs) when another backend is active.
+var ErrNotSupported = errors.New("not supported by the active blockchain backend")
+
+// Supported values for BLOCKCHAIN_BACKEND
+const (
+	BackendSimulated = "simulated"
+	BackendEthereum  = "ethereum"
+)
+
+// defaultContractAddress is used when BLOCKCHAIN_CONTRACT_ADDRESS is not set
+const defaultContractAddress = "0x742d35Cc6634C0532925a3b844Bc9e7595f4e2E1"
+
+var (
+	// active is the ledger all package-level calls are routed to
+	active Ledger
+
+	// contractAddress is the address prediction transactions are sent to
+	contractAddress = defaultContractAddress
+)
+
+// Init selects and starts the ledger backend.
+//
+// Configuration:
+//   - BLOCKCHAIN_BACKEND: "simulated" (default) or "ethereum"
+//   - BLOCKCHAIN_CONTRACT_ADDRESS: address predictions are logged to
+func Init() error {
+	// Stop a backend left over from a previous Init
+	Stop()
+
+	contractAddress = os.Getenv("BLOCKCHAIN_CONTRACT_ADDRESS")
+	if contractAddress == "" {
+		contractAddress = defaultContractAddress
+	}
+
+	if err := initSigner(); err != nil {
+		return err
+	}
+
+	backend := os.Getenv("BLOCKCHAIN_BACKEND")
+	if backend == "" {
+		backend = BackendSimulated
+	}
+
+	switch backend {
+	case BackendSimulated:
+		sim, err := newSimulatedBlockchain()
+		if err != nil {
+			return err
+		}
+		chain = sim
+		active = sim
+	case BackendEthereum:
+		eth, err := newEthereumLedger()
+		if err != nil {
+			return err
+		}
+		chain = nil
+		active = eth
+	default:
+		return fmt.Errorf("unknown blockchain backend %q", backend)
+	}
+
+	outbox = startRetryWorker()
+
+	log.Printf("✓ Blockchain backend: %s (contract %s)", backend, contractAddress)
+	return nil
+}
+
+// Stop shuts down the retry worker and background work of the active backend.
+// It is safe to call when the ledger was never initialized.
+func Stop() {
+	if outbox != nil {
+		outbox.close()
+		outbox = nil
+	}
+	if closer, ok := active.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+// LogPrediction signs a prediction and logs it to the active ledger.
+// The signature is stored next to the prediction's BlockchainTx.
+// Returns the transaction hash.
+func LogPrediction(prediction *models.Prediction) (string, error) {
+	if err := SignPrediction(prediction); err != nil {
+		return "", err
+	}
+	err := database.DB.Model(prediction).Updates(map[string]interface{}{
+		"signature":        prediction.Signature,
+		"signature_key_id": prediction.SignatureKeyID,
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to save signature: %w", err)
+	}
+
+	return active.LogPrediction(prediction)
+}
+
+// GetTransaction retrieves a transaction by hash from the active ledger
+func GetTransaction(txHash string) (*Transaction, error) {
+	return active.GetTransaction(txHash)
+}
+
+// VerifyTransaction checks if a transaction exists and is valid.
+// Besides the ledger check, the prediction's signature must verify;
+// predictions logged before signing was introduced carry none.
+func VerifyTransaction(txHash string) (bool, *models.BlockchainLog, error) {
+	valid, log, err := active.VerifyTransaction(txHash)
+	if err != nil || !valid {
+		return valid, log, err
+	}
+
+	var prediction models.Prediction
+	if err := database.DB.First(&prediction, log.PredictionID).Error; err != nil {
+		return false, log, nil
+	}
+	if prediction.Signature == "" {
+		return true, log, nil
+	}
+	return VerifyPredictionSignature(&prediction) == nil, log, nil
+}
+
+// GetStats returns statistics of the active ledger
+func GetStats() map[string]interface{} {
+	return active.GetStats()
+}
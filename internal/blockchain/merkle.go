@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Domain separation prefixes (RFC 6962 style) so a leaf can never be
+// reinterpreted as an inner node of the tree.
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// emptyMerkleRoot is the root of a block without transactions (e.g. genesis)
+const emptyMerkleRoot = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// hashLeaf hashes the full contents of a transaction into a Merkle leaf.
+func hashLeaf(tx *Transaction) []byte {
+	input := fmt.Sprintf("%s|%d|%s|%d", tx.Hash, tx.PredictionID, tx.Data, tx.GasUsed)
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write([]byte(input))
+	return h.Sum(nil)
+}
+
+// hashNode combines two child hashes into their parent hash.
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleLevels builds every level of the Merkle tree, from the leaves up to
+// the root. When a level has an odd number of nodes the last one is paired
+// with itself.
+func merkleLevels(txs []Transaction) [][][]byte {
+	level := make([][]byte, len(txs))
+	for i := range txs {
+		level[i] = hashLeaf(&txs[i])
+	}
+	levels := [][][]byte{level}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, hashNode(level[i], right))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+
+	return levels
+}
+
+// merkleRoot computes the Merkle root over the transactions of a block.
+func merkleRoot(txs []Transaction) string {
+	if len(txs) == 0 {
+		return emptyMerkleRoot
+	}
+	levels := merkleLevels(txs)
+	return "0x" + hex.EncodeToString(levels[len(levels)-1][0])
+}
+
+// merkleProof returns the sibling hashes needed to recompute the root from
+// the leaf at index, ordered from the leaf level upwards.
+func merkleProof(txs []Transaction, index int) []ProofStep {
+	levels := merkleLevels(txs)
+	steps := make([]ProofStep, 0, len(levels)-1)
+
+	for _, level := range levels[:len(levels)-1] {
+		var step ProofStep
+		if index%2 == 0 {
+			sibling := index
+			if index+1 < len(level) {
+				sibling = index + 1
+			}
+			step = ProofStep{Hash: "0x" + hex.EncodeToString(level[sibling]), Position: "right"}
+		} else {
+			step = ProofStep{Hash: "0x" + hex.EncodeToString(level[index-1]), Position: "left"}
+		}
+		steps = append(steps, step)
+		index /= 2
+	}
+
+	return steps
+}
@@ -0,0 +1,419 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"energy-prediction/internal/config"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Retry worker defaults, overridable via environment variables
+const (
+	defaultRetryInterval    = 5 * time.Second
+	defaultRetryBaseDelay   = 5 * time.Second
+	defaultRetryMaxDelay    = 10 * time.Minute
+	defaultRetryMaxAttempts = 10
+)
+
+// outboxBatchSize limits how many entries are logged per pass
+const outboxBatchSize = 100
+
+// unsentHashPrefix marks the log row of a prediction that has not reached the
+// ledger yet. The row shows the outbox state ("pending" while retrying,
+// "failed" once given up) and takes the real hash when a transaction is sent.
+const unsentHashPrefix = "unsent-"
+
+// unsentHash returns the placeholder hash of a prediction's unsent log row
+func unsentHash(predictionID uint) string {
+	return fmt.Sprintf("%s%d", unsentHashPrefix, predictionID)
+}
+
+// sentLogs restricts a query to log rows of transactions sent to the ledger
+func sentLogs(db *gorm.DB) *gorm.DB {
+	return db.Where("transaction_hash NOT LIKE ?", unsentHashPrefix+"%")
+}
+
+// retryWorker drains the blockchain outbox. Entries whose logging fails are
+// retried with exponential backoff until maxAttempts is reached, after which
+// they are marked "failed" and wait for an admin to re-drive them.
+type retryWorker struct {
+	mu          sync.Mutex // serializes passes over the outbox
+	interval    time.Duration
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// outbox is the running retry worker (nil before Init)
+var outbox *retryWorker
+
+// startRetryWorker starts the outbox worker.
+//
+// Configuration:
+//   - BLOCKCHAIN_RETRY_INTERVAL: how often due entries are looked for (default 5s)
+//   - BLOCKCHAIN_RETRY_BASE_DELAY: delay after the first failure, doubled per attempt (default 5s)
+//   - BLOCKCHAIN_RETRY_MAX_DELAY: upper bound for the backoff (default 10m)
+//   - BLOCKCHAIN_RETRY_MAX_ATTEMPTS: attempts before an entry is marked failed (default 10)
+func startRetryWorker() *retryWorker {
+	w := &retryWorker{
+		interval:    config.Duration("BLOCKCHAIN_RETRY_INTERVAL", defaultRetryInterval),
+		baseDelay:   config.Duration("BLOCKCHAIN_RETRY_BASE_DELAY", defaultRetryBaseDelay),
+		maxDelay:    config.Duration("BLOCKCHAIN_RETRY_MAX_DELAY", defaultRetryMaxDelay),
+		maxAttempts: config.Int("BLOCKCHAIN_RETRY_MAX_ATTEMPTS", defaultRetryMaxAttempts),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// close stops the worker and waits for the current pass to finish
+func (w *retryWorker) close() {
+	w.once.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+}
+
+// run processes due entries every interval, or right away when notified
+func (w *retryWorker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	// Pick up entries left over from a previous run
+	w.process()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.process()
+		case <-w.wake:
+			w.process()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// process logs all due outbox entries and returns how many were logged
+func (w *retryWorker) process() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var entries []models.BlockchainOutbox
+	err := database.DB.Where("status = ? AND next_attempt_at <= ?", "pending", time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(outboxBatchSize).
+		Find(&entries).Error
+	if err != nil {
+		log.Printf("Failed to load blockchain outbox: %v", err)
+		return 0
+	}
+
+	logged := 0
+	for i := range entries {
+		if err := w.deliver(&entries[i]); err != nil {
+			w.scheduleRetry(&entries[i], err)
+			continue
+		}
+		logged++
+	}
+	return logged
+}
+
+// deliver logs the prediction of an outbox entry and removes the entry.
+// A prediction that already has a live log row (e.g. the process exited
+// right after logging) is not logged a second time.
+func (w *retryWorker) deliver(entry *models.BlockchainOutbox) error {
+	var prediction models.Prediction
+	result := database.DB.Limit(1).Find(&prediction, entry.PredictionID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("Warning: dropping outbox entry %d, prediction %d no longer exists", entry.ID, entry.PredictionID)
+		return database.DB.Delete(entry).Error
+	}
+
+	var existing models.BlockchainLog
+	result = sentLogs(database.DB).Where("prediction_id = ? AND status IN ?", prediction.ID, []string{"pending", "confirmed"}).
+		Limit(1).Find(&existing)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	txHash := existing.TransactionHash
+	if result.RowsAffected == 0 {
+		hash, err := LogPrediction(&prediction)
+		if err != nil {
+			return err
+		}
+		txHash = hash
+
+		// Dev chains may report a reverted transaction right away
+		var reverted int64
+		database.DB.Model(&models.BlockchainLog{}).Where("transaction_hash = ? AND status = ?", txHash, "failed").Count(&reverted)
+		if reverted > 0 {
+			return fmt.Errorf("transaction %s reverted", txHash)
+		}
+	}
+
+	// blockchain_confirmed is set once the backend confirms the transaction
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&prediction).Update("blockchain_tx", txHash).Error; err != nil {
+			return err
+		}
+		// The unsent row takes the hash if the backend could not record it;
+		// otherwise it is left over from failed attempts and dropped
+		var recorded int64
+		if err := tx.Model(&models.BlockchainLog{}).Where("transaction_hash = ?", txHash).Count(&recorded).Error; err != nil {
+			return err
+		}
+		unsent := tx.Model(&models.BlockchainLog{}).Where("transaction_hash = ?", unsentHash(prediction.ID))
+		if recorded == 0 {
+			err := unsent.Updates(map[string]interface{}{"transaction_hash": txHash, "status": "pending", "error": ""}).Error
+			if err != nil {
+				return err
+			}
+		} else if err := unsent.Delete(&models.BlockchainLog{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(entry).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record transaction %s: %w", txHash, err)
+	}
+
+	log.Printf("✓ Prediction %d submitted to blockchain: %s", prediction.ID, txHash)
+	return nil
+}
+
+// scheduleRetry records a failed attempt and sets the next attempt time,
+// or marks the entry "failed" once it has used up its attempts. The
+// prediction's unsent log row mirrors the entry's status and error.
+func (w *retryWorker) scheduleRetry(entry *models.BlockchainOutbox, cause error) {
+	entry.Attempts++
+	entry.LastError = truncate(cause.Error(), 500)
+	entry.NextAttemptAt = time.Now().Add(w.backoff(entry.Attempts))
+	if entry.Attempts >= w.maxAttempts {
+		entry.Status = "failed"
+	}
+
+	err := database.DB.Model(entry).Updates(map[string]interface{}{
+		"status":          entry.Status,
+		"attempts":        entry.Attempts,
+		"last_error":      entry.LastError,
+		"next_attempt_at": entry.NextAttemptAt,
+	}).Error
+	if err != nil {
+		log.Printf("Failed to update outbox entry %d: %v", entry.ID, err)
+		return
+	}
+	if err := markUnsent(entry.PredictionID, entry.Status, entry.LastError); err != nil {
+		log.Printf("Failed to update blockchain log of prediction %d: %v", entry.PredictionID, err)
+	}
+
+	if entry.Status == "failed" {
+		log.Printf("Giving up on blockchain logging for prediction %d after %d attempts: %v", entry.PredictionID, entry.Attempts, cause)
+	} else {
+		log.Printf("Blockchain logging for prediction %d failed (attempt %d), retrying at %s: %v",
+			entry.PredictionID, entry.Attempts, entry.NextAttemptAt.Format(time.RFC3339), cause)
+	}
+}
+
+// markUnsent creates or updates the unsent log row of a prediction
+func markUnsent(predictionID uint, status, lastError string) error {
+	row := models.BlockchainLog{
+		PredictionID:    predictionID,
+		TransactionHash: unsentHash(predictionID),
+		Status:          status,
+		Error:           lastError,
+		ContractAddress: contractAddress,
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "transaction_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "error"}),
+	}).Create(&row).Error
+}
+
+// backoff returns the delay before the given attempt is retried:
+// baseDelay doubled for every earlier attempt, capped at maxDelay.
+func (w *retryWorker) backoff(attempts int) time.Duration {
+	delay := w.baseDelay
+	for i := 1; i < attempts && delay < w.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > w.maxDelay {
+		delay = w.maxDelay
+	}
+	return delay
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// Enqueue adds predictions to the blockchain outbox. Pass the transaction
+// the predictions are created in so both are stored atomically. Enqueueing a
+// prediction that is already waiting is a no-op.
+func Enqueue(db *gorm.DB, predictionIDs ...uint) error {
+	if len(predictionIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	entries := make([]models.BlockchainOutbox, len(predictionIDs))
+	for i, id := range predictionIDs {
+		entries[i] = models.BlockchainOutbox{
+			PredictionID:  id,
+			Status:        "pending",
+			NextAttemptAt: now,
+		}
+	}
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries).Error
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %d predictions: %w", len(predictionIDs), err)
+	}
+	return nil
+}
+
+// NotifyOutbox wakes the retry worker so new entries are logged right away
+func NotifyOutbox() {
+	if outbox == nil {
+		return
+	}
+	select {
+	case outbox.wake <- struct{}{}:
+	default: // worker already signalled
+	}
+}
+
+// ProcessOutbox logs all due outbox entries immediately.
+// Returns the number of predictions logged.
+func ProcessOutbox() (int, error) {
+	if outbox == nil {
+		return 0, errors.New("blockchain not initialized")
+	}
+	return outbox.process(), nil
+}
+
+// ListOutbox returns outbox entries, oldest first. An empty status
+// returns both pending and failed entries.
+func ListOutbox(status string, limit int) ([]models.BlockchainOutbox, int64, error) {
+	query := database.DB.Model(&models.BlockchainOutbox{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.BlockchainOutbox
+	if err := query.Order("id ASC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// Redrive resets outbox entries so they are retried right away with a fresh
+// attempt budget. With no IDs, every failed entry is re-driven.
+// Returns the number of entries reset.
+func Redrive(ids []uint) (int64, error) {
+	query := database.DB.Model(&models.BlockchainOutbox{})
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	} else {
+		query = query.Where("status = ?", "failed")
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"status":          "pending",
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		resetUnsent(ids)
+		NotifyOutbox()
+	}
+	return result.RowsAffected, nil
+}
+
+// resetUnsent marks the unsent log rows of re-driven entries "pending" again
+func resetUnsent(ids []uint) {
+	var predictionIDs []uint
+	query := database.DB.Model(&models.BlockchainOutbox{}).Where("status = ?", "pending")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if err := query.Pluck("prediction_id", &predictionIDs).Error; err != nil || len(predictionIDs) == 0 {
+		return
+	}
+
+	hashes := make([]string, len(predictionIDs))
+	for i, id := range predictionIDs {
+		hashes[i] = unsentHash(id)
+	}
+	err := database.DB.Model(&models.BlockchainLog{}).
+		Where("transaction_hash IN ? AND status = ?", hashes, "failed").
+		Update("status", "pending").Error
+	if err != nil {
+		log.Printf("Failed to reset blockchain logs of re-driven entries: %v", err)
+	}
+}
+
+// requeueReverted puts a prediction whose transaction failed on the ledger
+// back into the outbox. Earlier failed transactions count as attempts, so a
+// prediction that keeps reverting eventually ends up "failed". If the
+// prediction is still in the outbox, the worker handles the failure itself.
+func requeueReverted(predictionID uint, txHash string) {
+	if outbox == nil {
+		return
+	}
+
+	var failed int64
+	sentLogs(database.DB.Model(&models.BlockchainLog{})).
+		Where("prediction_id = ? AND status = ?", predictionID, "failed").
+		Count(&failed)
+
+	entry := models.BlockchainOutbox{
+		PredictionID:  predictionID,
+		Status:        "pending",
+		Attempts:      int(failed),
+		LastError:     fmt.Sprintf("transaction %s reverted", txHash),
+		NextAttemptAt: time.Now().Add(outbox.backoff(int(failed))),
+	}
+	if entry.Attempts >= outbox.maxAttempts {
+		entry.Status = "failed"
+	}
+
+	err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error
+	if err != nil {
+		log.Printf("Failed to requeue prediction %d: %v", predictionID, err)
+	}
+}
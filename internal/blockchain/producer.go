@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// run is the block producer loop. It seals the mempool every interval,
+// or earlier when enough transactions are waiting to fill a block.
+func (bc *SimulatedBlockchain) run() {
+	defer close(bc.done)
+
+	ticker := time.NewTicker(bc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := bc.sealPending(true); err != nil {
+				log.Printf("Failed to seal block: %v", err)
+			}
+		case <-bc.wake:
+			if err := bc.sealPending(false); err != nil {
+				log.Printf("Failed to seal block: %v", err)
+			}
+		case <-bc.stop:
+			if err := bc.sealPending(true); err != nil {
+				log.Printf("Failed to seal block on shutdown: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// submit adds a transaction to the mempool and wakes the producer
+// once a full block is waiting.
+func (bc *SimulatedBlockchain) submit(tx Transaction) {
+	bc.mu.Lock()
+	bc.mempool = append(bc.mempool, tx)
+	full := len(bc.mempool) >= bc.maxTxs
+	bc.mu.Unlock()
+
+	if full {
+		select {
+		case bc.wake <- struct{}{}:
+		default: // producer already signalled
+		}
+	}
+}
+
+// sealPending seals mempool transactions into blocks of at most maxTxs.
+// With all=false only full blocks are sealed, leaving the remainder for the
+// next interval.
+func (bc *SimulatedBlockchain) sealPending(all bool) error {
+	bc.sealMu.Lock()
+	defer bc.sealMu.Unlock()
+
+	for {
+		bc.mu.Lock()
+		pending := len(bc.mempool)
+		bc.mu.Unlock()
+
+		if pending == 0 || (!all && pending < bc.maxTxs) {
+			return nil
+		}
+		if err := bc.sealBlock(); err != nil {
+			return err
+		}
+	}
+}
+
+// sealBlock takes up to maxTxs transactions from the mempool, persists them
+// as a new block and confirms their log rows. On failure the transactions are
+// returned to the front of the mempool. Callers must hold sealMu.
+func (bc *SimulatedBlockchain) sealBlock() error {
+	bc.mu.Lock()
+	n := len(bc.mempool)
+	if n > bc.maxTxs {
+		n = bc.maxTxs
+	}
+	txs := make([]Transaction, n)
+	copy(txs, bc.mempool[:n])
+	bc.mempool = bc.mempool[n:]
+
+	block := Block{
+		Number:       bc.blockNumber + 1,
+		Timestamp:    time.Now(),
+		Transactions: txs,
+		PrevHash:     bc.blocks[len(bc.blocks)-1].Hash,
+	}
+	bc.mu.Unlock()
+
+	block.MerkleRoot = merkleRoot(block.Transactions)
+	block.Hash = calculateBlockHash(&block)
+
+	hashes := make([]string, len(txs))
+	predictionIDs := make([]uint, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash
+		predictionIDs[i] = tx.PredictionID
+	}
+
+	// Persist the block and confirm its log rows together
+	err := database.DB.Transaction(func(dbTx *gorm.DB) error {
+		if err := saveBlock(dbTx, &block); err != nil {
+			return err
+		}
+		err := dbTx.Model(&models.BlockchainLog{}).
+			Where("transaction_hash IN ?", hashes).
+			Updates(map[string]interface{}{
+				"status":       "confirmed",
+				"block_number": block.Number,
+				"confirmed_at": block.Timestamp,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed to confirm blockchain logs: %w", err)
+		}
+		err = dbTx.Model(&models.Prediction{}).
+			Where("id IN ?", predictionIDs).
+			Update("blockchain_confirmed", true).Error
+		if err != nil {
+			return fmt.Errorf("failed to confirm predictions: %w", err)
+		}
+		return nil
+	})
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if err != nil {
+		bc.mempool = append(txs, bc.mempool...)
+		return err
+	}
+
+	bc.appendBlock(block)
+	return nil
+}
+
+// appendBlock adds a sealed block to the chain and indexes its transactions.
+// Callers must hold mu.
+func (bc *SimulatedBlockchain) appendBlock(block Block) {
+	bc.blocks = append(bc.blocks, block)
+	bc.blockNumber = block.Number
+	for i, tx := range block.Transactions {
+		bc.txIndex[tx.Hash] = txLocation{block: len(bc.blocks) - 1, index: i}
+	}
+}
+
+// restorePending puts log rows that were never sealed (e.g. because the
+// process exited) back into the mempool.
+func (bc *SimulatedBlockchain) restorePending() error {
+	var logs []models.BlockchainLog
+	if err := sentLogs(database.DB).Where("status = ?", "pending").Order("id ASC").Preload("Prediction").Find(&logs).Error; err != nil {
+		return err
+	}
+
+	for _, l := range logs {
+		if _, sealed := bc.txIndex[l.TransactionHash]; sealed {
+			continue
+		}
+		if l.Prediction.ID == 0 {
+			log.Printf("Warning: pending transaction %s references missing prediction %d", l.TransactionHash, l.PredictionID)
+			continue
+		}
+		bc.mempool = append(bc.mempool, Transaction{
+			Hash:         l.TransactionHash,
+			PredictionID: l.PredictionID,
+			Data:         predictionPayload(&l.Prediction),
+			GasUsed:      l.GasUsed,
+		})
+	}
+
+	if len(bc.mempool) > 0 {
+		log.Printf("✓ Restored %d pending blockchain transactions", len(bc.mempool))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlockHeader contains everything needed to recompute a block hash
+// without the block's transactions.
+type BlockHeader struct {
+	Number     uint64    `json:"number"`
+	Timestamp  time.Time `json:"timestamp"`
+	TxCount    int       `json:"txCount"`
+	MerkleRoot string    `json:"merkleRoot"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash"`
+}
+
+// ProofStep is one sibling hash on the path from a leaf to the Merkle root.
+// Position tells whether the sibling sits on the "left" or "right".
+type ProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"`
+}
+
+// InclusionProof is a self-contained proof that a transaction was included
+// in a block, and that the block is linked to every later block up to Anchor.
+// It can be checked with VerifyProof without access to the database.
+type InclusionProof struct {
+	Transaction Transaction   `json:"transaction"`
+	LeafHash    string        `json:"leafHash"`
+	LeafIndex   int           `json:"leafIndex"`
+	Siblings    []ProofStep   `json:"siblings"`
+	Block       BlockHeader   `json:"block"`
+	Chain       []BlockHeader `json:"chain"` // headers after Block, ending at Anchor
+	Anchor      BlockHeader   `json:"anchor"`
+}
+
+// Header returns the header of a block
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{
+		Number:     b.Number,
+		Timestamp:  b.Timestamp,
+		TxCount:    len(b.Transactions),
+		MerkleRoot: b.MerkleRoot,
+		PrevHash:   b.PrevHash,
+		Hash:       b.Hash,
+	}
+}
+
+// computeHash recomputes the block hash from the header fields
+func (h *BlockHeader) computeHash() string {
+	input := fmt.Sprintf("%d|%s|%s|%d|%s",
+		h.Number,
+		h.PrevHash,
+		h.Timestamp.UTC().Format(time.RFC3339Nano),
+		h.TxCount,
+		h.MerkleRoot,
+	)
+	hash := sha256.Sum256([]byte(input))
+	return "0x" + hex.EncodeToString(hash[:])
+}
+
+// GetInclusionProof builds an inclusion proof for a sealed transaction.
+// The prev-hash chain runs from the transaction's block up to the anchor
+// block; an anchor of 0 means the current head.
+func GetInclusionProof(txHash string, anchor uint64) (*InclusionProof, error) {
+	if chain == nil {
+		return nil, ErrNotSupported
+	}
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	loc, ok := chain.txIndex[txHash]
+	if !ok {
+		return nil, fmt.Errorf("transaction not found: %s", txHash)
+	}
+	block := &chain.blocks[loc.block]
+
+	if anchor == 0 {
+		anchor = chain.blockNumber
+	}
+	if anchor < block.Number || anchor > chain.blockNumber {
+		return nil, fmt.Errorf("anchor block %d must be between %d and %d", anchor, block.Number, chain.blockNumber)
+	}
+
+	// Block numbers are consecutive, so the anchor is at a fixed offset
+	end := loc.block + int(anchor-block.Number)
+	headers := make([]BlockHeader, 0, end-loc.block)
+	for i := loc.block + 1; i <= end; i++ {
+		headers = append(headers, chain.blocks[i].Header())
+	}
+
+	tx := block.Transactions[loc.index]
+	return &InclusionProof{
+		Transaction: tx,
+		LeafHash:    "0x" + hex.EncodeToString(hashLeaf(&tx)),
+		LeafIndex:   loc.index,
+		Siblings:    merkleProof(block.Transactions, loc.index),
+		Block:       block.Header(),
+		Chain:       headers,
+		Anchor:      chain.blocks[end].Header(),
+	}, nil
+}
+
+// VerifyProof checks an inclusion proof offline. It recomputes the leaf from
+// the transaction, folds the sibling hashes into the Merkle root, recomputes
+// every block hash and checks each prev-hash link up to the anchor.
+// Returns nil if the proof is valid.
+func VerifyProof(proof *InclusionProof) error {
+	if proof == nil {
+		return fmt.Errorf("proof is empty")
+	}
+
+	leaf := hashLeaf(&proof.Transaction)
+	if "0x"+hex.EncodeToString(leaf) != proof.LeafHash {
+		return fmt.Errorf("leaf hash does not match transaction contents")
+	}
+	if !strings.HasPrefix(proof.Transaction.Data, fmt.Sprintf("PREDICTION|%d|", proof.Transaction.PredictionID)) {
+		return fmt.Errorf("transaction data does not reference prediction %d", proof.Transaction.PredictionID)
+	}
+
+	// Fold sibling hashes into the Merkle root
+	current := leaf
+	for i, step := range proof.Siblings {
+		sibling, err := decodeHash(step.Hash)
+		if err != nil {
+			return fmt.Errorf("invalid sibling %d: %w", i, err)
+		}
+		switch step.Position {
+		case "left":
+			current = hashNode(sibling, current)
+		case "right":
+			current = hashNode(current, sibling)
+		default:
+			return fmt.Errorf("invalid sibling position %q", step.Position)
+		}
+	}
+
+	root, err := decodeHash(proof.Block.MerkleRoot)
+	if err != nil {
+		return fmt.Errorf("invalid merkle root: %w", err)
+	}
+	if !bytes.Equal(current, root) {
+		return fmt.Errorf("merkle path does not lead to the block's merkle root")
+	}
+
+	// Check the block hash and every link up to the anchor
+	prev := proof.Block
+	if prev.computeHash() != prev.Hash {
+		return fmt.Errorf("hash of block %d does not match its header", prev.Number)
+	}
+	for _, header := range proof.Chain {
+		if header.computeHash() != header.Hash {
+			return fmt.Errorf("hash of block %d does not match its header", header.Number)
+		}
+		if header.PrevHash != prev.Hash || header.Number != prev.Number+1 {
+			return fmt.Errorf("block %d does not link to block %d", header.Number, prev.Number)
+		}
+		prev = header
+	}
+	if prev.Hash != proof.Anchor.Hash || prev.Number != proof.Anchor.Number {
+		return fmt.Errorf("chain does not end at anchor block %d", proof.Anchor.Number)
+	}
+
+	return nil
+}
+
+// decodeHash parses a 0x-prefixed hex hash
+func decodeHash(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
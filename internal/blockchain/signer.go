@@ -0,0 +1,243 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SignatureAlgorithm is the algorithm used for prediction attestations
+const SignatureAlgorithm = "ed25519"
+
+// defaultSigningKeyFile stores the generated key when SIGNING_KEY is not set
+const defaultSigningKeyFile = "data/signing.key"
+
+// signer holds the active private key of this API gateway
+var signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// CanonicalPrediction returns the byte encoding of a prediction that is signed.
+// Fields are written in a fixed order; floats use the shortest representation
+// that round-trips exactly and the timestamp is normalized to UTC. Text
+// fields are escaped with url.PathEscape so they cannot contain the separator.
+//
+// Format: EP-PREDICTION-V1|id|userId|houseId|meterId|timestamp|hour|temperature|consumptionKwh|predictedPrice|actualPrice|confidence
+//
+// Predictions that record their model are encoded as EP-PREDICTION-V2 with
+// the model name and version appended, so V1 signatures stay valid. Those
+// that also record their seed are encoded as EP-PREDICTION-V3 with the seed
+// appended after the model, and those that record their household features
+// as EP-PREDICTION-V4 with region, members, heatingType, areaSqm and
+// yearBuilt appended after the seed.
+func CanonicalPrediction(p *models.Prediction) []byte {
+	version := "EP-PREDICTION-V1"
+	switch {
+	case p.Features != nil:
+		version = "EP-PREDICTION-V4"
+	case p.Seed != 0:
+		version = "EP-PREDICTION-V3"
+	case p.ModelName != "":
+		version = "EP-PREDICTION-V2"
+	}
+	fields := []string{
+		version,
+		strconv.FormatUint(uint64(p.ID), 10),
+		strconv.FormatUint(uint64(p.UserID), 10),
+		url.PathEscape(p.HouseID),
+		url.PathEscape(p.MeterID),
+		p.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(p.Hour),
+		strconv.FormatFloat(p.Temperature, 'g', -1, 64),
+		strconv.FormatFloat(p.ConsumptionKwh, 'g', -1, 64),
+		strconv.FormatFloat(p.PredictedPrice, 'g', -1, 64),
+		strconv.FormatFloat(p.ActualPrice, 'g', -1, 64),
+		strconv.Itoa(p.Confidence),
+	}
+	if p.ModelName != "" || p.Seed != 0 || p.Features != nil {
+		fields = append(fields, url.PathEscape(p.ModelName), url.PathEscape(p.ModelVersion))
+	}
+	if p.Seed != 0 || p.Features != nil {
+		fields = append(fields, strconv.FormatInt(p.Seed, 10))
+	}
+	if f := p.Features; f != nil {
+		fields = append(fields,
+			url.PathEscape(f.Region),
+			strconv.Itoa(f.Members),
+			string(f.HeatingType),
+			strconv.FormatFloat(f.AreaSqm, 'g', -1, 64),
+			strconv.Itoa(f.YearBuilt),
+		)
+	}
+	return []byte(strings.Join(fields, "|"))
+}
+
+// initSigner loads the signing key and registers its public key.
+// Any previously active key is retired but kept for verification.
+//
+// Configuration:
+//   - SIGNING_KEY: base64 Ed25519 seed (32 bytes)
+//   - SIGNING_KEY_FILE: file holding the seed when SIGNING_KEY is unset;
+//     generated on first start (default data/signing.key)
+func initSigner() error {
+	seed, err := loadSigningSeed()
+	if err != nil {
+		return err
+	}
+
+	key := ed25519.NewKeyFromSeed(seed)
+	pub := key.Public().(ed25519.PublicKey)
+	keyID := signingKeyID(pub)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&models.SigningKey{}).
+			Where("active = ? AND key_id <> ?", true, keyID).
+			Updates(map[string]interface{}{"active": false, "retired_at": now}).Error
+		if err != nil {
+			return err
+		}
+
+		var existing models.SigningKey
+		result := tx.Limit(1).Find(&existing, "key_id = ?", keyID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return tx.Model(&existing).Updates(map[string]interface{}{"active": true, "retired_at": nil}).Error
+		}
+
+		return tx.Create(&models.SigningKey{
+			KeyID:     keyID,
+			Algorithm: SignatureAlgorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(pub),
+			Active:    true,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register signing key: %w", err)
+	}
+
+	signer.keyID = keyID
+	signer.key = key
+	log.Printf("✓ Prediction signing key %s loaded", keyID)
+	return nil
+}
+
+// loadSigningSeed reads the seed from SIGNING_KEY or the key file,
+// generating a new key file if none exists yet.
+func loadSigningSeed() ([]byte, error) {
+	if encoded := os.Getenv("SIGNING_KEY"); encoded != "" {
+		return decodeSeed(encoded)
+	}
+
+	path := os.Getenv("SIGNING_KEY_FILE")
+	if path == "" {
+		path = defaultSigningKeyFile
+	}
+
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return decodeSeed(strings.TrimSpace(string(content)))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	log.Printf("✓ Generated new signing key in %s", path)
+	return seed, nil
+}
+
+// decodeSeed parses a base64 Ed25519 seed
+func decodeSeed(encoded string) ([]byte, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key encoding: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return seed, nil
+}
+
+// signingKeyID derives a short identifier from a public key
+func signingKeyID(pub ed25519.PublicKey) string {
+	hash := sha256.Sum256(pub)
+	return hex.EncodeToString(hash[:8])
+}
+
+// SignPrediction signs the canonical encoding of a prediction with the
+// active key and sets its Signature and SignatureKeyID fields.
+func SignPrediction(p *models.Prediction) error {
+	if signer.key == nil {
+		return fmt.Errorf("signing key not initialized")
+	}
+	sig := ed25519.Sign(signer.key, CanonicalPrediction(p))
+	p.Signature = base64.StdEncoding.EncodeToString(sig)
+	p.SignatureKeyID = signer.keyID
+	return nil
+}
+
+// VerifyPredictionSignature checks a prediction's signature against the
+// key that made it, including keys that have since been rotated out.
+func VerifyPredictionSignature(p *models.Prediction) error {
+	if p.Signature == "" || p.SignatureKeyID == "" {
+		return fmt.Errorf("prediction %d is not signed", p.ID)
+	}
+
+	var key models.SigningKey
+	if err := database.DB.First(&key, "key_id = ?", p.SignatureKeyID).Error; err != nil {
+		return fmt.Errorf("unknown signing key %s", p.SignatureKeyID)
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key for %s", key.KeyID)
+	}
+	sig, err := base64.StdEncoding.DecodeString(p.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(pub), CanonicalPrediction(p), sig) {
+		return fmt.Errorf("signature does not match prediction %d", p.ID)
+	}
+	return nil
+}
+
+// GetSigningKeys returns all public keys, newest first, and the active key ID
+func GetSigningKeys() ([]models.SigningKey, string, error) {
+	var keys []models.SigningKey
+	if err := database.DB.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, "", err
+	}
+	return keys, signer.keyID, nil
+}
@@ -0,0 +1,81 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// loadChain reads all persisted blocks and their transactions in order.
+// Returns an empty slice if the chain has never been stored.
+func loadChain() ([]Block, error) {
+	var rows []models.ChainBlock
+	if err := database.DB.Order("number ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load blocks: %w", err)
+	}
+
+	var txRows []models.ChainTransaction
+	if err := database.DB.Order("block_number ASC, position ASC").Find(&txRows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load transactions: %w", err)
+	}
+
+	// Group transactions by the block that contains them
+	txByBlock := make(map[uint64][]Transaction)
+	for _, t := range txRows {
+		txByBlock[t.BlockNumber] = append(txByBlock[t.BlockNumber], Transaction{
+			Hash:         t.Hash,
+			PredictionID: t.PredictionID,
+			Data:         t.Data,
+			GasUsed:      t.GasUsed,
+		})
+	}
+
+	blocks := make([]Block, 0, len(rows))
+	for _, r := range rows {
+		blocks = append(blocks, Block{
+			Number:       r.Number,
+			Timestamp:    r.Timestamp,
+			Transactions: txByBlock[r.Number],
+			MerkleRoot:   r.MerkleRoot,
+			PrevHash:     r.PrevHash,
+			Hash:         r.Hash,
+		})
+	}
+
+	return blocks, nil
+}
+
+// saveBlock persists a block and its transactions using the given DB handle,
+// so callers can include it in a larger database transaction.
+func saveBlock(db *gorm.DB, block *Block) error {
+	row := models.ChainBlock{
+		Number:     block.Number,
+		Hash:       block.Hash,
+		PrevHash:   block.PrevHash,
+		MerkleRoot: block.MerkleRoot,
+		Timestamp:  block.Timestamp,
+		TxCount:    len(block.Transactions),
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return fmt.Errorf("failed to save block %d: %w", block.Number, err)
+	}
+
+	for i, tx := range block.Transactions {
+		txRow := models.ChainTransaction{
+			Hash:         tx.Hash,
+			BlockNumber:  block.Number,
+			Position:     i,
+			PredictionID: tx.PredictionID,
+			Data:         tx.Data,
+			GasUsed:      tx.GasUsed,
+		}
+		if err := db.Create(&txRow).Error; err != nil {
+			return fmt.Errorf("failed to save transaction %s: %w", tx.Hash, err)
+		}
+	}
+
+	return nil
+}
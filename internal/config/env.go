@@ -0,0 +1,54 @@
+// Package config reads tuning settings from environment variables.
+// Invalid values are logged and replaced by the default, so a typo in a
+// setting never stops the service from starting.
+package config
+
+import (
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Duration reads a positive duration from the environment, falling back to def
+func Duration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: invalid %s=%q, using %v", key, value, def)
+		return def
+	}
+	return d
+}
+
+// Int reads a positive integer from the environment, falling back to def
+func Int(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: invalid %s=%q, using %d", key, value, def)
+		return def
+	}
+	return n
+}
+
+// Float reads a positive number from the environment, falling back to def
+func Float(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 || math.IsInf(f, 0) {
+		log.Printf("Warning: invalid %s=%q, using %v", key, value, def)
+		return def
+	}
+	return f
+}
@@ -41,7 +41,9 @@ func Connect(dbPath string) error {
 
 	// Open SQLite database
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	// Wait for locks instead of failing, since ingestion workers, the block
+	// producer and HTTP handlers write concurrently
+	DB, err = gorm.Open(sqlite.Open(dbPath+"?_busy_timeout=5000"), &gorm.Config{
 		Logger: newLogger,
 	})
 	if err != nil {
@@ -72,8 +74,19 @@ func AutoMigrate() error {
 		&models.User{},
 		&models.Session{},
 		&models.Household{},
+		&models.MeterReading{},
+		&models.DeadLetter{},
+		&models.ReadingGap{},
+		&models.MeterStatus{},
+		&models.MeterCredential{},
+		&models.MeterNonce{},
 		&models.Prediction{},
 		&models.BlockchainLog{},
+		&models.ChainBlock{},
+		&models.ChainTransaction{},
+		&models.SigningKey{},
+		&models.BlockchainOutbox{},
+		&models.BacktestRun{},
 	)
 	if err != nil {
 		return fmt.Errorf("migration failed: %w", err)
@@ -0,0 +1,242 @@
+// Package dsmr parses DSMR P1 telegrams from Dutch and Belgian smart meters.
+// A telegram is a block of OBIS-coded lines between a "/" header and a "!"
+// footer carrying a CRC16 of the telegram:
+//
+//	/ISK5\2M550T-1012
+//
+//	1-3:0.2.8(50)
+//	0-0:1.0.0(250110091500W)
+//	1-0:1.8.1(001581.123*kWh)
+//	1-0:1.8.2(001123.456*kWh)
+//	1-0:1.7.0(00.452*kW)
+//	0-1:24.2.1(250110091000W)(01234.567*m3)
+//	!F751
+//
+// Only DSMR 4 and later telegrams, which carry the CRC, are accepted.
+package dsmr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OBIS codes read from a telegram
+const (
+	obisVersion     = "1-3:0.2.8"
+	obisTimestamp   = "0-0:1.0.0"
+	obisEquipmentID = "0-0:96.1.1"
+	obisTariff      = "0-0:96.14.0"
+	obisImportT1    = "1-0:1.8.1"
+	obisImportT2    = "1-0:1.8.2"
+	obisExportT1    = "1-0:2.8.1"
+	obisExportT2    = "1-0:2.8.2"
+	obisPowerImport = "1-0:1.7.0"
+	obisPowerExport = "1-0:2.7.0"
+)
+
+// gasObject matches the gas register of any M-Bus channel: 24.2.1 in DSMR
+// 4/5, 24.2.3 on Belgian e-MUCS meters
+var gasObject = regexp.MustCompile(`^0-[1-4]:24\.2\.[13]$`)
+
+// valueGroup matches the parenthesised values of a line
+var valueGroup = regexp.MustCompile(`\(([^()]*)\)`)
+
+// Telegram is a parsed P1 telegram. Registers are cumulative. Tariffs are
+// numbered as on the meter: Dutch meters count the low tariff as 1, Belgian
+// meters the day tariff.
+type Telegram struct {
+	Header        string      `json:"header"`            // manufacturer identification
+	Version       string      `json:"version,omitempty"` // P1 version, e.g. "50" for DSMR 5.0
+	Timestamp     time.Time   `json:"timestamp"`         // zero if the meter sent none
+	EquipmentID   string      `json:"equipmentId,omitempty"`
+	Tariff        int         `json:"tariff,omitempty"` // active tariff
+	ImportT1Kwh   float64     `json:"importT1Kwh"`
+	ImportT2Kwh   float64     `json:"importT2Kwh"`
+	ExportT1Kwh   float64     `json:"exportT1Kwh"`
+	ExportT2Kwh   float64     `json:"exportT2Kwh"`
+	PowerImportKw float64     `json:"powerImportKw"` // current power drawn from the grid
+	PowerExportKw float64     `json:"powerExportKw"` // current power fed back
+	Gas           *GasReading `json:"gas,omitempty"`
+}
+
+// GasReading is the last gas register value relayed by the meter
+type GasReading struct {
+	Timestamp time.Time `json:"timestamp"`
+	M3        float64   `json:"m3"`
+}
+
+// ImportKwh returns the total imported energy over both tariffs
+func (t *Telegram) ImportKwh() float64 {
+	return t.ImportT1Kwh + t.ImportT2Kwh
+}
+
+// ExportKwh returns the total exported energy over both tariffs
+func (t *Telegram) ExportKwh() float64 {
+	return t.ExportT1Kwh + t.ExportT2Kwh
+}
+
+// Parse validates the CRC of a telegram and extracts its registers. Text
+// before the "/" header and after the CRC is ignored. A telegram must at
+// least carry the tariff 1 and 2 import registers.
+func Parse(data []byte) (*Telegram, error) {
+	start := bytes.IndexByte(data, '/')
+	if start < 0 {
+		return nil, errors.New("no telegram header (/)")
+	}
+	end := bytes.IndexByte(data[start:], '!')
+	if end < 0 {
+		return nil, errors.New("no telegram footer (!)")
+	}
+	end += start
+
+	footer := strings.TrimSpace(string(data[end+1:]))
+	if len(footer) < 4 {
+		return nil, errors.New("missing CRC after footer, DSMR 4 or later is required")
+	}
+	expected, err := strconv.ParseUint(footer[:4], 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRC %q", footer[:4])
+	}
+	if crc := CRC16(data[start : end+1]); crc != uint16(expected) {
+		return nil, fmt.Errorf("CRC mismatch: telegram has %04X, computed %04X", expected, crc)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(data[start:end]), "\r\n", "\n"), "\n")
+	t := &Telegram{Header: strings.TrimSpace(strings.TrimPrefix(lines[0], "/"))}
+	var hasT1, hasT2 bool
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		open := strings.IndexByte(line, '(')
+		if open <= 0 {
+			continue
+		}
+		obis := line[:open]
+		var values []string
+		for _, m := range valueGroup.FindAllStringSubmatch(line[open:], -1) {
+			values = append(values, m[1])
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		var err error
+		switch {
+		case obis == obisVersion:
+			t.Version = values[0]
+		case obis == obisTimestamp:
+			t.Timestamp, err = parseTimestamp(values[0])
+		case obis == obisEquipmentID:
+			t.EquipmentID = decodeEquipmentID(values[0])
+		case obis == obisTariff:
+			t.Tariff, err = strconv.Atoi(values[0])
+		case obis == obisImportT1:
+			t.ImportT1Kwh, err = parseValue(values[0], "kWh")
+			hasT1 = true
+		case obis == obisImportT2:
+			t.ImportT2Kwh, err = parseValue(values[0], "kWh")
+			hasT2 = true
+		case obis == obisExportT1:
+			t.ExportT1Kwh, err = parseValue(values[0], "kWh")
+		case obis == obisExportT2:
+			t.ExportT2Kwh, err = parseValue(values[0], "kWh")
+		case obis == obisPowerImport:
+			t.PowerImportKw, err = parseValue(values[0], "kW")
+		case obis == obisPowerExport:
+			t.PowerExportKw, err = parseValue(values[0], "kW")
+		case gasObject.MatchString(obis) && t.Gas == nil:
+			t.Gas, err = parseGas(values)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", obis, err)
+		}
+	}
+
+	if !hasT1 || !hasT2 {
+		return nil, fmt.Errorf("telegram has no import registers (%s, %s)", obisImportT1, obisImportT2)
+	}
+	return t, nil
+}
+
+// CRC16 computes the telegram checksum (CRC-16/ARC: polynomial 0x8005,
+// reflected, initial value 0) over the bytes from "/" up to and including "!"
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// parseValue parses a "value*unit" group, checking the unit
+func parseValue(group, unit string) (float64, error) {
+	number, got, found := strings.Cut(group, "*")
+	if !found || got != unit {
+		return 0, fmt.Errorf("expected a value in %s, got %q", unit, group)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", number)
+	}
+	return value, nil
+}
+
+// parseGas parses the "(timestamp)(value*m3)" groups of a gas register
+func parseGas(values []string) (*GasReading, error) {
+	if len(values) != 2 {
+		return nil, fmt.Errorf("expected (timestamp)(value*m3), got %d values", len(values))
+	}
+	at, err := parseTimestamp(values[0])
+	if err != nil {
+		return nil, err
+	}
+	m3, err := parseValue(values[1], "m3")
+	if err != nil {
+		return nil, err
+	}
+	return &GasReading{Timestamp: at, M3: m3}, nil
+}
+
+// parseTimestamp parses a YYMMDDhhmmssX timestamp in Dutch/Belgian local
+// time, X being S for summer (UTC+2) or W for winter time (UTC+1)
+func parseTimestamp(value string) (time.Time, error) {
+	if len(value) != 13 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+	offset := 1
+	switch value[12] {
+	case 'S':
+		offset = 2
+	case 'W':
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: expected S or W suffix", value)
+	}
+	zone := time.FixedZone(fmt.Sprintf("UTC+%d", offset), offset*3600)
+	t, err := time.ParseInLocation("060102150405", value[:12], zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+	return t, nil
+}
+
+// decodeEquipmentID decodes the hex-encoded ASCII equipment identifier,
+// keeping it as sent if it is not hex
+func decodeEquipmentID(value string) string {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"energy-prediction/internal/blockchain"
 	"energy-prediction/internal/database"
 	"energy-prediction/internal/models"
 	"energy-prediction/internal/mqtt"
@@ -115,12 +116,47 @@ func AdminDashboard(c *gin.Context) {
 		response.ServiceStatus["mqtt"] = "error"
 	}
 
+	// Meter liveness of active houses; any offline meter degrades the status
+	response.MeterStates = map[models.MeterState]int64{
+		models.MeterOnline:  0,
+		models.MeterStale:   0,
+		models.MeterOffline: 0,
+	}
+	var meterCounts []struct {
+		State models.MeterState
+		Count int64
+	}
+	database.DB.Table("households AS h").
+		Select("COALESCE(s.state, ?) AS state, COUNT(*) AS count", models.MeterOffline).
+		Joins("LEFT JOIN meter_status AS s ON s.meter_id = h.meter_id").
+		Where("h.status = ?", models.StatusActive).
+		Group("s.state").
+		Scan(&meterCounts)
+	for _, mc := range meterCounts {
+		response.MeterStates[mc.State] += mc.Count
+	}
+	database.DB.Where("state = ? AND house_id IN (?)", models.MeterOffline,
+		database.DB.Model(&models.Household{}).Select("id").Where("status = ?", models.StatusActive)).
+		Order("state_changed_at DESC").Limit(20).Find(&response.OfflineMeters)
+	response.ServiceStatus["meters"] = "healthy"
+	if response.MeterStates[models.MeterOffline] > 0 {
+		response.ServiceStatus["meters"] = "degraded"
+	}
+
 	// Extended Analytics
 	// Average accuracy from predictions
 	var avgAccuracy float64
 	database.DB.Model(&models.Prediction{}).Select("COALESCE(AVG(100 - ABS(predicted_price - actual_price) / NULLIF(actual_price, 0.001) * 100), 0)").Scan(&avgAccuracy)
 	response.AverageAccuracy = avgAccuracy
 
+	// Accuracy per model version, to compare models side by side
+	response.ModelAccuracy = []models.ModelAccuracy{}
+	database.DB.Model(&models.Prediction{}).
+		Select("model_name, model_version, COUNT(*) AS predictions, COALESCE(AVG(100 - ABS(predicted_price - actual_price) / NULLIF(actual_price, 0.001) * 100), 0) AS average_accuracy").
+		Group("model_name, model_version").
+		Order("model_name, model_version").
+		Scan(&response.ModelAccuracy)
+
 	// Total energy consumed
 	var totalEnergy float64
 	database.DB.Model(&models.Prediction{}).Select("COALESCE(SUM(consumption_kwh), 0)").Scan(&totalEnergy)
@@ -151,5 +187,63 @@ func AdminDashboard(c *gin.Context) {
 	// Pending blockchain confirmations
 	database.DB.Model(&models.Prediction{}).Where("blockchain_confirmed = ?", false).Count(&response.PendingBlockchain)
 
+	// Predictions whose blockchain logging gave up and needs a re-drive
+	database.DB.Model(&models.BlockchainOutbox{}).Where("status = ?", "failed").Count(&response.FailedBlockchain)
+
 	c.JSON(http.StatusOK, response)
 }
+
+// AdminGetBlockchainOutbox lists predictions waiting to be logged to the
+// blockchain, with their attempt count and last error (admin only).
+// GET /admin/blockchain/outbox?status=failed&limit=50
+func AdminGetBlockchainOutbox(c *gin.Context) {
+	var query struct {
+		Status string `form:"status" binding:"omitempty,oneof=pending failed"`
+		Limit  int    `form:"limit,default=50"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit < 1 || query.Limit > 500 {
+		query.Limit = 50
+	}
+
+	entries, total, err := blockchain.ListOutbox(query.Status, query.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blockchain outbox"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"total": total,
+	})
+}
+
+// AdminRedriveBlockchainOutbox retries outbox entries right away with a
+// fresh attempt budget. Without IDs, all failed entries are re-driven (admin only).
+// POST /admin/blockchain/outbox/redrive
+func AdminRedriveBlockchainOutbox(c *gin.Context) {
+	var req struct {
+		IDs []uint `json:"ids"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	count, err := blockchain.Redrive(req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to re-drive blockchain outbox"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Outbox entries scheduled for retry",
+		"redriven": count,
+	})
+}
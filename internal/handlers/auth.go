@@ -14,6 +14,7 @@ import (
 	"energy-prediction/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // meterCounter tracks the next available meter ID (thread-safe)
@@ -42,15 +43,21 @@ func initMeterCounter() {
 	meterCounter = maxNum
 }
 
-// getNextMeterID returns the next available meter ID (thread-safe)
-func getNextMeterID() string {
+// getNextMeterID returns the next available meter ID (thread-safe) and
+// provisions its secret in tx. The secret is returned so it can be shown once.
+func getNextMeterID(tx *gorm.DB) (string, string, error) {
 	meterCounterOnce.Do(initMeterCounter)
 
 	meterMutex.Lock()
-	defer meterMutex.Unlock()
-
 	meterCounter++
-	return fmt.Sprintf("household_%d", meterCounter)
+	meterID := fmt.Sprintf("household_%d", meterCounter)
+	meterMutex.Unlock()
+
+	_, secret, err := auth.ProvisionMeter(tx, meterID)
+	if err != nil {
+		return "", "", err
+	}
+	return meterID, secret, nil
 }
 
 // getNextHouseID returns the next available house ID
@@ -111,7 +118,14 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Create initial house
+	// Create initial house with a provisioned meter
+	meterID, meterSecret, err := getNextMeterID(tx)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Failed to provision meter: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision meter"})
+		return
+	}
 	house := models.Household{
 		ID:          getNextHouseID(),
 		UserID:      user.ID,
@@ -124,7 +138,7 @@ func Register(c *gin.Context) {
 		HeatingType: models.HeatingType(req.HeatingType),
 		AreaSqm:     req.AreaSqm,
 		YearBuilt:   req.YearBuilt,
-		MeterID:     getNextMeterID(),
+		MeterID:     meterID,
 		Status:      models.StatusActive,
 	}
 
@@ -160,9 +174,11 @@ func Register(c *gin.Context) {
 
 	// Return response
 	c.JSON(http.StatusCreated, models.LoginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User:      user,
+		Token:       token,
+		ExpiresAt:   expiresAt,
+		User:        user,
+		MeterID:     meterID,
+		MeterSecret: meterSecret,
 	})
 }
 
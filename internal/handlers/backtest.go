@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/ml"
+	"energy-prediction/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRunBacktest replays a historical window of predictions through one or
+// more models and stores the errors per model. Without models, every
+// registered model is backtested; without a window, all history. Only
+// predictions from the cutoff, or the newest training cutoff of the models,
+// on are replayed (admin only).
+// POST /admin/backtests
+func AdminRunBacktest(c *gin.Context) {
+	var req struct {
+		Models []string `json:"models"`
+		From   string   `json:"from"` // RFC 3339 timestamp or date (YYYY-MM-DD)
+		To     string   `json:"to"`   // a date includes the whole day
+		Cutoff string   `json:"cutoff"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var from, to time.Time
+	if req.From != "" {
+		t, _, err := parseTimeParam(req.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+			return
+		}
+		from = t
+	}
+	if req.To != "" {
+		t, isDate, err := parseTimeParam(req.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+			return
+		}
+		if isDate {
+			t = t.Add(24 * time.Hour) // Include the entire end date
+		}
+		to = t
+	}
+
+	var cutoff time.Time
+	if req.Cutoff != "" {
+		t, _, err := parseTimeParam(req.Cutoff)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cutoff: " + err.Error()})
+			return
+		}
+		cutoff = t
+	}
+
+	runs, err := ml.RunBacktest(req.Models, from, to, cutoff)
+	switch {
+	case errors.Is(err, ml.ErrUnknownModel), errors.Is(err, ml.ErrNoSamples):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run backtest"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"runId": runs[0].RunID,
+		"data":  runs,
+	})
+}
+
+// AdminGetBacktests lists stored backtest results, newest first, to compare
+// model versions over time (admin only).
+// GET /admin/backtests?model=ridge&runId=3f9a0c12d4e5b6a7&limit=50
+func AdminGetBacktests(c *gin.Context) {
+	var query struct {
+		Model string `form:"model"` // model name, or ID (name-version)
+		RunID string `form:"runId"`
+		Limit int    `form:"limit,default=50"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit < 1 || query.Limit > 500 {
+		query.Limit = 50
+	}
+
+	dbQuery := database.DB.Model(&models.BacktestRun{})
+	if query.Model != "" {
+		dbQuery = dbQuery.Where("model_name = ? OR model_name || '-' || model_version = ?", query.Model, query.Model)
+	}
+	if query.RunID != "" {
+		dbQuery = dbQuery.Where("run_id = ?", query.RunID)
+	}
+
+	var total int64
+	dbQuery.Count(&total)
+
+	var runs []models.BacktestRun
+	if err := dbQuery.Order("created_at DESC, id ASC").Limit(query.Limit).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backtests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  runs,
+		"total": total,
+	})
+}
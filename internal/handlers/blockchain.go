@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"energy-prediction/internal/auth"
 	"energy-prediction/internal/blockchain"
 	"energy-prediction/internal/database"
+	"energy-prediction/internal/ml"
 	"energy-prediction/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -19,6 +22,7 @@ type BlockchainLogResponse struct {
 	BlockNumber     uint64  `json:"blockNumber"`
 	GasUsed         uint64  `json:"gasUsed"`
 	Status          string  `json:"status"`
+	Error           string  `json:"error,omitempty"`
 	ContractAddress string  `json:"contractAddress"`
 	LoggedAt        string  `json:"loggedAt"`
 	ConfirmedAt     *string `json:"confirmedAt"`
@@ -65,6 +69,7 @@ func GetUserBlockchainLogs(c *gin.Context) {
 			BlockNumber:     log.BlockNumber,
 			GasUsed:         log.GasUsed,
 			Status:          log.Status,
+			Error:           log.Error,
 			ContractAddress: log.ContractAddress,
 			LoggedAt:        log.LoggedAt.Format("2006-01-02T15:04:05Z"),
 			ConfirmedAt:     confirmedAt,
@@ -145,10 +150,22 @@ func VerifyTransaction(c *gin.Context) {
 		return
 	}
 
-	// Get the associated prediction
+	// Get the associated prediction and check its attestation
 	var prediction models.Prediction
 	database.DB.First(&prediction, log.PredictionID)
 
+	signatureValid := blockchain.VerifyPredictionSignature(&prediction) == nil
+
+	// Recompute the price from the recorded model, inputs, household features and seed
+	recomputation := gin.H{"reproduced": false}
+	if result, err := ml.Reproduce(&prediction); err != nil {
+		recomputation["error"] = err.Error()
+	} else {
+		recomputation["reproduced"] = result.Price == prediction.PredictedPrice && result.Confidence == prediction.Confidence
+		recomputation["predictedPrice"] = result.Price
+		recomputation["confidence"] = result.Confidence
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"verified":        valid,
 		"transactionHash": log.TransactionHash,
@@ -158,6 +175,12 @@ func VerifyTransaction(c *gin.Context) {
 		"contractAddress": log.ContractAddress,
 		"loggedAt":        log.LoggedAt.Format("2006-01-02T15:04:05Z"),
 		"confirmedAt":     log.ConfirmedAt,
+		"signature": gin.H{
+			"valid":     signatureValid,
+			"algorithm": blockchain.SignatureAlgorithm,
+			"keyId":     prediction.SignatureKeyID,
+			"value":     prediction.Signature,
+		},
 		"prediction": gin.H{
 			"id":             prediction.ID,
 			"meterId":        prediction.MeterID,
@@ -165,40 +188,152 @@ func VerifyTransaction(c *gin.Context) {
 			"actualPrice":    prediction.ActualPrice,
 			"confidence":     prediction.Confidence,
 			"timestamp":      prediction.Timestamp.Format("2006-01-02T15:04:05Z"),
+			"modelName":      prediction.ModelName,
+			"modelVersion":   prediction.ModelVersion,
+			"seed":           strconv.FormatInt(prediction.Seed, 10),
 		},
+		"recomputation": recomputation,
 	})
 }
 
-// GetBlockByNumber retrieves block information by block number.
+// GetBlockByNumber retrieves a sealed block and its transactions by block number.
 // GET /api/blockchain/block/:number
 func GetBlockByNumber(c *gin.Context) {
-	blockNum := c.Param("number")
-
-	var logs []models.BlockchainLog
-	database.DB.Where("block_number = ?", blockNum).Preload("Prediction").Find(&logs)
+	blockNum, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid block number"})
+		return
+	}
 
-	if len(logs) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Block not found or empty"})
+	block, err := blockchain.GetBlock(blockNum)
+	if errors.Is(err, blockchain.ErrNotSupported) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Block lookup is only available on the simulated blockchain"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Block not found"})
 		return
 	}
 
+	// Load log rows for the block's transactions to add prediction context
+	hashes := make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		hashes[i] = tx.Hash
+	}
+	var logs []models.BlockchainLog
+	if len(hashes) > 0 {
+		database.DB.Where("transaction_hash IN ?", hashes).Preload("Prediction").Find(&logs)
+	}
+	logByHash := make(map[string]models.BlockchainLog, len(logs))
+	for _, l := range logs {
+		logByHash[l.TransactionHash] = l
+	}
+
 	// Build block info
-	transactions := make([]gin.H, len(logs))
-	for i, log := range logs {
+	var totalGas uint64
+	transactions := make([]gin.H, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		l := logByHash[tx.Hash]
+		totalGas += tx.GasUsed
 		transactions[i] = gin.H{
-			"hash":           log.TransactionHash,
-			"predictionId":   log.PredictionID,
-			"gasUsed":        log.GasUsed,
-			"status":         log.Status,
-			"meterId":        log.Prediction.MeterID,
-			"predictedPrice": log.Prediction.PredictedPrice,
+			"hash":           tx.Hash,
+			"predictionId":   tx.PredictionID,
+			"gasUsed":        tx.GasUsed,
+			"data":           tx.Data,
+			"status":         l.Status,
+			"meterId":        l.Prediction.MeterID,
+			"predictedPrice": l.Prediction.PredictedPrice,
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"blockNumber":  blockNum,
-		"timestamp":    logs[0].LoggedAt.Format("2006-01-02T15:04:05Z"),
+		"blockNumber":  block.Number,
+		"hash":         block.Hash,
+		"prevHash":     block.PrevHash,
+		"merkleRoot":   block.MerkleRoot,
+		"timestamp":    block.Timestamp.Format("2006-01-02T15:04:05Z"),
 		"transactions": transactions,
-		"txCount":      len(logs),
+		"txCount":      len(block.Transactions),
+		"gasUsed":      totalGas,
+	})
+}
+
+// GetChainIntegrity walks the whole chain and reports the first broken link
+// or tampered prediction.
+// GET /api/blockchain/integrity
+func GetChainIntegrity(c *gin.Context) {
+	report, err := blockchain.CheckIntegrity()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify chain integrity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetInclusionProof returns a self-contained Merkle inclusion proof for a
+// transaction, linked by prev-hash to an anchor block (default: chain head).
+// GET /api/blockchain/proof/:tx_hash?anchor=<blockNumber>
+func GetInclusionProof(c *gin.Context) {
+	txHash := c.Param("tx_hash")
+
+	var anchor uint64
+	if a := c.Query("anchor"); a != "" {
+		parsed, err := strconv.ParseUint(a, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid anchor block number"})
+			return
+		}
+		anchor = parsed
+	}
+
+	_, log, err := blockchain.VerifyTransaction(txHash)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found in blockchain"})
+		return
+	}
+	if log.Status != "confirmed" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Transaction is not sealed into a block yet",
+			"status": log.Status,
+		})
+		return
+	}
+	if _, err := blockchain.GetTransaction(txHash); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found on chain"})
+		return
+	}
+
+	proof, err := blockchain.GetInclusionProof(txHash, anchor)
+	if errors.Is(err, blockchain.ErrNotSupported) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Inclusion proofs are only available on the simulated blockchain"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
+
+// GetSigningKeys publishes the public keys used to sign predictions.
+// Retired keys are included so older signatures can still be verified.
+// GET /api/blockchain/pubkey
+func GetSigningKeys(c *gin.Context) {
+	keys, activeKeyID, err := blockchain.GetSigningKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch signing keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":   blockchain.SignatureAlgorithm,
+		"activeKeyId": activeKeyID,
+		"keys":        keys,
+		"encoding":    "EP-PREDICTION-V1|id|userId|houseId|meterId|timestamp|hour|temperature|consumptionKwh|predictedPrice|actualPrice|confidence",
+		"encodingV2":  "EP-PREDICTION-V2|id|userId|houseId|meterId|timestamp|hour|temperature|consumptionKwh|predictedPrice|actualPrice|confidence|modelName|modelVersion",
+		"encodingV3":  "EP-PREDICTION-V3|id|userId|houseId|meterId|timestamp|hour|temperature|consumptionKwh|predictedPrice|actualPrice|confidence|modelName|modelVersion|seed",
+		"encodingV4":  "EP-PREDICTION-V4|id|userId|houseId|meterId|timestamp|hour|temperature|consumptionKwh|predictedPrice|actualPrice|confidence|modelName|modelVersion|seed|region|members|heatingType|areaSqm|yearBuilt",
 	})
 }
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+	"energy-prediction/internal/mqtt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// deadLetterFilter selects dead letters by reason, meter and age
+type deadLetterFilter struct {
+	Reason  string `form:"reason"`
+	MeterID string `form:"meterId"`
+	Before  string `form:"before"` // RFC 3339 timestamp or date (YYYY-MM-DD)
+}
+
+// apply adds the filter conditions to a query
+func (f *deadLetterFilter) apply(query *gorm.DB) (*gorm.DB, error) {
+	if f.Reason != "" {
+		query = query.Where("reason = ?", f.Reason)
+	}
+	if f.MeterID != "" {
+		query = query.Where("meter_id = ?", f.MeterID)
+	}
+	if f.Before != "" {
+		before, _, err := parseTimeParam(f.Before)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ?", before)
+	}
+	return query, nil
+}
+
+// AdminGetDeadLetters lists rejected meter messages, newest first (admin only).
+// GET /admin/dead-letters?reason=unknown_meter&meterId=household_7
+func AdminGetDeadLetters(c *gin.Context) {
+	var params struct {
+		deadLetterFilter
+		Page  int `form:"page,default=1"`
+		Limit int `form:"limit,default=50"`
+	}
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.Limit < 1 || params.Limit > 500 {
+		params.Limit = 50
+	}
+
+	query, err := params.apply(database.DB.Model(&models.DeadLetter{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before: " + err.Error()})
+		return
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var letters []models.DeadLetter
+	offset := (params.Page - 1) * params.Limit
+	if err := query.Order("id DESC").Offset(offset).Limit(params.Limit).Find(&letters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dead letters"})
+		return
+	}
+
+	// Counts per reason help spotting misconfigured meters
+	var byReason []struct {
+		Reason string `json:"reason"`
+		Count  int64  `json:"count"`
+	}
+	database.DB.Model(&models.DeadLetter{}).Select("reason, COUNT(*) as count").Group("reason").Scan(&byReason)
+
+	c.JSON(http.StatusOK, gin.H{
+		"deadLetters": letters,
+		"total":       total,
+		"page":        params.Page,
+		"limit":       params.Limit,
+		"byReason":    byReason,
+	})
+}
+
+// AdminReprocessDeadLetters runs dead letters through ingestion again, e.g.
+// after a meter has been assigned to a house. Letters are selected by ID or
+// by meter; successfully processed letters are removed (admin only).
+// POST /admin/dead-letters/reprocess
+func AdminReprocessDeadLetters(c *gin.Context) {
+	var req struct {
+		IDs     []uint `json:"ids"`
+		MeterID string `json:"meterId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 && req.MeterID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide ids or meterId"})
+		return
+	}
+
+	query := database.DB.Order("id ASC").Limit(500)
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if req.MeterID != "" {
+		query = query.Where("meter_id = ?", req.MeterID)
+	}
+
+	var letters []models.DeadLetter
+	if err := query.Find(&letters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dead letters"})
+		return
+	}
+
+	type failure struct {
+		ID    uint   `json:"id"`
+		Error string `json:"error"`
+	}
+	failed := make([]failure, 0)
+	for i := range letters {
+		if err := mqtt.ReprocessDeadLetter(&letters[i]); err != nil {
+			failed = append(failed, failure{ID: letters[i].ID, Error: err.Error()})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reprocessed": len(letters) - len(failed),
+		"failed":      failed,
+	})
+}
+
+// AdminPurgeDeadLetters deletes dead letters matching the filter. Without a
+// filter, all=true is required to empty the table (admin only).
+// DELETE /admin/dead-letters?reason=invalid_payload&before=2026-01-01
+func AdminPurgeDeadLetters(c *gin.Context) {
+	var params struct {
+		deadLetterFilter
+		All bool `form:"all"`
+	}
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if params.deadLetterFilter == (deadLetterFilter{}) && !params.All {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide a filter or all=true"})
+		return
+	}
+
+	query, err := params.apply(database.DB.Session(&gorm.Session{AllowGlobalUpdate: true}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before: " + err.Error()})
+		return
+	}
+
+	result := query.Delete(&models.DeadLetter{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Dead letters purged",
+		"purged":  result.RowsAffected,
+	})
+}
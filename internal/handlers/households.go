@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"energy-prediction/internal/auth"
 	"energy-prediction/internal/database"
 	"energy-prediction/internal/ml"
 	"energy-prediction/internal/models"
+	"energy-prediction/internal/mqtt"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // CreateHouse creates a new household for the current user.
@@ -22,28 +26,40 @@ func CreateHouse(c *gin.Context) {
 		return
 	}
 
-	house := models.Household{
-		ID:          getNextHouseID(),
-		UserID:      userID,
-		HouseName:   req.HouseName,
-		Address:     req.Address,
-		City:        req.City,
-		Region:      req.Region,
-		Country:     req.Country,
-		Members:     req.Members,
-		HeatingType: req.HeatingType,
-		AreaSqm:     req.AreaSqm,
-		YearBuilt:   req.YearBuilt,
-		MeterID:     getNextMeterID(),
-		Status:      models.StatusActive,
-	}
-
-	if err := database.DB.Create(&house).Error; err != nil {
+	var house models.Household
+	var meterSecret string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		meterID, secret, err := getNextMeterID(tx)
+		if err != nil {
+			return err
+		}
+		meterSecret = secret
+
+		house = models.Household{
+			ID:          getNextHouseID(),
+			UserID:      userID,
+			HouseName:   req.HouseName,
+			Address:     req.Address,
+			City:        req.City,
+			Region:      req.Region,
+			Country:     req.Country,
+			Members:     req.Members,
+			HeatingType: req.HeatingType,
+			AreaSqm:     req.AreaSqm,
+			YearBuilt:   req.YearBuilt,
+			MeterID:     meterID,
+			Status:      models.StatusActive,
+		}
+		return tx.Create(&house).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create house"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, house.ToResponse())
+	response := house.ToResponse()
+	response.MeterSecret = meterSecret
+	c.JSON(http.StatusCreated, response)
 }
 
 // GetHouses returns all houses for the current user (or all houses for admin).
@@ -70,6 +86,7 @@ func GetHouses(c *gin.Context) {
 	for i, h := range houses {
 		responses[i] = h.ToResponse()
 	}
+	addMeterStatus(responses)
 
 	c.JSON(http.StatusOK, responses)
 }
@@ -94,7 +111,35 @@ func GetHouse(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, house.ToResponse())
+	responses := []models.HouseholdResponse{house.ToResponse()}
+	addMeterStatus(responses)
+	c.JSON(http.StatusOK, responses[0])
+}
+
+// addMeterStatus fills in the liveness of each house's meter.
+// Meters that never reported are offline.
+func addMeterStatus(responses []models.HouseholdResponse) {
+	meterIDs := make([]string, len(responses))
+	for i := range responses {
+		meterIDs[i] = responses[i].MeterID
+	}
+
+	var statuses []models.MeterStatus
+	database.DB.Where("meter_id IN ?", meterIDs).Find(&statuses)
+	byMeter := make(map[string]*models.MeterStatus, len(statuses))
+	for i := range statuses {
+		byMeter[statuses[i].MeterID] = &statuses[i]
+	}
+
+	for i := range responses {
+		status, ok := byMeter[responses[i].MeterID]
+		if !ok {
+			responses[i].MeterState = models.MeterOffline
+			continue
+		}
+		responses[i].MeterState = status.State
+		responses[i].MeterLastSeenAt = &status.LastSeenAt
+	}
 }
 
 // UpdateHouse modifies an existing house.
@@ -210,3 +255,181 @@ func GetForecast(c *gin.Context) {
 	forecast := ml.Get24HourForecast(&house, 15.0)
 	c.JSON(http.StatusOK, forecast)
 }
+
+// GetHouseReadings returns the raw meter readings of a house, newest first.
+// GET /api/houses/:house_id/readings?from=2026-01-01&to=2026-01-31T12:00:00Z
+func GetHouseReadings(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	isAdmin := auth.IsAdmin(c)
+	houseID := c.Param("house_id")
+
+	var house models.Household
+	query := database.DB.Where("id = ?", houseID)
+	if !isAdmin {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&house).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "House not found"})
+		return
+	}
+
+	var params models.ReadingQuery
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.Limit < 1 || params.Limit > 1000 {
+		params.Limit = 100
+	}
+
+	dbQuery := database.DB.Model(&models.MeterReading{}).Where("house_id = ?", house.ID)
+	if params.From != "" {
+		from, _, err := parseTimeParam(params.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+			return
+		}
+		dbQuery = dbQuery.Where("timestamp >= ?", from)
+	}
+	if params.To != "" {
+		to, isDate, err := parseTimeParam(params.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+			return
+		}
+		if isDate {
+			to = to.Add(24 * time.Hour) // Include the entire end date
+		}
+		dbQuery = dbQuery.Where("timestamp < ?", to)
+	}
+
+	var total int64
+	dbQuery.Count(&total)
+
+	var readings []models.MeterReading
+	offset := (params.Page - 1) * params.Limit
+	if err := dbQuery.Order("timestamp DESC").Offset(offset).Limit(params.Limit).Find(&readings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch readings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"readings":   readings,
+		"total":      total,
+		"page":       params.Page,
+		"limit":      params.Limit,
+		"totalPages": (total + int64(params.Limit) - 1) / int64(params.Limit),
+	})
+}
+
+// GetHouseDataQuality summarizes the reading stream of a house over a period
+// (default: the last 7 days): flagged readings, detected gaps and the share
+// of expected readings that arrived.
+// GET /api/houses/:house_id/data-quality?from=2026-01-01&to=2026-01-07
+func GetHouseDataQuality(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	isAdmin := auth.IsAdmin(c)
+	houseID := c.Param("house_id")
+
+	var house models.Household
+	query := database.DB.Where("id = ?", houseID)
+	if !isAdmin {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&house).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "House not found"})
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		t, _, err := parseTimeParam(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+			return
+		}
+		from = t
+	}
+	if value := c.Query("to"); value != "" {
+		t, isDate, err := parseTimeParam(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+			return
+		}
+		if isDate {
+			t = t.Add(24 * time.Hour) // Include the entire end date
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	readingQuery := database.DB.Model(&models.MeterReading{}).
+		Where("house_id = ? AND timestamp >= ? AND timestamp < ?", house.ID, from, to)
+
+	var total int64
+	if err := readingQuery.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count readings"})
+		return
+	}
+
+	flagged := make(map[string]int64)
+	for _, flag := range []string{models.FlagLate, models.FlagEstimatedTime, models.FlagFuture, models.FlagBaseline,
+		models.FlagRollover, models.FlagRegisterReset, models.FlagNegativeDelta, models.FlagImplausible, models.FlagLateRegister} {
+		var count int64
+		database.DB.Model(&models.MeterReading{}).
+			Where("house_id = ? AND timestamp >= ? AND timestamp < ?", house.ID, from, to).
+			Where("',' || flags || ',' LIKE ?", "%,"+flag+",%").
+			Count(&count)
+		flagged[flag] = count
+	}
+
+	var gaps []models.ReadingGap
+	if err := database.DB.Where("house_id = ? AND gap_start < ? AND gap_end > ?", house.ID, to, from).
+		Order("gap_start ASC").Find(&gaps).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gaps"})
+		return
+	}
+	missing := 0
+	for _, gap := range gaps {
+		missing += gap.MissingReadings
+	}
+
+	// Share of expected readings (received + missing) that arrived
+	completeness := 100.0
+	if expected := total + int64(missing); expected > 0 {
+		completeness = float64(total) / float64(expected) * 100
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"houseId":          house.ID,
+		"meterId":          house.MeterID,
+		"from":             from,
+		"to":               to,
+		"expectedInterval": mqtt.ExpectedReadingInterval().String(),
+		"readings":         total,
+		"flagged":          flagged,
+		"gaps":             gaps,
+		"missingReadings":  missing,
+		"completeness":     completeness,
+	})
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a plain date (YYYY-MM-DD).
+// isDate reports whether a plain date was given.
+func parseTimeParam(value string) (t time.Time, isDate bool, err error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected RFC 3339 timestamp or YYYY-MM-DD")
+	}
+	return t, false, nil
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"energy-prediction/internal/auth"
+	"energy-prediction/internal/dsmr"
+	"energy-prediction/internal/models"
+	"energy-prediction/internal/mqtt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubmitMeterData queues readings sent over HTTP, as if they came from MQTT.
+// The body is JSON (application/json) or CBOR (application/cbor) and holds
+// one reading, an array of readings or a compact batch; every reading must
+// belong to the signing meter. Used when MQTT is not available.
+// POST /api/simulate
+func SubmitMeterData(c *gin.Context) {
+	format, err := mqtt.FormatForContentType(c.ContentType())
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	// MeterAuthMiddleware has already limited and buffered the body
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	readings, err := mqtt.DecodeReadings(payload, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	meterID := auth.GetMeterID(c)
+	for _, reading := range readings {
+		if reading.MeterID != meterID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Readings can only be submitted for the signing meter"})
+			return
+		}
+	}
+
+	source := mqtt.Source{Channel: models.ChannelHTTP, Payload: payload, Format: format}
+	queued := mqtt.SubmitReadings(readings, source)
+	if queued < len(readings) {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "Ingestion queue full, retry later",
+			"queued": queued,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "meterId": meterID, "readings": queued})
+}
+
+// SubmitSenML queues the readings of a SenML pack (RFC 8428) sent over HTTP.
+// Energy records (kWh, Wh, J) and temperature records (Cel) are converted to
+// readings of the signing meter; a pack with any other unit is refused.
+// POST /api/ingest/senml
+func SubmitSenML(c *gin.Context) {
+	if err := mqtt.CheckSenMLContentType(c.ContentType()); err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	meterID := auth.GetMeterID(c)
+	readings, err := mqtt.DecodeSenML(payload, meterID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source := mqtt.Source{Channel: models.ChannelHTTP, Payload: payload, Format: mqtt.FormatSenML}
+	queued := mqtt.SubmitReadings(readings, source)
+	if queued < len(readings) {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "Ingestion queue full, retry later",
+			"queued": queued,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "meterId": meterID, "readings": queued})
+}
+
+// SubmitDSMR queues the reading of a DSMR P1 telegram sent over HTTP as
+// text/plain. The telegram's CRC is checked; its import registers become
+// the cumulative register of the signing meter.
+// POST /api/ingest/dsmr
+func SubmitDSMR(c *gin.Context) {
+	if contentType := c.ContentType(); contentType != "" && contentType != mqtt.FormatDSMR {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported content type " + contentType + ", use " + mqtt.FormatDSMR})
+		return
+	}
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	telegram, err := dsmr.Parse(payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	meterID := auth.GetMeterID(c)
+	reading := mqtt.TelegramReading(meterID, telegram)
+	source := mqtt.Source{Channel: models.ChannelHTTP, Payload: payload, Format: mqtt.FormatDSMR}
+	if mqtt.SubmitReadings([]mqtt.MeterData{reading}, source) == 0 {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ingestion queue full, retry later"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "meterId": meterID, "readings": 1, "telegram": telegram})
+}
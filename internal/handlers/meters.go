@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"energy-prediction/internal/auth"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRotateMeterSecret issues a new secret for a household's meter and
+// re-activates a revoked one. The old secret stops working immediately; the
+// new one is only shown in this response (admin only).
+// POST /admin/meters/:meter_id/rotate
+func AdminRotateMeterSecret(c *gin.Context) {
+	meterID := c.Param("meter_id")
+
+	var house models.Household
+	if err := database.DB.Where("meter_id = ?", meterID).First(&house).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meter not found"})
+		return
+	}
+
+	credential, secret, err := auth.ProvisionMeter(database.DB, meterID)
+	if err != nil {
+		log.Printf("Failed to rotate secret of meter %s: %v", meterID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate meter secret"})
+		return
+	}
+	log.Printf("✓ Meter %s secret rotated (version %d)", meterID, credential.Version)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Meter secret rotated",
+		"meterId":    meterID,
+		"houseId":    house.ID,
+		"secret":     secret,
+		"credential": credential,
+	})
+}
+
+// AdminRevokeMeterSecret revokes a meter's secret, so its signed submissions
+// are rejected until the secret is rotated (admin only).
+// POST /admin/meters/:meter_id/revoke
+func AdminRevokeMeterSecret(c *gin.Context) {
+	meterID := c.Param("meter_id")
+
+	var credential models.MeterCredential
+	if err := database.DB.Where("meter_id = ?", meterID).First(&credential).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meter has no credential"})
+		return
+	}
+
+	if credential.Status != models.CredentialRevoked {
+		now := time.Now()
+		credential.Status = models.CredentialRevoked
+		credential.RevokedAt = &now
+		if err := database.DB.Save(&credential).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke meter secret"})
+			return
+		}
+		log.Printf("Meter %s secret revoked", meterID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Meter secret revoked",
+		"credential": credential,
+	})
+}
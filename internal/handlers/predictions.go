@@ -6,6 +6,7 @@ import (
 
 	"energy-prediction/internal/auth"
 	"energy-prediction/internal/database"
+	"energy-prediction/internal/ml"
 	"energy-prediction/internal/models"
 	"github.com/gin-gonic/gin"
 )
@@ -104,6 +105,50 @@ func GetPrediction(c *gin.Context) {
 	c.JSON(http.StatusOK, prediction.ToResponse())
 }
 
+// ExplainPrediction breaks a prediction's price down by factor. The
+// explanation is recomputed with the model, inputs, seed and household
+// features the prediction recorded, never the house's current details;
+// reproduced is false if the result no longer matches the stored price, e.g.
+// because the model artifact changed.
+// GET /api/predictions/:prediction_id/explain
+func ExplainPrediction(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	isAdmin := auth.IsAdmin(c)
+	predictionID := c.Param("prediction_id")
+
+	var prediction models.Prediction
+	query := database.DB.Where("id = ?", predictionID)
+
+	if !isAdmin {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.First(&prediction).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prediction not found"})
+		return
+	}
+
+	result, err := ml.Reproduce(&prediction)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Prediction cannot be explained: " + err.Error()})
+		return
+	}
+	if result.Explanation == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Model " + prediction.ModelName + "-" + prediction.ModelVersion + " does not explain its predictions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"predictionId":   prediction.ID,
+		"modelName":      prediction.ModelName,
+		"modelVersion":   prediction.ModelVersion,
+		"predictedPrice": prediction.PredictedPrice,
+		"reproduced":     result.Price == prediction.PredictedPrice,
+		"features":       prediction.Features,
+		"explanation":    result.Explanation,
+	})
+}
+
 // GetStatistics returns aggregated statistics for the user (or all for admin).
 // GET /api/statistics
 func GetStatistics(c *gin.Context) {
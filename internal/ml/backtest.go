@@ -0,0 +1,230 @@
+package ml
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// ErrNoSamples is returned when a backtest window holds no actual prices
+var ErrNoSamples = errors.New("no predictions with an actual price in the window")
+
+// Metrics are the errors of a model's prices against actual prices, in
+// €/kWh except MAPE (percent). Bias is the mean of predicted minus actual,
+// positive when the model overestimates.
+type Metrics struct {
+	Samples int     `json:"samples"`
+	MAE     float64 `json:"mae"`
+	MAPE    float64 `json:"mape"`
+	RMSE    float64 `json:"rmse"`
+	Bias    float64 `json:"bias"`
+}
+
+// GroupMetrics are the errors of one group of samples
+type GroupMetrics struct {
+	Group string `json:"group"`
+	Metrics
+}
+
+// Breakdown splits a backtest's errors by hour, region and heating type
+type Breakdown struct {
+	ByHour        []GroupMetrics `json:"byHour"`
+	ByRegion      []GroupMetrics `json:"byRegion"`
+	ByHeatingType []GroupMetrics `json:"byHeatingType"`
+}
+
+// BacktestResult is the outcome of replaying samples through one model
+type BacktestResult struct {
+	Model     Predictor
+	Overall   Metrics
+	Breakdown Breakdown
+}
+
+// errorSum accumulates prediction errors into Metrics
+type errorSum struct {
+	n                                  int
+	absolute, percent, squares, signed float64
+}
+
+func (e *errorSum) add(predicted, actual float64) {
+	diff := predicted - actual
+	e.n++
+	e.absolute += math.Abs(diff)
+	e.percent += math.Abs(diff) / actual * 100
+	e.squares += diff * diff
+	e.signed += diff
+}
+
+func (e *errorSum) metrics() Metrics {
+	if e.n == 0 {
+		return Metrics{}
+	}
+	n := float64(e.n)
+	return Metrics{
+		Samples: e.n,
+		MAE:     e.absolute / n,
+		MAPE:    e.percent / n,
+		RMSE:    math.Sqrt(e.squares / n),
+		Bias:    e.signed / n,
+	}
+}
+
+// Evaluate predicts every sample with p and compares with the actual price.
+// Samples without a positive actual price are skipped.
+func Evaluate(p Predictor, samples []Sample) Metrics {
+	return Backtest(p, samples).Overall
+}
+
+// Backtest predicts every sample with p and breaks the errors down by hour
+// (00-23), region and heating type. Samples without a positive actual price
+// are skipped; samples without a household are grouped as "unknown".
+func Backtest(p Predictor, samples []Sample) BacktestResult {
+	var overall errorSum
+	byHour := map[string]*errorSum{}
+	byRegion := map[string]*errorSum{}
+	byHeating := map[string]*errorSum{}
+	group := func(groups map[string]*errorSum, key string) *errorSum {
+		if groups[key] == nil {
+			groups[key] = &errorSum{}
+		}
+		return groups[key]
+	}
+
+	for _, s := range samples {
+		if s.ActualPrice <= 0 {
+			continue
+		}
+		predicted := p.Predict(s.Input).Price
+		region, heating := "unknown", "unknown"
+		if h := s.Household; h != nil {
+			if h.Region != "" {
+				region = h.Region
+			}
+			if h.HeatingType != "" {
+				heating = string(h.HeatingType)
+			}
+		}
+
+		overall.add(predicted, s.ActualPrice)
+		group(byHour, fmt.Sprintf("%02d", s.Hour)).add(predicted, s.ActualPrice)
+		group(byRegion, region).add(predicted, s.ActualPrice)
+		group(byHeating, heating).add(predicted, s.ActualPrice)
+	}
+
+	return BacktestResult{
+		Model:   p,
+		Overall: overall.metrics(),
+		Breakdown: Breakdown{
+			ByHour:        groupMetrics(byHour),
+			ByRegion:      groupMetrics(byRegion),
+			ByHeatingType: groupMetrics(byHeating),
+		},
+	}
+}
+
+// groupMetrics lists the metrics of each group, sorted by group
+func groupMetrics(groups map[string]*errorSum) []GroupMetrics {
+	list := make([]GroupMetrics, 0, len(groups))
+	for key, sum := range groups {
+		list = append(list, GroupMetrics{Group: key, Metrics: sum.metrics()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Group < list[j].Group })
+	return list
+}
+
+// RunBacktest replays the predictions between from and to (zero for an open
+// end) through the given models, all registered models if none are given,
+// and stores one BacktestRun per model under a shared run ID.
+//
+// Only predictions from the cutoff on are replayed. The cutoff is raised to
+// the training cutoff of every trained model, so no model is scored on
+// predictions it was fitted to, and all models share the same samples.
+func RunBacktest(modelIDs []string, from, to, cutoff time.Time) ([]models.BacktestRun, error) {
+	var predictors []Predictor
+	if len(modelIDs) == 0 {
+		for _, info := range Models() {
+			p, _ := Get(info.ID)
+			predictors = append(predictors, p)
+		}
+	}
+	for _, id := range modelIDs {
+		p, ok := Get(id)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownModel, id)
+		}
+		predictors = append(predictors, p)
+	}
+
+	for _, p := range predictors {
+		if trained, ok := p.(Trained); ok && trained.TrainingCutoff().After(cutoff) {
+			cutoff = trained.TrainingCutoff()
+		}
+	}
+	start := from
+	if cutoff.After(start) {
+		start = cutoff
+	}
+
+	samples, err := LoadSamples(start, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		if !cutoff.IsZero() {
+			return nil, fmt.Errorf("%w from the cutoff %s on", ErrNoSamples, cutoff.Format(time.RFC3339))
+		}
+		return nil, ErrNoSamples
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate run id: %w", err)
+	}
+	runID := hex.EncodeToString(idBytes)
+
+	var windowFrom, windowTo, holdout *time.Time
+	if !from.IsZero() {
+		windowFrom = &from
+	}
+	if !to.IsZero() {
+		windowTo = &to
+	}
+	if !cutoff.IsZero() {
+		holdout = &cutoff
+	}
+
+	runs := make([]models.BacktestRun, 0, len(predictors))
+	for _, p := range predictors {
+		result := Backtest(p, samples)
+		breakdown, err := json.Marshal(result.Breakdown)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode breakdown: %w", err)
+		}
+		runs = append(runs, models.BacktestRun{
+			RunID:        runID,
+			ModelName:    p.Name(),
+			ModelVersion: p.Version(),
+			WindowFrom:   windowFrom,
+			WindowTo:     windowTo,
+			Cutoff:       holdout,
+			Samples:      result.Overall.Samples,
+			MAE:          result.Overall.MAE,
+			MAPE:         result.Overall.MAPE,
+			RMSE:         result.Overall.RMSE,
+			Bias:         result.Overall.Bias,
+			Breakdown:    breakdown,
+		})
+	}
+	if err := database.DB.Create(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to save backtest: %w", err)
+	}
+	return runs, nil
+}
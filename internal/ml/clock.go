@@ -0,0 +1,93 @@
+package ml
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"energy-prediction/internal/models"
+)
+
+// Clock tells the current time. Models never read it: the time a price
+// applies to is part of Input. It only decides where forecasts start.
+type Clock interface {
+	Now() time.Time
+}
+
+// RNG is the source of randomness of a prediction. Models draw only from
+// NewRNG(Input.Seed), so the same input always gives the same price.
+type RNG interface {
+	Float64() float64
+	Intn(n int) int
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+var clockState = struct {
+	mu    sync.RWMutex
+	clock Clock
+}{clock: systemClock{}}
+
+// SetClock replaces the clock used for forecasts and training metadata;
+// nil restores the system clock
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clockState.mu.Lock()
+	defer clockState.mu.Unlock()
+	clockState.clock = c
+}
+
+// now returns the time of the injected clock
+func now() time.Time {
+	clockState.mu.RLock()
+	defer clockState.mu.RUnlock()
+	return clockState.clock.Now()
+}
+
+// NewRNG returns the deterministic RNG for a seed. math/rand sources are
+// stable across Go releases, so recorded seeds stay reproducible.
+func NewRNG(seed int64) RNG {
+	return rand.New(rand.NewSource(seed))
+}
+
+// SeedFor derives the seed of a prediction from the meter and the time it
+// is for, so a resubmitted reading gets the same prediction
+func SeedFor(meterID string, at time.Time) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(meterID))
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(at.UTC().UnixNano()))
+	h.Write(buf[:])
+	return int64(h.Sum64())
+}
+
+// Reproduce recomputes a stored prediction with the model, time, seed and
+// household attributes it recorded. The house itself is not read, so
+// editing it afterwards does not change the result.
+func Reproduce(p *models.Prediction) (Result, error) {
+	if p.ModelName == "" {
+		return Result{}, fmt.Errorf("prediction %d predates model versioning", p.ID)
+	}
+	if p.Features == nil {
+		return Result{}, fmt.Errorf("prediction %d predates recorded household features", p.ID)
+	}
+	model, ok := Get(p.ModelName + "-" + p.ModelVersion)
+	if !ok {
+		return Result{}, fmt.Errorf("%w %q", ErrUnknownModel, p.ModelName+"-"+p.ModelVersion)
+	}
+	return model.Predict(Input{
+		Household:   p.Features.Household(),
+		Hour:        p.Hour,
+		Temperature: p.Temperature,
+		Consumption: p.ConsumptionKwh,
+		Time:        p.Timestamp,
+		Seed:        p.Seed,
+	}), nil
+}
@@ -0,0 +1,60 @@
+package ml
+
+import (
+	"fmt"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// Sample is a historical input with the market price that occurred
+type Sample struct {
+	Input
+	ActualPrice float64
+}
+
+// LoadSamples reads the stored predictions with a recorded actual price,
+// oldest first, as samples with their household attributes: those recorded
+// with the prediction, or the house's current ones for older predictions.
+// Predictions copy the temperature and consumption of the reading they were
+// made from.
+// A zero from or to leaves that end of the window open.
+func LoadSamples(from, to time.Time) ([]Sample, error) {
+	query := database.DB.Preload("Household").Where("actual_price > 0")
+	if !from.IsZero() {
+		query = query.Where("timestamp >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("timestamp < ?", to)
+	}
+
+	var predictions []models.Prediction
+	if err := query.Order("timestamp ASC, id ASC").Find(&predictions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load predictions: %w", err)
+	}
+
+	samples := make([]Sample, 0, len(predictions))
+	for i := range predictions {
+		p := &predictions[i]
+		var household *models.Household
+		switch {
+		case p.Features != nil:
+			household = p.Features.Household()
+		case p.Household.ID != "":
+			household = &p.Household
+		}
+		samples = append(samples, Sample{
+			Input: Input{
+				Household:   household,
+				Hour:        p.Hour,
+				Temperature: p.Temperature,
+				Consumption: p.ConsumptionKwh,
+				Time:        p.Timestamp,
+				Seed:        p.Seed,
+			},
+			ActualPrice: p.ActualPrice,
+		})
+	}
+	return samples, nil
+}
@@ -0,0 +1,84 @@
+package ml
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"energy-prediction/internal/models"
+)
+
+// explain builds the explanation of a price from its base and factors.
+// The difference between base and the product of the factors is split over
+// the factors in proportion to the log of their value, the only split of a
+// product that adds up exactly and does not depend on the factors' order.
+func explain(base, price float64, factors []models.PriceFactor) *models.PriceExplanation {
+	var total float64
+	for _, f := range factors {
+		total += math.Log(f.Value)
+	}
+	// base * (e^total - 1) / total, which tends to base as total tends to 0
+	scale := base
+	if math.Abs(total) > 1e-12 {
+		scale = base * math.Expm1(total) / total
+	}
+	for i := range factors {
+		factors[i].Contribution = math.Round(scale*math.Log(factors[i].Value)*10000) / 10000
+		factors[i].Value = math.Round(factors[i].Value*10000) / 10000
+	}
+	return &models.PriceExplanation{
+		BasePrice: math.Round(base*10000) / 10000,
+		Factors:   factors,
+		Price:     price,
+	}
+}
+
+// factorDetail describes the input an explained factor was derived from
+func factorDetail(name string, in Input) string {
+	h := in.Household
+	switch name {
+	case "region":
+		if h != nil && h.Region != "" {
+			return h.Region
+		}
+	case "members":
+		if h != nil {
+			return fmt.Sprintf("%d members", h.Members)
+		}
+	case "area":
+		if h != nil {
+			return fmt.Sprintf("%.0f m²", h.AreaSqm)
+		}
+	case "efficiency":
+		if h != nil {
+			return fmt.Sprintf("%s heating, built %d", h.HeatingType, h.YearBuilt)
+		}
+	case "season":
+		switch month := in.Time.Month(); month {
+		case time.December, time.January, time.February:
+			return month.String() + " (winter)"
+		case time.June, time.July, time.August:
+			return month.String() + " (summer)"
+		default:
+			return month.String()
+		}
+	case "timeBand":
+		band := "shoulder"
+		switch {
+		case in.Hour >= 23 || in.Hour < 7:
+			band = "night"
+		case in.Hour >= 8 && in.Hour < 12:
+			band = "morning peak"
+		case in.Hour >= 19 && in.Hour < 21:
+			band = "evening peak"
+		}
+		return fmt.Sprintf("%02d:00, %s", in.Hour, band)
+	case "weather":
+		return fmt.Sprintf("%.1f°C", in.Temperature)
+	case "consumption":
+		return fmt.Sprintf("%.2f kWh", in.Consumption)
+	case "volatility":
+		return "market noise (±3%)"
+	}
+	return "unknown"
+}
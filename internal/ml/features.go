@@ -0,0 +1,95 @@
+package ml
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"energy-prediction/internal/models"
+)
+
+// featureNames lists the engineered features in the order features writes
+// them. Trained artifacts store this list and are rejected if it changed.
+var featureNames = []string{
+	"region_north", "region_islands", "region_lazio",
+	"members", "members_large", "members_small",
+	"area_sqm", "area_large", "area_small",
+	"year_built", "built_before_1980", "built_after_2015",
+	"heating_electric", "heating_heat_pump", "heating_gas",
+	"season_winter", "season_summer",
+	"band_night", "band_morning_peak", "band_evening_peak",
+	"temperature", "weather_cold", "weather_hot", "weather_mild",
+	"consumption_kwh", "consumption_high",
+}
+
+// featureFactors maps each feature to the explained factor it belongs to
+var featureFactors = map[string]string{
+	"region_north": "region", "region_islands": "region", "region_lazio": "region",
+	"members": "members", "members_large": "members", "members_small": "members",
+	"area_sqm": "area", "area_large": "area", "area_small": "area",
+	"year_built": "efficiency", "built_before_1980": "efficiency", "built_after_2015": "efficiency",
+	"heating_electric": "efficiency", "heating_heat_pump": "efficiency", "heating_gas": "efficiency",
+	"season_winter": "season", "season_summer": "season",
+	"band_night": "timeBand", "band_morning_peak": "timeBand", "band_evening_peak": "timeBand",
+	"temperature": "weather", "weather_cold": "weather", "weather_hot": "weather", "weather_mild": "weather",
+	"consumption_kwh": "consumption", "consumption_high": "consumption",
+}
+
+// factorOrder is the order explained factors are listed in
+var factorOrder = []string{"region", "members", "area", "efficiency", "season", "timeBand", "weather", "consumption"}
+
+// features turns an input into the feature vector models learn from.
+// Household features are NaN when the house is unknown, so models can
+// replace them with the training mean.
+func features(in Input) []float64 {
+	x := make([]float64, 0, len(featureNames))
+
+	if h := in.Household; h != nil {
+		region := strings.ToLower(h.Region)
+		x = append(x,
+			indicator(strings.Contains(region, "lombardia") || strings.Contains(region, "milano")),
+			indicator(strings.Contains(region, "sicilia") || strings.Contains(region, "sardegna")),
+			indicator(strings.Contains(region, "lazio") || strings.Contains(region, "roma")),
+			float64(h.Members), indicator(h.Members > 4), indicator(h.Members <= 2),
+			h.AreaSqm, indicator(h.AreaSqm > 150), indicator(h.AreaSqm < 60),
+			float64(h.YearBuilt), indicator(h.YearBuilt < 1980), indicator(h.YearBuilt > 2015),
+			indicator(h.HeatingType == models.HeatingElectric),
+			indicator(h.HeatingType == models.HeatingHeatPump),
+			indicator(h.HeatingType == models.HeatingGas),
+		)
+	} else {
+		for i := 0; i < 15; i++ {
+			x = append(x, math.NaN())
+		}
+	}
+
+	month := in.Time.Month()
+	x = append(x,
+		indicator(month == time.December || month == time.January || month == time.February),
+		indicator(month == time.June || month == time.July || month == time.August),
+	)
+
+	x = append(x,
+		indicator(in.Hour >= 23 || in.Hour < 7),
+		indicator(in.Hour >= 8 && in.Hour < 12),
+		indicator(in.Hour >= 19 && in.Hour < 21),
+	)
+
+	x = append(x,
+		in.Temperature,
+		indicator(in.Temperature < 2),
+		indicator(in.Temperature > 32),
+		indicator(in.Temperature >= 18 && in.Temperature <= 24),
+	)
+
+	x = append(x, in.Consumption, indicator(in.Consumption > 3.0))
+	return x
+}
+
+// indicator encodes a condition as 1 or 0
+func indicator(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
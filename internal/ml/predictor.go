@@ -0,0 +1,164 @@
+package ml
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"energy-prediction/internal/models"
+)
+
+// DefaultModel is the model used when ML_MODEL is unset
+const DefaultModel = "rules-v1"
+
+// ErrUnknownModel is returned for a model ID that is not registered
+var ErrUnknownModel = errors.New("unknown model")
+
+// Input holds what a model predicts a price from
+type Input struct {
+	Household   *models.Household // house details for personalization, may be nil
+	Hour        int               // hour of the day (0-23)
+	Temperature float64           // outdoor temperature in Celsius
+	Consumption float64           // consumption in kWh
+	Time        time.Time         // when the price applies; its month sets the season
+	Seed        int64             // seeds the model's RNG, recorded with the prediction
+}
+
+// Result is a model's prediction
+type Result struct {
+	Price       float64                  // predicted price in €/kWh
+	Confidence  int                      // confidence percentage (0-100)
+	Explanation *models.PriceExplanation // how the price was built, nil if the model cannot tell
+}
+
+// Predictor is a price model. Implementations are identified by name and
+// version, which are recorded with every prediction they make. Predict must
+// be a pure function of its input: time and randomness come only from
+// Input.Time and Input.Seed.
+type Predictor interface {
+	Name() string
+	Version() string
+	Predict(in Input) Result
+}
+
+// Trained is implemented by models fitted to stored predictions. Backtests
+// only evaluate them on predictions from TrainingCutoff on, which they never
+// saw while training.
+type Trained interface {
+	TrainingCutoff() time.Time
+}
+
+// ModelInfo describes a registered model
+type ModelInfo struct {
+	ID      string `json:"id"` // name-version, as selected by ML_MODEL
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Active  bool   `json:"active"`
+}
+
+// ModelID returns the identifier of a model: its name and version
+func ModelID(p Predictor) string {
+	return p.Name() + "-" + p.Version()
+}
+
+var registry = struct {
+	mu     sync.RWMutex
+	models map[string]Predictor // model ID -> model
+	active Predictor
+}{
+	models: map[string]Predictor{},
+}
+
+func init() {
+	Register(RulesV1{})
+	registry.active = RulesV1{}
+}
+
+// Register adds a model to the registry, replacing one with the same ID
+func Register(p Predictor) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.models[ModelID(p)] = p
+}
+
+// Get returns a registered model by ID
+func Get(id string) (Predictor, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	p, ok := registry.models[id]
+	return p, ok
+}
+
+// Active returns the model used for new predictions
+func Active() Predictor {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.active
+}
+
+// SetActive selects the model used for new predictions
+func SetActive(id string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	p, ok := registry.models[id]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownModel, id)
+	}
+	registry.active = p
+	return nil
+}
+
+// Models lists the registered models, sorted by ID
+func Models() []ModelInfo {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	infos := make([]ModelInfo, 0, len(registry.models))
+	for id, p := range registry.models {
+		infos = append(infos, ModelInfo{
+			ID:      id,
+			Name:    p.Name(),
+			Version: p.Version(),
+			Active:  ModelID(registry.active) == id,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Configure registers trained model artifacts and selects the active model
+// from the environment. An unknown model falls back to the default.
+//
+// Configuration:
+//   - ML_MODEL_FILE: trained model artifacts to register, comma separated
+//     (written by cmd/train-model)
+//   - ML_MODEL: model ID (name-version) used for predictions (default rules-v1)
+func Configure() {
+	for _, path := range strings.Split(os.Getenv("ML_MODEL_FILE"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		model, err := LoadRidge(path)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		Register(model)
+		log.Printf("✓ Loaded model %s (%d samples, trained %s)", ModelID(model), model.Samples, model.TrainedAt.Format(time.RFC3339))
+	}
+
+	id := strings.TrimSpace(os.Getenv("ML_MODEL"))
+	if id == "" {
+		id = DefaultModel
+	}
+	if err := SetActive(id); err != nil {
+		log.Printf("Warning: %v, using %s", err, DefaultModel)
+		SetActive(DefaultModel)
+	}
+	log.Printf("✓ Price model: %s", ModelID(Active()))
+}
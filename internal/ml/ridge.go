@@ -0,0 +1,298 @@
+package ml
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"energy-prediction/internal/models"
+)
+
+// RidgeName is the model name of trained ridge regressions
+const RidgeName = "ridge"
+
+// RidgeModel is a ridge regression of the log price on the engineered
+// features. Fitting the log turns the multiplicative market factors into
+// additive weights. It is trained offline (cmd/train-model) and loaded from
+// its JSON artifact at startup.
+type RidgeModel struct {
+	ModelName    string    `json:"name"`
+	ModelVersion string    `json:"version"`
+	TrainedAt    time.Time `json:"trainedAt"`
+	TrainedUntil time.Time `json:"trainedUntil"` // trained on samples before it only
+	Samples      int       `json:"samples"`
+	Lambda       float64   `json:"lambda"`
+	Features     []string  `json:"features"`
+	Means        []float64 `json:"means"`  // per feature, used to standardize
+	Scales       []float64 `json:"scales"` // per feature standard deviation
+	Weights      []float64 `json:"weights"`
+	Intercept    float64   `json:"intercept"`
+	ResidualStd  float64   `json:"residualStd"` // of the log price on the training set
+}
+
+// Name returns the model name
+func (m *RidgeModel) Name() string { return m.ModelName }
+
+// Version returns the model version
+func (m *RidgeModel) Version() string { return m.ModelVersion }
+
+// TrainingCutoff returns the end of the training data. Artifacts written
+// before it was recorded may have seen everything up to TrainedAt.
+func (m *RidgeModel) TrainingCutoff() time.Time {
+	if m.TrainedUntil.IsZero() {
+		return m.TrainedAt
+	}
+	return m.TrainedUntil
+}
+
+// Predict returns the fitted price. Confidence follows the training error:
+// a residual of 5% in log price gives 90%, clamped to 50-95. The price is
+// explained relative to the training average, each factor being the
+// exponent of the weighted features it groups.
+func (m *RidgeModel) Predict(in Input) Result {
+	logPrice := m.Intercept
+	logFactors := make(map[string]float64, len(factorOrder))
+	for i, value := range features(in) {
+		if !math.IsNaN(value) {
+			term := m.Weights[i] * (value - m.Means[i]) / m.Scales[i]
+			logPrice += term
+			logFactors[featureFactors[featureNames[i]]] += term
+		}
+	}
+	price := math.Round(math.Exp(logPrice)*10000) / 10000
+
+	factors := make([]models.PriceFactor, 0, len(factorOrder))
+	for _, name := range factorOrder {
+		factors = append(factors, models.PriceFactor{
+			Name:   name,
+			Value:  math.Exp(logFactors[name]),
+			Detail: factorDetail(name, in),
+		})
+	}
+
+	confidence := int(math.Round(100 * (1 - 2*m.ResidualStd)))
+	if confidence > 95 {
+		confidence = 95
+	}
+	if confidence < 50 {
+		confidence = 50
+	}
+	return Result{Price: price, Confidence: confidence, Explanation: explain(math.Exp(m.Intercept), price, factors)}
+}
+
+// TrainRidge fits a ridge regression to samples. Features are standardized
+// before fitting; lambda is the L2 penalty on the standardized weights.
+// Samples without a positive actual price are skipped. TrainedUntil is set
+// just after the newest sample; callers holding out a later cutoff may raise it.
+func TrainRidge(samples []Sample, lambda float64) (*RidgeModel, error) {
+	if lambda <= 0 {
+		return nil, errors.New("lambda must be positive")
+	}
+
+	var rows [][]float64
+	var targets []float64
+	var newest time.Time
+	for _, s := range samples {
+		if s.ActualPrice <= 0 {
+			continue
+		}
+		if s.Time.After(newest) {
+			newest = s.Time
+		}
+		rows = append(rows, features(s.Input))
+		targets = append(targets, math.Log(s.ActualPrice))
+	}
+	k := len(featureNames)
+	if len(rows) <= k {
+		return nil, fmt.Errorf("need more than %d samples with an actual price, got %d", k, len(rows))
+	}
+
+	// Standardize, replacing unknown values with the mean
+	means := make([]float64, k)
+	scales := make([]float64, k)
+	for j := 0; j < k; j++ {
+		var sum, n float64
+		for _, row := range rows {
+			if !math.IsNaN(row[j]) {
+				sum += row[j]
+				n++
+			}
+		}
+		if n > 0 {
+			means[j] = sum / n
+		}
+		var squares float64
+		for _, row := range rows {
+			if !math.IsNaN(row[j]) {
+				squares += (row[j] - means[j]) * (row[j] - means[j])
+			}
+		}
+		scales[j] = 1
+		if n > 0 && squares > 0 {
+			scales[j] = math.Sqrt(squares / n)
+		}
+	}
+	for _, row := range rows {
+		for j := range row {
+			if math.IsNaN(row[j]) {
+				row[j] = 0
+			} else {
+				row[j] = (row[j] - means[j]) / scales[j]
+			}
+		}
+	}
+
+	var intercept float64
+	for _, y := range targets {
+		intercept += y
+	}
+	intercept /= float64(len(targets))
+
+	// Normal equations: (ZᵀZ + λI) w = Zᵀ(y - ȳ)
+	a := make([][]float64, k)
+	b := make([]float64, k)
+	for i := range a {
+		a[i] = make([]float64, k)
+		a[i][i] = lambda
+	}
+	for r, row := range rows {
+		centered := targets[r] - intercept
+		for i := 0; i < k; i++ {
+			b[i] += row[i] * centered
+			for j := 0; j <= i; j++ {
+				a[i][j] += row[i] * row[j]
+			}
+		}
+	}
+	for i := 0; i < k; i++ {
+		for j := i + 1; j < k; j++ {
+			a[i][j] = a[j][i]
+		}
+	}
+	weights, err := solveCholesky(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var squares float64
+	for r, row := range rows {
+		fitted := intercept
+		for j, value := range row {
+			fitted += weights[j] * value
+		}
+		squares += (targets[r] - fitted) * (targets[r] - fitted)
+	}
+
+	trainedAt := now().UTC()
+	return &RidgeModel{
+		ModelName:    RidgeName,
+		ModelVersion: "v" + trainedAt.Format("20060102150405"),
+		TrainedAt:    trainedAt,
+		TrainedUntil: newest.Add(time.Nanosecond),
+		Samples:      len(rows),
+		Lambda:       lambda,
+		Features:     append([]string(nil), featureNames...),
+		Means:        means,
+		Scales:       scales,
+		Weights:      weights,
+		Intercept:    intercept,
+		ResidualStd:  math.Sqrt(squares / float64(len(rows))),
+	}, nil
+}
+
+// solveCholesky solves a x = b for a symmetric positive definite matrix
+func solveCholesky(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, n)
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, errors.New("normal equations are not positive definite")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+
+	// Forward substitution L y = b, then back substitution Lᵀ x = y
+	y := make([]float64, n)
+	for i := 0; i < n; i++ {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i][k] * y[k]
+		}
+		y[i] = sum / l[i][i]
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		sum := y[i]
+		for k := i + 1; k < n; k++ {
+			sum -= l[k][i] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x, nil
+}
+
+// Save writes the model artifact as JSON, creating its directory
+func (m *RidgeModel) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode model: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create model directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write model: %w", err)
+	}
+	return nil
+}
+
+// LoadRidge reads a model artifact written by Save. Artifacts trained on a
+// different feature set are rejected.
+func LoadRidge(path string) (*RidgeModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+	var m RidgeModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode model %s: %w", path, err)
+	}
+
+	if m.ModelName == "" || m.ModelVersion == "" {
+		return nil, fmt.Errorf("model %s has no name or version", path)
+	}
+	if len(m.Features) != len(featureNames) {
+		return nil, fmt.Errorf("model %s has %d features, expected %d", path, len(m.Features), len(featureNames))
+	}
+	for i, name := range featureNames {
+		if m.Features[i] != name {
+			return nil, fmt.Errorf("model %s feature %d is %q, expected %q", path, i, m.Features[i], name)
+		}
+	}
+	k := len(featureNames)
+	if len(m.Means) != k || len(m.Scales) != k || len(m.Weights) != k {
+		return nil, fmt.Errorf("model %s has %d means, %d scales and %d weights for %d features",
+			path, len(m.Means), len(m.Scales), len(m.Weights), k)
+	}
+	for i, scale := range m.Scales {
+		if scale <= 0 {
+			return nil, fmt.Errorf("model %s has a non-positive scale for %s", path, featureNames[i])
+		}
+	}
+	return &m, nil
+}
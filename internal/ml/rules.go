@@ -0,0 +1,180 @@
+package ml
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"energy-prediction/internal/models"
+)
+
+// RulesV1 is the rule-based decision tree that mimics Italian market
+// patterns: a base price scaled by region, household, building, season,
+// time band, weather and consumption factors.
+type RulesV1 struct{}
+
+// Name returns the model name
+func (RulesV1) Name() string { return "rules" }
+
+// Version returns the model version
+func (RulesV1) Version() string { return "v1" }
+
+// Predict uses a decision tree approach to predict energy prices. The
+// result explains the price by each factor of the tree.
+func (RulesV1) Predict(in Input) Result {
+	household, hour, temperature, consumption := in.Household, in.Hour, in.Temperature, in.Consumption
+
+	// Base price (Italian market average)
+	basePrice := 0.12 // €/kWh (Updated for 2024 realism)
+
+	// --- 1. Regional Variation Factor ---
+	regionFactor := 1.0
+	region := ""
+	if household != nil {
+		region = strings.ToLower(household.Region)
+	}
+
+	switch {
+	case strings.Contains(region, "lombardia") || strings.Contains(region, "milano"):
+		regionFactor = 1.05
+	case strings.Contains(region, "sicilia") || strings.Contains(region, "sardegna"):
+		regionFactor = 1.12
+	case strings.Contains(region, "lazio") || strings.Contains(region, "roma"):
+		regionFactor = 1.08
+	default:
+		regionFactor = 1.00
+	}
+
+	// --- 2. Household Size (Members) Influence ---
+	membersFactor := 1.0
+	if household != nil {
+		if household.Members > 4 {
+			membersFactor = 1.10
+		} else if household.Members <= 2 {
+			membersFactor = 0.95
+		}
+	}
+
+	// --- 3. Area & Efficiency Correlation ---
+	areaFactor := 1.0
+	if household != nil {
+		if household.AreaSqm > 150 {
+			areaFactor = 1.07
+		} else if household.AreaSqm < 60 {
+			areaFactor = 0.98
+		}
+	}
+
+	// --- 4. Building Efficiency & Seasonality ---
+	efficiencyFactor := 1.0
+	seasonFactor := 1.0
+	month := in.Time.Month()
+
+	if household != nil {
+		// Heating Type
+		switch household.HeatingType {
+		case models.HeatingElectric:
+			efficiencyFactor *= 0.90
+		case models.HeatingHeatPump:
+			efficiencyFactor *= 0.85
+		case models.HeatingGas:
+			efficiencyFactor *= 1.05
+		}
+
+		// Year Built
+		if household.YearBuilt < 1980 {
+			efficiencyFactor *= 1.10
+		} else if household.YearBuilt > 2015 {
+			efficiencyFactor *= 0.92
+		}
+
+		// Seasonal Adjustment
+		// Winter (Dec, Jan, Feb): High demand for heating
+		// Summer (Jun, Jul, Aug): High demand for cooling (AC)
+		if month == time.December || month == time.January || month == time.February {
+			seasonFactor = 1.15 // Winter premium
+		} else if month == time.June || month == time.July || month == time.August {
+			seasonFactor = 1.10 // Summer peak (AC)
+		}
+	}
+
+	// --- 5. Time Factor (PUN simulation) ---
+	var timeFactor float64
+	switch {
+	case hour >= 23 || hour < 7:
+		timeFactor = 0.75
+	case hour >= 8 && hour < 12:
+		timeFactor = 1.30
+	case hour >= 19 && hour < 21:
+		timeFactor = 1.40
+	default:
+		timeFactor = 1.05
+	}
+
+	// --- 6. Weather Factor ---
+	var tempFactor float64
+	if temperature < 2 {
+		tempFactor = 1.25 // Extreme cold
+	} else if temperature > 32 {
+		tempFactor = 1.20 // Heatwave
+	} else if temperature >= 18 && temperature <= 24 {
+		tempFactor = 0.90 // Perfect weather
+	} else {
+		tempFactor = 1.00
+	}
+
+	// --- 7. Consumption Factor ---
+	consumptionFactor := 1.0
+	if consumption > 3.0 {
+		consumptionFactor = 1.15
+	}
+
+	// Total calculation
+	price := basePrice * regionFactor * membersFactor * areaFactor * (efficiencyFactor * seasonFactor) * timeFactor * tempFactor * consumptionFactor
+
+	// Add market volatility (±3%, drawn from the input's seed)
+	volatility := 0.97 + NewRNG(in.Seed).Float64()*0.06
+	price *= volatility
+
+	// Final Formatting
+	price = math.Round(price*10000) / 10000
+
+	factors := []models.PriceFactor{
+		{Name: "region", Value: regionFactor},
+		{Name: "members", Value: membersFactor},
+		{Name: "area", Value: areaFactor},
+		{Name: "efficiency", Value: efficiencyFactor},
+		{Name: "season", Value: seasonFactor},
+		{Name: "timeBand", Value: timeFactor},
+		{Name: "weather", Value: tempFactor},
+		{Name: "consumption", Value: consumptionFactor},
+		{Name: "volatility", Value: volatility},
+	}
+	for i := range factors {
+		factors[i].Detail = factorDetail(factors[i].Name, in)
+	}
+
+	// Confidence calculation
+	confidence := 92
+	if household != nil {
+		if household.Members > 5 || household.AreaSqm > 200 {
+			confidence -= 4
+		}
+		if household.YearBuilt < 1960 {
+			confidence -= 5
+		}
+	}
+	if temperature < -5 || temperature > 40 {
+		confidence -= 10
+	}
+
+	// Ensure confidence limits
+	if confidence > 95 {
+		confidence = 95
+	}
+	if confidence < 70 {
+		confidence = 70
+	}
+
+	return Result{Price: price, Confidence: confidence, Explanation: explain(basePrice, price, factors)}
+}
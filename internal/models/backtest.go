@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BacktestRun stores the errors of one model replayed over a historical
+// window, so model versions can be compared over time. Models backtested
+// together share a RunID. Errors are in €/kWh except MAPE (percent); bias is
+// predicted minus actual.
+type BacktestRun struct {
+	ID           uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	RunID        string          `json:"runId" gorm:"column:run_id;index;not null;size:20"`
+	ModelName    string          `json:"modelName" gorm:"column:model_name;index;not null;size:50"`
+	ModelVersion string          `json:"modelVersion" gorm:"column:model_version;not null;size:20"`
+	WindowFrom   *time.Time      `json:"windowFrom"` // nil for the start of history
+	WindowTo     *time.Time      `json:"windowTo"`   // nil for up to now
+	Cutoff       *time.Time      `json:"cutoff"`     // predictions before it were left out, as a model may have trained on them
+	Samples      int             `json:"samples"`
+	MAE          float64         `json:"mae"`
+	MAPE         float64         `json:"mape"`
+	RMSE         float64         `json:"rmse"`
+	Bias         float64         `json:"bias"`
+	Breakdown    json.RawMessage `json:"breakdown" gorm:"type:text"` // the same errors by hour, region and heating type
+	CreatedAt    time.Time       `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+func (BacktestRun) TableName() string {
+	return "backtest_runs"
+}
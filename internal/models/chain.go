@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// ChainBlock persists a block of the simulated blockchain.
+// Blocks are reloaded on startup so hashes keep linking to earlier blocks
+// across restarts of the API gateway.
+type ChainBlock struct {
+	Number     uint64    `json:"number" gorm:"primaryKey;autoIncrement:false"`
+	Hash       string    `json:"hash" gorm:"uniqueIndex;not null;size:100"`
+	PrevHash   string    `json:"prevHash" gorm:"column:prev_hash;not null;size:100"`
+	MerkleRoot string    `json:"merkleRoot" gorm:"column:merkle_root;size:100"`
+	Timestamp  time.Time `json:"timestamp" gorm:"not null"`
+	TxCount    int       `json:"txCount" gorm:"column:tx_count"`
+}
+
+func (ChainBlock) TableName() string {
+	return "chain_blocks"
+}
+
+// ChainTransaction persists a transaction included in a ChainBlock.
+// Position keeps the order of transactions inside their block.
+type ChainTransaction struct {
+	Hash         string `json:"hash" gorm:"primaryKey;size:100"`
+	BlockNumber  uint64 `json:"blockNumber" gorm:"column:block_number;index;not null"`
+	Position     int    `json:"position" gorm:"not null"`
+	PredictionID uint   `json:"predictionId" gorm:"column:prediction_id;index"`
+	Data         string `json:"data" gorm:"type:text;not null"`
+	GasUsed      uint64 `json:"gasUsed" gorm:"column:gas_used"`
+}
+
+func (ChainTransaction) TableName() string {
+	return "chain_transactions"
+}
+
+// SigningKey is a public key the API gateway has used to sign predictions.
+// Retired keys are kept so signatures made before a rotation stay verifiable.
+type SigningKey struct {
+	KeyID     string     `json:"keyId" gorm:"column:key_id;primaryKey;size:20"`
+	Algorithm string     `json:"algorithm" gorm:"size:20;not null"`
+	PublicKey string     `json:"publicKey" gorm:"column:public_key;not null;size:100"` // base64
+	Active    bool       `json:"active" gorm:"default:false"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+	RetiredAt *time.Time `json:"retiredAt" gorm:"column:retired_at"`
+}
+
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
+
+// BlockchainOutbox is a prediction waiting to be logged to the ledger.
+// Rows are written together with the prediction so nothing is lost if the
+// ledger is unavailable or the process exits; the retry worker deletes a row
+// once the prediction has a transaction hash.
+type BlockchainOutbox struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	PredictionID  uint      `json:"predictionId" gorm:"column:prediction_id;uniqueIndex;not null"`
+	Status        string    `json:"status" gorm:"size:20;index"` // pending, failed
+	Attempts      int       `json:"attempts" gorm:"default:0"`
+	LastError     string    `json:"lastError" gorm:"column:last_error;size:500"`
+	NextAttemptAt time.Time `json:"nextAttemptAt" gorm:"column:next_attempt_at;index"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+func (BlockchainOutbox) TableName() string {
+	return "blockchain_outbox"
+}
@@ -51,6 +51,44 @@ func (Household) TableName() string {
 	return "households"
 }
 
+// CredentialStatus tells whether a meter secret may still sign readings
+type CredentialStatus string
+
+const (
+	CredentialActive  CredentialStatus = "active"
+	CredentialRevoked CredentialStatus = "revoked"
+)
+
+// MeterCredential is the provisioning secret of a smart meter. Meters sign
+// HTTP submissions with it (HMAC-SHA256); the secret is only shown when it is
+// issued or rotated.
+type MeterCredential struct {
+	MeterID   string           `json:"meterId" gorm:"primaryKey;column:meter_id;size:50"`
+	Secret    string           `json:"-" gorm:"not null;size:64"` // hex, needed server-side to verify HMACs
+	Version   int              `json:"version" gorm:"default:1"`  // incremented on every rotation
+	Status    CredentialStatus `json:"status" gorm:"type:varchar(10);default:'active'"`
+	CreatedAt time.Time        `json:"createdAt" gorm:"autoCreateTime"`
+	RotatedAt *time.Time       `json:"rotatedAt,omitempty" gorm:"column:rotated_at"`
+	RevokedAt *time.Time       `json:"revokedAt,omitempty" gorm:"column:revoked_at"`
+}
+
+func (MeterCredential) TableName() string {
+	return "meter_credentials"
+}
+
+// MeterNonce is a nonce used in a signed meter request. Nonces are kept for
+// the signature window, so a captured request cannot be replayed.
+type MeterNonce struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	MeterID   string    `gorm:"column:meter_id;uniqueIndex:idx_meter_nonce;size:50;not null"`
+	Nonce     string    `gorm:"uniqueIndex:idx_meter_nonce;size:64;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (MeterNonce) TableName() string {
+	return "meter_nonces"
+}
+
 // ========== Request/Response DTOs ==========
 
 // CreateHouseRequest for adding a new house
@@ -97,6 +135,13 @@ type HouseholdResponse struct {
 	CreatedAt   time.Time       `json:"createdAt"`
 	UserEmail   string          `json:"userEmail,omitempty"` // Added for admin view
 	OwnerName   string          `json:"ownerName,omitempty"` // Added for admin view
+
+	// Returned once when the house is created; the meter signs readings with it
+	MeterSecret string `json:"meterSecret,omitempty"`
+
+	// Meter liveness, filled in by the house handlers
+	MeterState      MeterState `json:"meterState,omitempty"`
+	MeterLastSeenAt *time.Time `json:"meterLastSeenAt,omitempty"` // nil if the meter never reported
 }
 
 // ToResponse converts Household to HouseholdResponse
@@ -9,20 +9,27 @@ import (
 // Each prediction is linked to a household's smart meter and optionally logged
 // to the blockchain for immutable verification.
 type Prediction struct {
-	ID                  uint      `json:"id" gorm:"primaryKey;autoIncrement"`
-	UserID              uint      `json:"userId" gorm:"index;not null"`
-	HouseID             string    `json:"houseId" gorm:"column:house_id;index;not null;size:50"`
-	MeterID             string    `json:"meterId" gorm:"column:meter_id;index;not null;size:50"`
-	Timestamp           time.Time `json:"timestamp" gorm:"index;not null"`
-	Hour                int       `json:"hour" gorm:"not null"`        // 0-23
-	Temperature         float64   `json:"temperature" gorm:"not null"` // Celsius
-	ConsumptionKwh      float64   `json:"consumptionKwh" gorm:"column:consumption_kwh;not null"`
-	PredictedPrice      float64   `json:"predictedPrice" gorm:"column:predicted_price;not null"` // €/kWh
-	ActualPrice         float64   `json:"actualPrice" gorm:"column:actual_price"`                // Real market price
-	Confidence          int       `json:"confidence" gorm:"not null"`                            // 0-100%
-	BlockchainTx        string    `json:"blockchainTx" gorm:"column:blockchain_tx;index;size:100"`
-	BlockchainConfirmed bool      `json:"blockchainConfirmed" gorm:"column:blockchain_confirmed;default:false"`
-	CreatedAt           time.Time `json:"createdAt" gorm:"autoCreateTime"`
+	ID                  uint               `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReadingID           *uint              `json:"readingId" gorm:"column:reading_id;index"` // MeterReading the prediction was computed from
+	UserID              uint               `json:"userId" gorm:"index;not null"`
+	HouseID             string             `json:"houseId" gorm:"column:house_id;index;not null;size:50"`
+	MeterID             string             `json:"meterId" gorm:"column:meter_id;index;not null;size:50"`
+	Timestamp           time.Time          `json:"timestamp" gorm:"index;not null"`
+	Hour                int                `json:"hour" gorm:"not null"`        // 0-23
+	Temperature         float64            `json:"temperature" gorm:"not null"` // Celsius
+	ConsumptionKwh      float64            `json:"consumptionKwh" gorm:"column:consumption_kwh;not null"`
+	PredictedPrice      float64            `json:"predictedPrice" gorm:"column:predicted_price;not null"` // €/kWh
+	ActualPrice         float64            `json:"actualPrice" gorm:"column:actual_price"`                // Real market price
+	Confidence          int                `json:"confidence" gorm:"not null"`                            // 0-100%
+	ModelName           string             `json:"modelName" gorm:"column:model_name;index;size:50"`      // model that made the prediction, see ml.Predictor
+	ModelVersion        string             `json:"modelVersion" gorm:"column:model_version;size:20"`
+	Seed                int64              `json:"seed,string" gorm:"column:seed"`                      // seeds the model's RNG; 0 before predictions were reproducible
+	Features            *HouseholdFeatures `json:"features,omitempty" gorm:"serializer:json;type:text"` // household attributes the model read; nil before they were recorded
+	BlockchainTx        string             `json:"blockchainTx" gorm:"column:blockchain_tx;index;size:100"`
+	BlockchainConfirmed bool               `json:"blockchainConfirmed" gorm:"column:blockchain_confirmed;default:false"`
+	Signature           string             `json:"signature" gorm:"size:100"`                             // Ed25519, base64
+	SignatureKeyID      string             `json:"signatureKeyId" gorm:"column:signature_key_id;size:20"` // see SigningKey
+	CreatedAt           time.Time          `json:"createdAt" gorm:"autoCreateTime"`
 
 	// Relations
 	User      User      `json:"-" gorm:"foreignKey:UserID"`
@@ -33,6 +40,40 @@ func (Prediction) TableName() string {
 	return "predictions"
 }
 
+// HouseholdFeatures are the household attributes a price model reads. They
+// are recorded with each prediction, so it can be recomputed and explained
+// after the house is edited.
+type HouseholdFeatures struct {
+	Region      string      `json:"region"`
+	Members     int         `json:"members"`
+	HeatingType HeatingType `json:"heatingType"`
+	AreaSqm     float64     `json:"areaSqm"`
+	YearBuilt   int         `json:"yearBuilt"`
+}
+
+// FeaturesOf returns the price model attributes of a household
+func FeaturesOf(h *Household) *HouseholdFeatures {
+	return &HouseholdFeatures{
+		Region:      h.Region,
+		Members:     h.Members,
+		HeatingType: h.HeatingType,
+		AreaSqm:     h.AreaSqm,
+		YearBuilt:   h.YearBuilt,
+	}
+}
+
+// Household returns a household with only the recorded attributes set, as
+// the input of a price model
+func (f *HouseholdFeatures) Household() *Household {
+	return &Household{
+		Region:      f.Region,
+		Members:     f.Members,
+		HeatingType: f.HeatingType,
+		AreaSqm:     f.AreaSqm,
+		YearBuilt:   f.YearBuilt,
+	}
+}
+
 // BlockchainLog stores the details of blockchain transactions for predictions.
 // This provides an audit trail and verification mechanism.
 type BlockchainLog struct {
@@ -41,7 +82,8 @@ type BlockchainLog struct {
 	TransactionHash string     `json:"transactionHash" gorm:"column:transaction_hash;uniqueIndex;not null;size:100"`
 	BlockNumber     uint64     `json:"blockNumber" gorm:"column:block_number"`
 	GasUsed         uint64     `json:"gasUsed" gorm:"column:gas_used"`
-	Status          string     `json:"status" gorm:"size:20"` // pending, confirmed, failed
+	Status          string     `json:"status" gorm:"size:20"`           // pending, confirmed, failed
+	Error           string     `json:"error,omitempty" gorm:"size:500"` // last delivery or ledger error
 	ContractAddress string     `json:"contractAddress" gorm:"column:contract_address;size:100"`
 	LoggedAt        time.Time  `json:"loggedAt" gorm:"column:logged_at;autoCreateTime"`
 	ConfirmedAt     *time.Time `json:"confirmedAt" gorm:"column:confirmed_at"`
@@ -75,20 +117,28 @@ type PredictionOutput struct {
 
 // PredictionResponse is the full API response for a prediction
 type PredictionResponse struct {
-	ID                  uint    `json:"id"`
-	UserID              uint    `json:"userId"`
-	HouseID             string  `json:"houseId"`
-	MeterID             string  `json:"meterId"`
-	Timestamp           string  `json:"timestamp"`
-	Hour                int     `json:"hour"`
-	Temperature         float64 `json:"temperature"`
-	ConsumptionKwh      float64 `json:"consumptionKwh"`
-	PredictedPrice      float64 `json:"predictedPrice"`
-	ActualPrice         float64 `json:"actualPrice"`
-	Accuracy            float64 `json:"accuracy"` // 0-100%
-	Confidence          int     `json:"confidence"`
-	BlockchainTx        string  `json:"blockchainTx"`
-	BlockchainConfirmed bool    `json:"blockchainConfirmed"`
+	ID                  uint               `json:"id"`
+	ReadingID           *uint              `json:"readingId,omitempty"`
+	UserID              uint               `json:"userId"`
+	HouseID             string             `json:"houseId"`
+	MeterID             string             `json:"meterId"`
+	Timestamp           string             `json:"timestamp"`
+	Hour                int                `json:"hour"`
+	Temperature         float64            `json:"temperature"`
+	ConsumptionKwh      float64            `json:"consumptionKwh"`
+	PredictedPrice      float64            `json:"predictedPrice"`
+	ActualPrice         float64            `json:"actualPrice"`
+	Accuracy            float64            `json:"accuracy"` // 0-100%
+	Confidence          int                `json:"confidence"`
+	ModelName           string             `json:"modelName,omitempty"`
+	ModelVersion        string             `json:"modelVersion,omitempty"`
+	Seed                int64              `json:"seed,string,omitempty"` // a string, as it exceeds JavaScript's safe integers
+	Features            *HouseholdFeatures `json:"features,omitempty"`
+	Explanation         *PriceExplanation  `json:"explanation,omitempty"` // set on forecast entries
+	BlockchainTx        string             `json:"blockchainTx"`
+	BlockchainConfirmed bool               `json:"blockchainConfirmed"`
+	Signature           string             `json:"signature,omitempty"`
+	SignatureKeyID      string             `json:"signatureKeyId,omitempty"`
 }
 
 // ToResponse converts Prediction to PredictionResponse
@@ -104,6 +154,7 @@ func (p *Prediction) ToResponse() PredictionResponse {
 
 	return PredictionResponse{
 		ID:                  p.ID,
+		ReadingID:           p.ReadingID,
 		UserID:              p.UserID,
 		HouseID:             p.HouseID,
 		MeterID:             p.MeterID,
@@ -115,11 +166,36 @@ func (p *Prediction) ToResponse() PredictionResponse {
 		ActualPrice:         p.ActualPrice,
 		Accuracy:            math.Round(accuracy*100) / 100,
 		Confidence:          p.Confidence,
+		ModelName:           p.ModelName,
+		ModelVersion:        p.ModelVersion,
+		Seed:                p.Seed,
+		Features:            p.Features,
 		BlockchainTx:        p.BlockchainTx,
 		BlockchainConfirmed: p.BlockchainConfirmed,
+		Signature:           p.Signature,
+		SignatureKeyID:      p.SignatureKeyID,
 	}
 }
 
+// PriceFactor is one factor of an explained price. Value is the multiplier
+// the factor applied; Contribution is its share of the difference between
+// the price and the base price in €/kWh, so contributions add up to that
+// difference.
+type PriceFactor struct {
+	Name         string  `json:"name"` // region, members, area, efficiency, season, timeBand, weather, consumption, volatility
+	Value        float64 `json:"value"`
+	Contribution float64 `json:"contribution"`
+	Detail       string  `json:"detail"` // the input the factor was derived from
+}
+
+// PriceExplanation breaks a predicted price down into the base price and
+// the factors the model multiplied it by
+type PriceExplanation struct {
+	BasePrice float64       `json:"basePrice"` // €/kWh
+	Factors   []PriceFactor `json:"factors"`
+	Price     float64       `json:"price"`
+}
+
 // PredictionQuery contains filters for querying predictions
 type PredictionQuery struct {
 	HouseID   string `form:"houseId"`
@@ -140,6 +216,15 @@ type StatisticsResponse struct {
 	LastPredictionAt    string  `json:"lastPredictionAt"`
 }
 
+// ModelAccuracy is the average accuracy of the predictions of one model
+// version. Predictions made before models were versioned have an empty name.
+type ModelAccuracy struct {
+	ModelName       string  `json:"modelName"`
+	ModelVersion    string  `json:"modelVersion"`
+	Predictions     int64   `json:"predictions"`
+	AverageAccuracy float64 `json:"averageAccuracy"`
+}
+
 // AdminDashboardResponse contains system-wide statistics for admins
 type AdminDashboardResponse struct {
 	TotalUsers          int64                `json:"totalUsers"`
@@ -150,13 +235,17 @@ type AdminDashboardResponse struct {
 	RecentPredictions   []PredictionResponse `json:"recentPredictions"`
 	SystemHealth        string               `json:"systemHealth"`
 	ServiceStatus       map[string]string    `json:"serviceStatus"`
+	MeterStates         map[MeterState]int64 `json:"meterStates"`   // meters of active houses per liveness state
+	OfflineMeters       []MeterStatus        `json:"offlineMeters"` // most recent offline transitions
 	// Extended Analytics
-	AverageAccuracy     float64 `json:"averageAccuracy"`
-	TotalEnergyConsumed float64 `json:"totalEnergyConsumed"`
-	PeakUsageHour       int     `json:"peakUsageHour"`
-	AvgDailyPredictions float64 `json:"avgDailyPredictions"`
-	SystemUptime        string  `json:"systemUptime"`
-	NewUsersToday       int64   `json:"newUsersToday"`
-	ArchivedHouseholds  int64   `json:"archivedHouseholds"`
-	PendingBlockchain   int64   `json:"pendingBlockchain"`
+	AverageAccuracy     float64         `json:"averageAccuracy"`
+	ModelAccuracy       []ModelAccuracy `json:"modelAccuracy"` // accuracy per model version
+	TotalEnergyConsumed float64         `json:"totalEnergyConsumed"`
+	PeakUsageHour       int             `json:"peakUsageHour"`
+	AvgDailyPredictions float64         `json:"avgDailyPredictions"`
+	SystemUptime        string          `json:"systemUptime"`
+	NewUsersToday       int64           `json:"newUsersToday"`
+	ArchivedHouseholds  int64           `json:"archivedHouseholds"`
+	PendingBlockchain   int64           `json:"pendingBlockchain"`
+	FailedBlockchain    int64           `json:"failedBlockchain"` // outbox entries that ran out of retries
 }
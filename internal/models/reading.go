@@ -0,0 +1,128 @@
+package models
+
+import "time"
+
+// Ingest channels a meter reading can arrive through
+const (
+	ChannelMQTT = "mqtt"
+	ChannelHTTP = "http"
+)
+
+// MeterReading is a raw reading reported by a smart meter.
+// Every accepted reading is stored, even when no prediction is made for it
+// (unknown meter, archived house, prediction failure). Redeliveries of the
+// same reading are rejected by the unique DedupeKey.
+type MeterReading struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	MeterID        string    `json:"meterId" gorm:"column:meter_id;index:idx_reading_meter_time;not null;size:50"`
+	MessageID      string    `json:"messageId,omitempty" gorm:"column:message_id;size:100"` // optional, sent by the meter
+	DedupeKey      string    `json:"-" gorm:"column:dedupe_key;uniqueIndex;size:200"`       // see mqtt.dedupeKey
+	HouseID        string    `json:"houseId" gorm:"column:house_id;index;size:50"`          // empty for unknown meters
+	Timestamp      time.Time `json:"timestamp" gorm:"index:idx_reading_meter_time;not null"`
+	ConsumptionKwh float64   `json:"consumptionKwh" gorm:"column:consumption_kwh;not null"`
+	RegisterKwh    *float64  `json:"registerKwh,omitempty" gorm:"column:register_kwh"` // cumulative meter register, if sent
+	Temperature    float64   `json:"temperature"`                                      // Celsius
+	Channel        string    `json:"channel" gorm:"size:20;not null"`
+	Flags          string    `json:"flags,omitempty" gorm:"size:100"` // see Flag* constants
+	ReceivedAt     time.Time `json:"receivedAt" gorm:"column:received_at;not null"`
+}
+
+func (MeterReading) TableName() string {
+	return "meter_readings"
+}
+
+// ReadingQuery for filtering meter readings.
+// From and To are RFC 3339 timestamps or dates (YYYY-MM-DD).
+type ReadingQuery struct {
+	From  string `form:"from"`
+	To    string `form:"to"`
+	Page  int    `form:"page,default=1"`
+	Limit int    `form:"limit,default=100"`
+}
+
+// Reasons a meter message is dead-lettered
+const (
+	ReasonInvalidPayload   = "invalid_payload"
+	ReasonMissingMeterID   = "missing_meter_id"
+	ReasonUnknownMeter     = "unknown_meter"
+	ReasonInactiveHouse    = "inactive_house"
+	ReasonInvalidTimestamp = "invalid_timestamp"
+	ReasonFutureTimestamp  = "future_timestamp"
+	ReasonTooLate          = "too_late"
+	ReasonMeterMismatch    = "meter_mismatch"
+	ReasonStorageError     = "storage_error"
+)
+
+// DeadLetter is a meter message that was rejected during ingestion.
+// The raw payload is kept so it can be re-processed once the cause is fixed
+// (e.g. a meter is assigned to a house), or purged.
+type DeadLetter struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Channel     string    `json:"channel" gorm:"size:20;not null"`
+	Topic       string    `json:"topic" gorm:"size:200"` // empty for HTTP
+	MeterID     string    `json:"meterId" gorm:"column:meter_id;index;size:50"`
+	Payload     string    `json:"payload" gorm:"type:text"`
+	ContentType string    `json:"contentType,omitempty" gorm:"size:50"` // payload format; CBOR payloads are stored base64 encoded
+	Reason      string    `json:"reason" gorm:"size:30;index;not null"`
+	Detail      string    `json:"detail" gorm:"size:500"`
+	ReadingID   *uint     `json:"readingId,omitempty" gorm:"column:reading_id"` // stored MeterReading, if parsing succeeded
+	Attempts    int       `json:"attempts" gorm:"default:0"`                    // re-process attempts
+	CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// Quality flags set on accepted meter readings (comma-separated in Flags)
+const (
+	FlagLate          = "late"           // older than the meter's newest reading
+	FlagEstimatedTime = "estimated_time" // no timestamp sent, receive time used
+	FlagFuture        = "future"         // ahead of the server clock beyond the allowed skew
+	FlagBaseline      = "baseline"       // first register reading of a meter, no interval to derive
+	FlagRollover      = "rollover"       // register wrapped to zero, consumption includes the wrap
+	FlagRegisterReset = "register_reset" // register fell back near zero, e.g. the meter was replaced
+	FlagNegativeDelta = "negative_delta" // register went down without a rollover or reset
+	FlagImplausible   = "implausible"    // register rose faster than a household can consume
+	FlagLateRegister  = "late_register"  // register older than a stored one, whose interval already counts it
+)
+
+// ReadingGap records readings a meter skipped. Start and End are the
+// readings either side of the gap.
+type ReadingGap struct {
+	ID              uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	MeterID         string    `json:"meterId" gorm:"column:meter_id;index;not null;size:50"`
+	HouseID         string    `json:"houseId" gorm:"column:house_id;index;size:50"`
+	Start           time.Time `json:"start" gorm:"column:gap_start;index;not null"`
+	End             time.Time `json:"end" gorm:"column:gap_end;not null"`
+	MissingReadings int       `json:"missingReadings" gorm:"column:missing_readings"`
+	DetectedAt      time.Time `json:"detectedAt" gorm:"column:detected_at;autoCreateTime"`
+}
+
+func (ReadingGap) TableName() string {
+	return "reading_gaps"
+}
+
+// MeterState is the liveness state of a smart meter
+type MeterState string
+
+const (
+	MeterOnline  MeterState = "online"  // reported within the stale threshold
+	MeterStale   MeterState = "stale"   // late, but not yet considered offline
+	MeterOffline MeterState = "offline" // silent past the offline threshold, or announced by its Last Will
+)
+
+// MeterStatus tracks when a household's meter was last heard from.
+// A meter without a status has never reported and counts as offline.
+type MeterStatus struct {
+	MeterID        string     `json:"meterId" gorm:"primaryKey;column:meter_id;size:50"`
+	HouseID        string     `json:"houseId" gorm:"column:house_id;index;size:50"`
+	State          MeterState `json:"state" gorm:"type:varchar(20);index;not null"`
+	LastSeenAt     time.Time  `json:"lastSeenAt" gorm:"column:last_seen_at"`
+	StateChangedAt time.Time  `json:"stateChangedAt" gorm:"column:state_changed_at"`
+	Reason         string     `json:"reason,omitempty" gorm:"size:100"` // why the meter left the online state
+}
+
+func (MeterStatus) TableName() string {
+	return "meter_status"
+}
@@ -91,6 +91,10 @@ type LoginResponse struct {
 	Token     string `json:"token"`
 	ExpiresAt int64  `json:"expiresAt"`
 	User      User   `json:"user"`
+
+	// Set on registration only: the initial house's meter and its secret
+	MeterID     string `json:"meterId,omitempty"`
+	MeterSecret string `json:"meterSecret,omitempty"`
 }
 
 // UpdateProfileRequest allows users to update their profile
@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// rejectReading builds the rejection for a stored reading whose meter is
+// unknown or belongs to an archived house
+func rejectReading(source Source, reading *models.MeterReading, household *models.Household) rejection {
+	readingID := reading.ID
+	r := rejection{
+		source:    source,
+		meterID:   reading.MeterID,
+		readingID: &readingID,
+		reason:    models.ReasonUnknownMeter,
+		detail:    fmt.Sprintf("no household has meter %s", reading.MeterID),
+	}
+	if household != nil {
+		r.reason = models.ReasonInactiveHouse
+		r.detail = fmt.Sprintf("meter %s belongs to %s house %s", reading.MeterID, household.Status, household.ID)
+	}
+	return r
+}
+
+// saveDeadLetters stores rejected messages in the dead-letter table
+func saveDeadLetters(rejected []rejection) {
+	if len(rejected) == 0 {
+		return
+	}
+
+	letters := make([]models.DeadLetter, len(rejected))
+	for i, r := range rejected {
+		letters[i] = models.DeadLetter{
+			Channel:     r.source.Channel,
+			Topic:       r.source.Topic,
+			MeterID:     r.meterID,
+			Payload:     encodePayload(r.source),
+			ContentType: r.source.Format,
+			Reason:      r.reason,
+			Detail:      r.detail,
+			ReadingID:   r.readingID,
+		}
+	}
+	if err := database.DB.Create(&letters).Error; err != nil {
+		log.Printf("Failed to save %d dead letters: %v", len(letters), err)
+	}
+}
+
+// encodePayload returns a message payload as stored in a dead letter
+func encodePayload(source Source) string {
+	if source.Format == FormatCBOR {
+		return base64.StdEncoding.EncodeToString(source.Payload)
+	}
+	return string(source.Payload)
+}
+
+// decodePayload returns the raw message payload of a dead letter
+func decodePayload(letter *models.DeadLetter) ([]byte, error) {
+	if letter.ContentType == FormatCBOR {
+		return base64.StdEncoding.DecodeString(letter.Payload)
+	}
+	return []byte(letter.Payload), nil
+}
+
+// ReprocessDeadLetter runs a dead-lettered message through ingestion again.
+// Messages whose reading was already stored get a prediction for that
+// reading; others are parsed and ingested from the raw payload. On success
+// the dead letter is deleted; otherwise it is updated with the new reason
+// and an error is returned.
+func ReprocessDeadLetter(letter *models.DeadLetter) error {
+	var rejected []rejection
+	if letter.ReadingID != nil {
+		r, err := reprocessReading(letter)
+		if err != nil {
+			return err
+		}
+		if r != nil {
+			rejected = append(rejected, *r)
+		}
+	} else {
+		rejected = reprocessPayload(letter)
+	}
+
+	if len(rejected) == 0 {
+		return database.DB.Delete(letter).Error
+	}
+
+	// A batch still failing in part keeps one dead letter per rejected reading
+	r := rejected[0]
+	if len(r.source.Payload) > 0 {
+		letter.Payload = encodePayload(r.source)
+		letter.ContentType = r.source.Format
+	}
+	saveDeadLetters(rejected[1:])
+	letter.Attempts++
+	letter.Reason = r.reason
+	letter.Detail = r.detail
+	if r.meterID != "" {
+		letter.MeterID = r.meterID
+	}
+	if r.readingID != nil {
+		letter.ReadingID = r.readingID
+	}
+	if err := database.DB.Save(letter).Error; err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: %s", r.reason, r.detail)
+}
+
+// reprocessPayload parses a dead-lettered message and ingests its readings
+func reprocessPayload(letter *models.DeadLetter) []rejection {
+	payload, err := decodePayload(letter)
+	if err != nil {
+		return []rejection{{reason: models.ReasonInvalidPayload, detail: err.Error()}}
+	}
+	format := letter.ContentType
+	if format == "" {
+		format = FormatJSON
+	}
+	var readings []MeterData
+	// SenML and DSMR carry no usable meter ID: over MQTT it is in the topic,
+	// over HTTP the letter keeps the signing meter
+	meterID := letter.MeterID
+	if letter.Channel != models.ChannelHTTP && letter.Topic != "" {
+		meterID, _ = parseMeterTopic(letter.Topic)
+	}
+	switch format {
+	case FormatSenML:
+		readings, err = DecodeSenML(payload, meterID, letter.CreatedAt)
+	case FormatDSMR:
+		readings, err = DecodeDSMR(payload, meterID)
+	default:
+		readings, err = DecodeReadings(payload, format)
+	}
+	if err != nil {
+		return []rejection{{reason: models.ReasonInvalidPayload, detail: err.Error()}}
+	}
+
+	source := Source{Channel: letter.Channel, Topic: letter.Topic, Payload: payload, Format: format}
+	sources := readingSources(source, readings)
+	var rejected []rejection
+	items := make([]ingestItem, 0, len(readings))
+	now := time.Now()
+	for i := range readings {
+		if r := checkTopicMeter(sources[i], readings[i].MeterID); r != nil {
+			rejected = append(rejected, *r)
+			continue
+		}
+		items = append(items, ingestItem{data: readings[i], source: sources[i], receivedAt: now})
+	}
+	if len(items) > 0 {
+		batchRejected, err := processBatch(items)
+		if err != nil {
+			return append(rejected, rejection{source: source, reason: models.ReasonStorageError, detail: err.Error()})
+		}
+		rejected = append(rejected, batchRejected...)
+	}
+	return rejected
+}
+
+// reprocessReading creates the prediction for an already stored reading.
+// Readings that already have a prediction, or whose register reading is an
+// anomaly, are resolved without predicting. Returns a rejection if the
+// meter still has no active household.
+func reprocessReading(letter *models.DeadLetter) (*rejection, error) {
+	var reading models.MeterReading
+	if err := database.DB.First(&reading, *letter.ReadingID).Error; err != nil {
+		return nil, fmt.Errorf("reading %d not found", *letter.ReadingID)
+	}
+
+	var household models.Household
+	result := database.DB.Where("meter_id = ?", reading.MeterID).Limit(1).Find(&household)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// Keep the stored payload as it is if the reading is rejected again
+	source := Source{Channel: letter.Channel, Topic: letter.Topic}
+	if result.RowsAffected == 0 {
+		r := rejectReading(source, &reading, nil)
+		return &r, nil
+	}
+	if household.Status != models.StatusActive {
+		r := rejectReading(source, &reading, &household)
+		return &r, nil
+	}
+
+	if reading.HouseID != household.ID {
+		if err := database.DB.Model(&reading).Update("house_id", household.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// A reading is predicted at most once, and register anomalies never
+	var predicted int64
+	if err := database.DB.Model(&models.Prediction{}).Where("reading_id = ?", reading.ID).Count(&predicted).Error; err != nil {
+		return nil, err
+	}
+	if predicted > 0 {
+		log.Printf("Reading %d already has a prediction, not predicting it again", reading.ID)
+		return nil, nil
+	}
+	if !hasDerivedConsumption(&reading) {
+		log.Printf("Reading %d has no derived consumption (flags %q), nothing to predict", reading.ID, reading.Flags)
+		return nil, nil
+	}
+
+	byMeter := map[string]*models.Household{reading.MeterID: &household}
+	return nil, savePredictions([]models.Prediction{predictReading(&household, &reading)}, byMeter)
+}
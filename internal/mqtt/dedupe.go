@@ -0,0 +1,100 @@
+package mqtt
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// duplicateReadings counts readings skipped because they were already stored
+var duplicateReadings atomic.Uint64
+
+// dedupeKey identifies a reading across redeliveries. Meters that send a
+// message ID are deduplicated on it; otherwise on meter and timestamp.
+func dedupeKey(meterID, messageID string, timestamp time.Time) string {
+	if messageID != "" {
+		return fmt.Sprintf("msg|%s|%s", meterID, messageID)
+	}
+	return fmt.Sprintf("ts|%s|%s", meterID, timestamp.UTC().Format(time.RFC3339Nano))
+}
+
+// DuplicateCount returns how many duplicate readings have been skipped
+func DuplicateCount() uint64 {
+	return duplicateReadings.Load()
+}
+
+// skipDuplicates returns the readings that have not been seen before, with
+// their sources. Duplicates, within the batch or of stored readings, are
+// counted and skipped.
+func skipDuplicates(readings []models.MeterReading, sources []Source) ([]models.MeterReading, []Source, error) {
+	keys := make([]string, len(readings))
+	for i := range readings {
+		keys[i] = readings[i].DedupeKey
+	}
+
+	var stored []string
+	if err := database.DB.Model(&models.MeterReading{}).Where("dedupe_key IN ?", keys).Pluck("dedupe_key", &stored).Error; err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool, len(readings))
+	for _, key := range stored {
+		seen[key] = true
+	}
+
+	fresh := make([]models.MeterReading, 0, len(readings))
+	freshSources := make([]Source, 0, len(readings))
+	for i := range readings {
+		if seen[readings[i].DedupeKey] {
+			countDuplicate(&readings[i])
+			continue
+		}
+		seen[readings[i].DedupeKey] = true
+		fresh = append(fresh, readings[i])
+		freshSources = append(freshSources, sources[i])
+	}
+	return fresh, freshSources, nil
+}
+
+// insertReadings stores readings that passed skipDuplicates and returns the
+// ones inserted, with their sources. The unique index on dedupe_key catches
+// a duplicate stored concurrently by another worker.
+func insertReadings(fresh []models.MeterReading, freshSources []Source) ([]models.MeterReading, []Source, error) {
+	if len(fresh) == 0 {
+		return fresh, freshSources, nil
+	}
+
+	if err := database.DB.Create(&fresh).Error; err == nil {
+		return fresh, freshSources, nil
+	}
+
+	// A concurrent insert won the race for one of the keys; store the
+	// readings one by one so only the duplicates are skipped
+	inserted := fresh[:0]
+	insertedSources := freshSources[:0]
+	for i := range fresh {
+		reading := fresh[i]
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reading)
+		if result.Error != nil {
+			return nil, nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			countDuplicate(&reading)
+			continue
+		}
+		inserted = append(inserted, reading)
+		insertedSources = append(insertedSources, freshSources[i])
+	}
+	return inserted, insertedSources, nil
+}
+
+// countDuplicate records a skipped duplicate reading
+func countDuplicate(reading *models.MeterReading) {
+	duplicateReadings.Add(1)
+	log.Printf("Skipping duplicate reading from %s at %s", reading.MeterID, reading.Timestamp.Format(time.RFC3339))
+}
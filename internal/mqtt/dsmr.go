@@ -0,0 +1,92 @@
+package mqtt
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"energy-prediction/internal/dsmr"
+	"energy-prediction/internal/models"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// FormatDSMR is the content type of DSMR P1 telegrams, which are plain text
+const FormatDSMR = "text/plain"
+
+// defaultDSMRTopic receives P1 telegrams, one topic per meter
+const defaultDSMRTopic = "energy/dsmr/+"
+
+// dsmrTopic returns the DSMR subscription.
+//
+// Configuration:
+//   - MQTT_DSMR_TOPIC: DSMR P1 telegram topic (default energy/dsmr/+)
+func dsmrTopic() string {
+	if topic := os.Getenv("MQTT_DSMR_TOPIC"); topic != "" {
+		return topic
+	}
+	return defaultDSMRTopic
+}
+
+// subscribeToDSMR subscribes to P1 telegrams with QoS 1
+func subscribeToDSMR(client pahomqtt.Client, topic string) {
+	token := client.Subscribe(topic, 1, handleDSMR)
+	if token.Wait() && token.Error() != nil {
+		log.Printf("Failed to subscribe to topic %s: %v", topic, token.Error())
+	} else {
+		log.Printf("✓ Subscribed to DSMR topic: %s", topic)
+	}
+}
+
+// handleDSMR processes P1 telegrams received via MQTT
+func handleDSMR(client pahomqtt.Client, msg pahomqtt.Message) {
+	HandleDSMRMessage(msg.Topic(), msg.Payload())
+}
+
+// HandleDSMRMessage parses a P1 telegram received on energy/dsmr/{meterId}
+// and feeds its reading into ingestion. Telegrams that fail the CRC or
+// cannot be parsed are dead-lettered.
+func HandleDSMRMessage(topic string, payload []byte) {
+	log.Printf("Received DSMR telegram from topic %s", topic)
+
+	meterID, _ := parseMeterTopic(topic)
+	source := Source{Channel: models.ChannelMQTT, Topic: topic, Payload: payload, Format: FormatDSMR}
+
+	readings, err := DecodeDSMR(payload, meterID)
+	if err != nil {
+		log.Printf("Failed to parse DSMR telegram: %v", err)
+		saveDeadLetters([]rejection{{source: source, meterID: meterID, reason: models.ReasonInvalidPayload, detail: err.Error()}})
+		return
+	}
+
+	if SubmitReadings(readings, source) == 0 {
+		log.Printf("Ingestion queue full, dropped reading from %s", meterID)
+	}
+}
+
+// DecodeDSMR parses a P1 telegram into a reading of meterID
+func DecodeDSMR(payload []byte, meterID string) ([]MeterData, error) {
+	if meterID == "" {
+		return nil, errors.New("no meter ID for DSMR telegram")
+	}
+	telegram, err := dsmr.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []MeterData{TelegramReading(meterID, telegram)}, nil
+}
+
+// TelegramReading turns a telegram into a reading. The import register of
+// both tariffs becomes the cumulative register, so the interval consumption
+// is derived from the meter's previous telegram. The timestamp keeps the
+// meter's offset so the prediction is banded by its local hour. P1 carries
+// no temperature.
+func TelegramReading(meterID string, telegram *dsmr.Telegram) MeterData {
+	register := telegram.ImportKwh()
+	data := MeterData{MeterID: meterID, RegisterKwh: &register}
+	if !telegram.Timestamp.IsZero() {
+		data.Timestamp = telegram.Timestamp.Format(time.RFC3339)
+	}
+	return data
+}
@@ -0,0 +1,177 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Payload formats, named by their content type
+const (
+	FormatJSON = "application/json"
+	FormatCBOR = "application/cbor"
+)
+
+// maxPayloadReadings limits how many readings a single payload may carry
+const maxPayloadReadings = 1000
+
+// topicFormats maps an optional meter topic suffix to its payload format:
+// energy/meters/{meterId}/cbor
+var topicFormats = map[string]string{
+	"json": FormatJSON,
+	"cbor": FormatCBOR,
+}
+
+// cborHandle decodes CBOR payloads; fields use the same names as in JSON
+var cborHandle = &codec.CborHandle{}
+
+// CompactBatch carries readings of one meter relative to a base time, for
+// meters on constrained links:
+//
+//	{"m": "household_1", "t": 1736496000, "r": [[0, 1.2, 4.5], [900, 0.9, 4.4]]}
+//
+// Each row is [seconds since the previous reading (the first: since t),
+// consumption in kWh, temperature in °C (optional)].
+type CompactBatch struct {
+	MeterID string      `json:"m"`
+	Base    int64       `json:"t"` // Unix seconds
+	Rows    [][]float64 `json:"r"`
+}
+
+// payloadObject is a decoded JSON or CBOR object: either a single reading
+// or, if it has rows, a compact batch
+type payloadObject struct {
+	MeterData
+	CompactBatch
+}
+
+// FormatForContentType returns the payload format of an HTTP content type.
+// An empty content type is treated as JSON.
+func FormatForContentType(contentType string) (string, error) {
+	if contentType == "" {
+		return FormatJSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q", contentType)
+	}
+	switch mediaType {
+	case FormatJSON, FormatCBOR:
+		return mediaType, nil
+	default:
+		return "", fmt.Errorf("unsupported content type %q, use %s or %s", mediaType, FormatJSON, FormatCBOR)
+	}
+}
+
+// parseMeterTopic splits a meter topic into the meter ID and the payload
+// format: energy/meters/{meterId} is JSON, energy/meters/{meterId}/cbor CBOR
+func parseMeterTopic(topic string) (meterID, format string) {
+	segments := strings.Split(topic, "/")
+	last := segments[len(segments)-1]
+	if f, ok := topicFormats[last]; ok && len(segments) > 1 {
+		return segments[len(segments)-2], f
+	}
+	return last, FormatJSON
+}
+
+// DecodeReadings decodes a meter payload. JSON and CBOR payloads may hold a
+// single reading, an array of readings or a CompactBatch; all are returned
+// as MeterData.
+func DecodeReadings(payload []byte, format string) ([]MeterData, error) {
+	var (
+		isArray bool
+		decode  func(v interface{}) error
+	)
+	switch format {
+	case FormatJSON:
+		trimmed := bytes.TrimSpace(payload)
+		if len(trimmed) == 0 {
+			return nil, errors.New("empty payload")
+		}
+		isArray = trimmed[0] == '['
+		decode = func(v interface{}) error { return json.Unmarshal(trimmed, v) }
+	case FormatCBOR:
+		if len(payload) == 0 {
+			return nil, errors.New("empty payload")
+		}
+		// The major type in the top 3 bits tells arrays (4) from maps (5)
+		switch payload[0] >> 5 {
+		case 4:
+			isArray = true
+		case 5:
+		default:
+			return nil, errors.New("CBOR payload must be a map or an array")
+		}
+		decode = func(v interface{}) error { return codec.NewDecoderBytes(payload, cborHandle).Decode(v) }
+	default:
+		return nil, fmt.Errorf("unsupported payload format %q", format)
+	}
+
+	if isArray {
+		var readings []MeterData
+		if err := decode(&readings); err != nil {
+			return nil, err
+		}
+		if len(readings) == 0 {
+			return nil, errors.New("empty reading array")
+		}
+		if len(readings) > maxPayloadReadings {
+			return nil, fmt.Errorf("payload has %d readings, at most %d are allowed", len(readings), maxPayloadReadings)
+		}
+		return readings, nil
+	}
+
+	var object payloadObject
+	if err := decode(&object); err != nil {
+		return nil, err
+	}
+	if object.Rows == nil {
+		return []MeterData{object.MeterData}, nil
+	}
+	return object.CompactBatch.expand()
+}
+
+// expand turns a compact batch into readings
+func (b *CompactBatch) expand() ([]MeterData, error) {
+	if b.MeterID == "" {
+		return nil, errors.New("compact batch without meter ID (m)")
+	}
+	if b.Base <= 0 {
+		return nil, errors.New("compact batch without base time (t)")
+	}
+	if len(b.Rows) == 0 {
+		return nil, errors.New("compact batch without readings (r)")
+	}
+	if len(b.Rows) > maxPayloadReadings {
+		return nil, fmt.Errorf("payload has %d readings, at most %d are allowed", len(b.Rows), maxPayloadReadings)
+	}
+
+	readings := make([]MeterData, len(b.Rows))
+	at := time.Unix(b.Base, 0).UTC()
+	for i, row := range b.Rows {
+		if len(row) < 2 || len(row) > 3 {
+			return nil, fmt.Errorf("row %d: expected [delta, consumptionKwh] or [delta, consumptionKwh, temperature]", i)
+		}
+		if row[0] < 0 || row[0] != math.Trunc(row[0]) {
+			return nil, fmt.Errorf("row %d: delta must be a non-negative number of seconds", i)
+		}
+		at = at.Add(time.Duration(row[0]) * time.Second)
+
+		readings[i] = MeterData{
+			MeterID:        b.MeterID,
+			Timestamp:      at.Format(time.RFC3339),
+			ConsumptionKwh: row[1],
+		}
+		if len(row) == 3 {
+			readings[i].Temperature = row[2]
+		}
+	}
+	return readings, nil
+}
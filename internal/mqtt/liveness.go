@@ -0,0 +1,272 @@
+package mqtt
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"energy-prediction/internal/config"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Liveness defaults, overridable via environment variables
+const (
+	defaultStaleAfter    = 30 * time.Minute
+	defaultOfflineAfter  = 2 * time.Hour
+	defaultLivenessCheck = time.Minute
+	defaultStatusTopic   = "energy/status/+"
+)
+
+// Payloads meters publish on their status topic. Meters set "offline" as
+// their MQTT Last Will, so the broker announces them when they drop off.
+const (
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// livenessThresholds decide when a silent meter turns stale and offline
+type livenessThresholds struct {
+	staleAfter   time.Duration
+	offlineAfter time.Duration
+}
+
+var (
+	liveness = livenessThresholds{
+		staleAfter:   defaultStaleAfter,
+		offlineAfter: defaultOfflineAfter,
+	}
+
+	// livenessMu serializes state transitions between ingestion workers,
+	// status messages and the monitor
+	livenessMu sync.Mutex
+)
+
+// LivenessMonitor periodically moves silent meters to stale and offline
+type LivenessMonitor struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// StartLivenessMonitor starts checking meter liveness.
+//
+// Configuration:
+//   - METER_STALE_AFTER: silence after which a meter is stale (default 30m)
+//   - METER_OFFLINE_AFTER: silence after which a meter is offline (default 2h)
+//   - METER_LIVENESS_INTERVAL: how often meters are checked (default 1m)
+func StartLivenessMonitor() *LivenessMonitor {
+	liveness = livenessThresholds{
+		staleAfter:   config.Duration("METER_STALE_AFTER", defaultStaleAfter),
+		offlineAfter: config.Duration("METER_OFFLINE_AFTER", defaultOfflineAfter),
+	}
+	if liveness.offlineAfter < liveness.staleAfter {
+		log.Printf("Warning: METER_OFFLINE_AFTER is shorter than METER_STALE_AFTER, using %v for both", liveness.staleAfter)
+		liveness.offlineAfter = liveness.staleAfter
+	}
+
+	m := &LivenessMonitor{
+		interval: config.Duration("METER_LIVENESS_INTERVAL", defaultLivenessCheck),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go m.run()
+
+	log.Printf("✓ Meter liveness monitor started (stale after %v, offline after %v)", liveness.staleAfter, liveness.offlineAfter)
+	return m
+}
+
+// Stop stops the monitor and waits for the current check to finish
+func (m *LivenessMonitor) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+		<-m.done
+	})
+}
+
+// run checks meter liveness every interval
+func (m *LivenessMonitor) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if _, err := CheckLiveness(now); err != nil {
+				log.Printf("Failed to check meter liveness: %v", err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// stateAfter returns the state of a meter that has been silent since lastSeen
+func stateAfter(lastSeen, now time.Time) models.MeterState {
+	silent := now.Sub(lastSeen)
+	switch {
+	case silent >= liveness.offlineAfter:
+		return models.MeterOffline
+	case silent >= liveness.staleAfter:
+		return models.MeterStale
+	default:
+		return models.MeterOnline
+	}
+}
+
+// CheckLiveness moves meters that have been silent too long to stale or
+// offline and returns how many changed state
+func CheckLiveness(now time.Time) (int, error) {
+	livenessMu.Lock()
+	defer livenessMu.Unlock()
+
+	var statuses []models.MeterStatus
+	if err := database.DB.Where("state <> ?", models.MeterOffline).Find(&statuses).Error; err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for i := range statuses {
+		status := &statuses[i]
+		state := stateAfter(status.LastSeenAt, now)
+		if state == status.State {
+			continue
+		}
+
+		silent := now.Sub(status.LastSeenAt).Round(time.Second)
+		status.State = state
+		status.StateChangedAt = now
+		status.Reason = "no readings for " + silent.String()
+		if err := database.DB.Save(status).Error; err != nil {
+			return changed, err
+		}
+		log.Printf("Meter %s is %s: last seen %v ago", status.MeterID, state, silent)
+		changed++
+	}
+	return changed, nil
+}
+
+// markSeen records that the meters of stored readings are alive. Readings of
+// meters without a household are not tracked.
+func markSeen(readings []models.MeterReading) {
+	latest := make(map[string]*models.MeterReading)
+	for i := range readings {
+		reading := &readings[i]
+		if reading.HouseID == "" {
+			continue
+		}
+		if seen, ok := latest[reading.MeterID]; !ok || reading.ReceivedAt.After(seen.ReceivedAt) {
+			latest[reading.MeterID] = reading
+		}
+	}
+	for meterID, reading := range latest {
+		if err := setMeterOnline(meterID, reading.HouseID, reading.ReceivedAt); err != nil {
+			log.Printf("Failed to update liveness of meter %s: %v", meterID, err)
+		}
+	}
+}
+
+// setMeterOnline records a sign of life from a meter
+func setMeterOnline(meterID, houseID string, seenAt time.Time) error {
+	livenessMu.Lock()
+	defer livenessMu.Unlock()
+
+	var status models.MeterStatus
+	result := database.DB.Where("meter_id = ?", meterID).Limit(1).Find(&status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 && !seenAt.After(status.LastSeenAt) {
+		return nil
+	}
+
+	if status.State != models.MeterOnline {
+		if result.RowsAffected > 0 {
+			log.Printf("✓ Meter %s is back online after being %s", meterID, status.State)
+		}
+		status.State = models.MeterOnline
+		status.StateChangedAt = seenAt
+		status.Reason = ""
+	}
+	status.MeterID = meterID
+	status.HouseID = houseID
+	status.LastSeenAt = seenAt
+	return database.DB.Save(&status).Error
+}
+
+// setMeterOffline marks a meter offline right away, e.g. when the broker
+// publishes its Last Will
+func setMeterOffline(meterID, reason string, now time.Time) error {
+	livenessMu.Lock()
+	defer livenessMu.Unlock()
+
+	var status models.MeterStatus
+	result := database.DB.Where("meter_id = ?", meterID).Limit(1).Find(&status)
+	if result.Error != nil || result.RowsAffected == 0 {
+		// Unknown to liveness tracking: it has never reported anyway
+		return result.Error
+	}
+	if status.State == models.MeterOffline {
+		return nil
+	}
+
+	status.State = models.MeterOffline
+	status.StateChangedAt = now
+	status.Reason = reason
+	log.Printf("Meter %s is offline: %s", meterID, reason)
+	return database.DB.Save(&status).Error
+}
+
+// HandleMeterStatus applies a message from a meter's status topic
+// (energy/status/{meterId}): "offline" (usually the meter's Last Will) marks
+// the meter offline, "online" counts as a sign of life.
+func HandleMeterStatus(topic string, payload []byte, now time.Time) {
+	meterID := topic[strings.LastIndex(topic, "/")+1:]
+	if meterID == "" {
+		log.Printf("Ignoring status message without meter ID on %s", topic)
+		return
+	}
+
+	var err error
+	switch state := strings.ToLower(strings.TrimSpace(string(payload))); state {
+	case statusOffline:
+		err = setMeterOffline(meterID, "last will received", now)
+	case statusOnline:
+		var household models.Household
+		result := database.DB.Where("meter_id = ?", meterID).Limit(1).Find(&household)
+		if result.Error != nil || result.RowsAffected == 0 {
+			err = result.Error
+			break
+		}
+		err = setMeterOnline(meterID, household.ID, now)
+	default:
+		log.Printf("Ignoring unknown status %q from meter %s", state, meterID)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update liveness of meter %s: %v", meterID, err)
+	}
+}
+
+// handleMeterStatus receives meter status messages via MQTT
+func handleMeterStatus(client pahomqtt.Client, msg pahomqtt.Message) {
+	HandleMeterStatus(msg.Topic(), msg.Payload(), time.Now())
+}
+
+// statusTopic returns the topic meter status messages arrive on.
+//
+// Configuration:
+//   - MQTT_STATUS_TOPIC: status and Last Will topic (default energy/status/+)
+func statusTopic() string {
+	if topic := os.Getenv("MQTT_STATUS_TOPIC"); topic != "" {
+		return topic
+	}
+	return defaultStatusTopic
+}
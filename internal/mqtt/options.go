@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// defaultBrokerURL is used when MQTT_BROKER is unset
+const defaultBrokerURL = "tcp://localhost:1883"
+
+// Broker URL schemes, by whether they use TLS
+var (
+	plainSchemes = map[string]bool{"tcp": true, "mqtt": true, "ws": true}
+	tlsSchemes   = map[string]bool{"ssl": true, "tls": true, "mqtts": true, "wss": true}
+)
+
+// ConnectionConfig holds the broker connection settings shared by the
+// subscriber and the simulator
+type ConnectionConfig struct {
+	BrokerURL          string
+	ClientID           string
+	Username           string
+	Password           string
+	CAFile             string // PEM bundle of CAs trusted for the broker certificate
+	CertFile           string // PEM client certificate, for brokers requiring mutual TLS
+	KeyFile            string // PEM key of the client certificate
+	InsecureSkipVerify bool   // skip broker certificate verification (testing only)
+}
+
+// ConnectionInfo describes a connection configuration without its secrets
+type ConnectionInfo struct {
+	BrokerURL  string `json:"brokerUrl"`
+	Transport  string `json:"transport"` // tcp or websocket
+	TLS        bool   `json:"tls"`
+	ClientID   string `json:"clientId"`
+	Username   string `json:"username,omitempty"`
+	CustomCA   bool   `json:"customCa"`
+	ClientCert bool   `json:"clientCert"`
+	Insecure   bool   `json:"insecureSkipVerify,omitempty"`
+	Error      string `json:"error,omitempty"` // why the configuration is invalid
+}
+
+// LoadConnectionConfig reads the broker connection settings. The client ID
+// is clientPrefix (or MQTT_CLIENT_ID) followed by a random suffix, so several
+// instances never take over each other's session.
+//
+// Configuration:
+//   - MQTT_BROKER: broker URL, tcp://, mqtt://, ssl://, tls://, mqtts://, ws:// or wss:// (default tcp://localhost:1883)
+//   - MQTT_CLIENT_ID: client ID prefix (default clientPrefix)
+//   - MQTT_USERNAME, MQTT_PASSWORD: broker credentials
+//   - MQTT_CA_FILE: PEM CA bundle for verifying the broker
+//   - MQTT_CERT_FILE, MQTT_KEY_FILE: PEM client certificate and key
+//   - MQTT_TLS_INSECURE: "true" to skip broker certificate verification
+func LoadConnectionConfig(clientPrefix string) *ConnectionConfig {
+	cfg := &ConnectionConfig{
+		BrokerURL:          os.Getenv("MQTT_BROKER"),
+		ClientID:           os.Getenv("MQTT_CLIENT_ID"),
+		Username:           os.Getenv("MQTT_USERNAME"),
+		Password:           os.Getenv("MQTT_PASSWORD"),
+		CAFile:             os.Getenv("MQTT_CA_FILE"),
+		CertFile:           os.Getenv("MQTT_CERT_FILE"),
+		KeyFile:            os.Getenv("MQTT_KEY_FILE"),
+		InsecureSkipVerify: os.Getenv("MQTT_TLS_INSECURE") == "true",
+	}
+	if cfg.BrokerURL == "" {
+		cfg.BrokerURL = defaultBrokerURL
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = clientPrefix
+	}
+	cfg.ClientID += "-" + randomSuffix()
+	return cfg
+}
+
+// randomSuffix returns 8 random hex characters
+func randomSuffix() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", os.Getpid())
+	}
+	return hex.EncodeToString(b)
+}
+
+// scheme returns the lower-cased scheme of the broker URL
+func (c *ConnectionConfig) scheme() string {
+	u, err := url.Parse(c.BrokerURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// usesTLS reports whether the broker URL is a TLS scheme
+func (c *ConnectionConfig) usesTLS() bool {
+	return tlsSchemes[c.scheme()]
+}
+
+// Validate checks that the settings are consistent and the certificate
+// files can be loaded
+func (c *ConnectionConfig) Validate() error {
+	u, err := url.Parse(c.BrokerURL)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT_BROKER %q: %w", c.BrokerURL, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !plainSchemes[scheme] && !tlsSchemes[scheme] {
+		return fmt.Errorf("unsupported MQTT_BROKER scheme %q (use tcp, mqtt, ssl, tls, mqtts, ws or wss)", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("MQTT_BROKER %q has no host", c.BrokerURL)
+	}
+
+	if c.Password != "" && c.Username == "" {
+		return errors.New("MQTT_PASSWORD is set without MQTT_USERNAME")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("MQTT_CERT_FILE and MQTT_KEY_FILE must be set together")
+	}
+	if !c.usesTLS() && (c.CAFile != "" || c.CertFile != "" || c.InsecureSkipVerify) {
+		return fmt.Errorf("TLS options are set but MQTT_BROKER uses %s://, use ssl://, mqtts:// or wss://", scheme)
+	}
+
+	if c.usesTLS() {
+		if _, err := c.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tlsConfig loads the CA bundle and client certificate
+func (c *ConnectionConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MQTT_CA_FILE %s contains no PEM certificates", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// ClientOptions validates the settings and builds Paho client options
+func (c *ConnectionConfig) ClientOptions() (*pahomqtt.ClientOptions, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts := pahomqtt.NewClientOptions()
+	opts.AddBroker(c.BrokerURL)
+	opts.SetClientID(c.ClientID)
+	if c.Username != "" {
+		opts.SetUsername(c.Username)
+		opts.SetPassword(c.Password)
+	}
+	if c.usesTLS() {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+// Info returns the settings for status reporting, without the password
+func (c *ConnectionConfig) Info() ConnectionInfo {
+	info := ConnectionInfo{
+		BrokerURL:  c.BrokerURL,
+		Transport:  "tcp",
+		TLS:        c.usesTLS(),
+		ClientID:   c.ClientID,
+		Username:   c.Username,
+		CustomCA:   c.CAFile != "",
+		ClientCert: c.CertFile != "",
+		Insecure:   c.InsecureSkipVerify,
+	}
+	if scheme := c.scheme(); scheme == "ws" || scheme == "wss" {
+		info.Transport = "websocket"
+	}
+	if u, err := url.Parse(c.BrokerURL); err == nil && u.User != nil {
+		// Never report credentials embedded in the URL
+		u.User = nil
+		info.BrokerURL = u.String()
+	}
+	if err := c.Validate(); err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
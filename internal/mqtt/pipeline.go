@@ -0,0 +1,441 @@
+package mqtt
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"energy-prediction/internal/blockchain"
+	"energy-prediction/internal/config"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/ml"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Ingestion defaults, overridable via environment variables
+const (
+	defaultQueueSize     = 1000
+	defaultWorkers       = 4
+	defaultBatchSize     = 50
+	defaultFlushInterval = 100 * time.Millisecond
+	defaultStoreAttempts = 3
+	defaultStoreBackoff  = 200 * time.Millisecond
+)
+
+// ActivePipeline is the running ingestion pipeline (nil if not started)
+var ActivePipeline *Pipeline
+
+// Pipeline decouples receiving meter data from processing it.
+// Readings are put on a bounded queue and handled by a fixed number of
+// workers, each inserting readings and predictions in batches. When the
+// queue is full new readings are dropped instead of blocking the MQTT client.
+// A batch the database cannot store is retried with backoff and then
+// dead-lettered, so accepted readings are never lost.
+type Pipeline struct {
+	queue         chan ingestItem
+	workers       int
+	batchSize     int
+	flushInterval time.Duration
+	storeAttempts int
+	storeBackoff  time.Duration
+
+	mu     sync.RWMutex // guards closed against concurrent Submit/Stop
+	closed bool
+	wg     sync.WaitGroup
+
+	received  atomic.Uint64
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+	batches   atomic.Uint64
+}
+
+// ingestItem is a reading waiting in the pipeline queue
+type ingestItem struct {
+	data       MeterData
+	source     Source
+	receivedAt time.Time
+}
+
+// rejection is a reading that could not be turned into a prediction
+type rejection struct {
+	source    Source
+	meterID   string
+	readingID *uint // stored reading, if it got that far
+	reason    string
+	detail    string
+}
+
+// PipelineStats reports the state of the ingestion pipeline
+type PipelineStats struct {
+	QueueDepth    int    `json:"queueDepth"`
+	QueueCapacity int    `json:"queueCapacity"`
+	Workers       int    `json:"workers"`
+	BatchSize     int    `json:"batchSize"`
+	Received      uint64 `json:"received"`
+	Processed     uint64 `json:"processed"`
+	Dropped       uint64 `json:"dropped"`
+	Duplicates    uint64 `json:"duplicates"` // redelivered readings that were skipped
+	Batches       uint64 `json:"batches"`
+}
+
+// StartPipeline starts the ingestion workers and makes the pipeline active.
+//
+// Configuration:
+//   - INGEST_QUEUE_SIZE: readings that can wait before new ones are dropped (default 1000)
+//   - INGEST_WORKERS: number of processing workers (default 4)
+//   - INGEST_BATCH_SIZE: maximum readings inserted per batch (default 50)
+//   - INGEST_FLUSH_INTERVAL: how long a worker waits to fill a batch (default 100ms)
+//   - INGEST_STORE_ATTEMPTS: tries to store a batch before it is dead-lettered (default 3)
+//   - INGEST_STORE_BACKOFF: delay before the first retry, doubled per retry (default 200ms)
+func StartPipeline() *Pipeline {
+	p := &Pipeline{
+		queue:         make(chan ingestItem, config.Int("INGEST_QUEUE_SIZE", defaultQueueSize)),
+		workers:       config.Int("INGEST_WORKERS", defaultWorkers),
+		batchSize:     config.Int("INGEST_BATCH_SIZE", defaultBatchSize),
+		flushInterval: config.Duration("INGEST_FLUSH_INTERVAL", defaultFlushInterval),
+		storeAttempts: config.Int("INGEST_STORE_ATTEMPTS", defaultStoreAttempts),
+		storeBackoff:  config.Duration("INGEST_STORE_BACKOFF", defaultStoreBackoff),
+	}
+
+	configureStream()
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	ActivePipeline = p
+	log.Printf("✓ Ingestion pipeline started (%d workers, queue %d, batch %d)", p.workers, cap(p.queue), p.batchSize)
+	return p
+}
+
+// Submit queues a reading for processing without blocking.
+// Returns false if the reading was dropped because the queue is full
+// or the pipeline has been stopped.
+func (p *Pipeline) Submit(data MeterData, source Source) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	p.received.Add(1)
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.queue <- ingestItem{data: data, source: source, receivedAt: time.Now()}:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Stop stops accepting readings and waits until queued ones are processed
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	if ActivePipeline == p {
+		ActivePipeline = nil
+	}
+	log.Println("Ingestion pipeline stopped")
+}
+
+// Stats returns queue depth and throughput counters
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		QueueDepth:    len(p.queue),
+		QueueCapacity: cap(p.queue),
+		Workers:       p.workers,
+		BatchSize:     p.batchSize,
+		Received:      p.received.Load(),
+		Processed:     p.processed.Load(),
+		Dropped:       p.dropped.Load(),
+		Duplicates:    DuplicateCount(),
+		Batches:       p.batches.Load(),
+	}
+}
+
+// worker takes readings off the queue and processes them in batches.
+// A batch is processed once it is full or flushInterval has passed since
+// its first reading arrived.
+func (p *Pipeline) worker() {
+	defer p.wg.Done()
+
+	for item := range p.queue {
+		batch := make([]ingestItem, 1, p.batchSize)
+		batch[0] = item
+
+		timer := time.NewTimer(p.flushInterval)
+	collect:
+		for len(batch) < p.batchSize {
+			select {
+			case next, ok := <-p.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		saveDeadLetters(storeBatch(batch, p.storeAttempts, p.storeBackoff))
+		p.processed.Add(uint64(len(batch)))
+		p.batches.Add(1)
+	}
+}
+
+// Submit feeds a reading into the active pipeline. Without a running
+// pipeline the reading is processed synchronously.
+// Returns false if the reading was dropped.
+func Submit(data MeterData, source Source) bool {
+	if p := ActivePipeline; p != nil {
+		return p.Submit(data, source)
+	}
+	ProcessMeterData(data, source)
+	return true
+}
+
+// storeBatch processes a batch, retrying it with exponential backoff while
+// the database fails before its readings are stored. After the last attempt
+// every reading of the batch is rejected as a storage error.
+// Returns the readings that were rejected.
+func storeBatch(items []ingestItem, attempts int, backoff time.Duration) []rejection {
+	for attempt := 1; ; attempt++ {
+		rejected, err := processBatch(items)
+		if err == nil {
+			return rejected
+		}
+		if attempt >= attempts {
+			log.Printf("Giving up on %d meter readings after %d attempts: %v", len(items), attempt, err)
+			return storageRejections(items, err)
+		}
+		log.Printf("Failed to store %d meter readings (attempt %d), retrying in %v: %v", len(items), attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// storageRejections rejects every reading of a batch that could not be stored
+func storageRejections(items []ingestItem, err error) []rejection {
+	rejected := make([]rejection, len(items))
+	for i, item := range items {
+		rejected[i] = rejection{source: item.source, meterID: item.data.MeterID, reason: models.ReasonStorageError, detail: err.Error()}
+	}
+	return rejected
+}
+
+// processBatch stores a batch of readings and creates predictions for those
+// that belong to an active household. Readings, predictions and blockchain
+// outbox entries are each written with a single insert.
+// Returns the readings that were rejected, or an error if the database
+// failed before the readings were stored; the batch can then be retried.
+// Stored readings whose predictions cannot be saved are rejected as storage
+// errors with their reading, so reprocessing the dead letter predicts them.
+func processBatch(items []ingestItem) ([]rejection, error) {
+	var rejected []rejection
+	readings := make([]models.MeterReading, 0, len(items))
+	sources := make([]Source, 0, len(items))
+	meterIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.data.MeterID == "" {
+			log.Printf("Ignoring reading without meter ID")
+			rejected = append(rejected, rejection{source: item.source, reason: models.ReasonMissingMeterID, detail: "meterId is empty"})
+			continue
+		}
+
+		timestamp, flag, err := parseTimestamp(item.data.Timestamp, item.receivedAt)
+		if err != nil {
+			log.Printf("Rejecting reading from %s: %v", item.data.MeterID, err)
+			rejected = append(rejected, rejection{source: item.source, meterID: item.data.MeterID, reason: models.ReasonInvalidTimestamp, detail: err.Error()})
+			continue
+		}
+
+		readings = append(readings, models.MeterReading{
+			MeterID:        item.data.MeterID,
+			MessageID:      item.data.MessageID,
+			DedupeKey:      dedupeKey(item.data.MeterID, item.data.MessageID, timestamp),
+			Timestamp:      timestamp,
+			ConsumptionKwh: item.data.ConsumptionKwh,
+			RegisterKwh:    item.data.RegisterKwh,
+			Temperature:    item.data.Temperature,
+			Channel:        item.source.Channel,
+			Flags:          flag,
+			ReceivedAt:     item.receivedAt,
+		})
+		sources = append(sources, item.source)
+		meterIDs = append(meterIDs, item.data.MeterID)
+	}
+	if len(readings) == 0 {
+		return rejected, nil
+	}
+
+	// Find the households of all meters in the batch. Archived houses are
+	// matched too, so their readings are still kept.
+	var households []models.Household
+	if err := database.DB.Where("meter_id IN ?", meterIDs).Find(&households).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up meters: %w", err)
+	}
+	byMeter := make(map[string]*models.Household, len(households))
+	for i := range households {
+		byMeter[households[i].MeterID] = &households[i]
+	}
+	for i := range readings {
+		if household, ok := byMeter[readings[i].MeterID]; ok {
+			readings[i].HouseID = household.ID
+		}
+	}
+
+	// Redelivered readings are skipped, so they never create a second prediction
+	fresh, freshSources, err := skipDuplicates(readings, sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %d meter readings for duplicates: %w", len(readings), err)
+	}
+
+	// Check the readings against their meter's stream and store the raw
+	// readings before a missing or inactive household can reject them
+	streamMu.Lock()
+	checked, checkedSources, outOfRange, gaps, err := checkStream(fresh, freshSources, time.Now())
+	if err != nil {
+		streamMu.Unlock()
+		return nil, fmt.Errorf("failed to check %d meter readings: %w", len(fresh), err)
+	}
+	rejected = append(rejected, outOfRange...)
+	if err := deriveIntervals(checked); err != nil {
+		streamMu.Unlock()
+		return nil, fmt.Errorf("failed to derive consumption of %d meter readings: %w", len(checked), err)
+	}
+	stored, storedSources, err := insertReadings(checked, checkedSources)
+	if err == nil {
+		saveGaps(gaps, stored)
+		markSeen(stored)
+	}
+	streamMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save %d meter readings: %w", len(checked), err)
+	}
+	readings, sources = stored, storedSources
+
+	predictions := make([]models.Prediction, 0, len(readings))
+	predicted := make([]int, 0, len(readings)) // index of each prediction's reading
+	for i := range readings {
+		household := byMeter[readings[i].MeterID]
+		if household == nil || household.Status != models.StatusActive {
+			// Log as debug rather than error if it's just an archived house still pulsing
+			log.Printf("Ignoring data for meter %s: node not found or not active", readings[i].MeterID)
+			rejected = append(rejected, rejectReading(sources[i], &readings[i], household))
+			continue
+		}
+		if !hasDerivedConsumption(&readings[i]) {
+			continue // register anomaly: stored for the record, but nothing to predict from
+		}
+		predictions = append(predictions, predictReading(household, &readings[i]))
+		predicted = append(predicted, i)
+	}
+	if err := savePredictions(predictions, byMeter); err != nil {
+		log.Printf("Failed to save %d predictions: %v", len(predictions), err)
+		for _, i := range predicted {
+			readingID := readings[i].ID
+			rejected = append(rejected, rejection{
+				source:    sources[i],
+				meterID:   readings[i].MeterID,
+				readingID: &readingID,
+				reason:    models.ReasonStorageError,
+				detail:    fmt.Sprintf("failed to save prediction: %v", err),
+			})
+		}
+	}
+	return rejected, nil
+}
+
+// savePredictions stores predictions together with their blockchain outbox
+// entries, so they are logged even if the ledger is down or the process
+// exits first. Saved predictions are then published for in-home displays;
+// byMeter holds the households of their meters.
+func savePredictions(predictions []models.Prediction, byMeter map[string]*models.Household) error {
+	if len(predictions) == 0 {
+		return nil
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&predictions).Error; err != nil {
+			return err
+		}
+		ids := make([]uint, len(predictions))
+		for i := range predictions {
+			ids[i] = predictions[i].ID
+		}
+		return blockchain.Enqueue(tx, ids...)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Log to blockchain (async, retried with backoff on failure)
+	blockchain.NotifyOutbox()
+
+	for _, p := range predictions {
+		log.Printf("✓ Prediction created: Meter=%s, Price=€%.4f, Confidence=%d%%",
+			p.MeterID, p.PredictedPrice, p.Confidence)
+	}
+
+	if publisher := ActivePublisher(); publisher != nil {
+		publisher.PublishPredictions(predictions, byMeter)
+	}
+	return nil
+}
+
+// predictReading runs the ML model for a stored reading
+func predictReading(household *models.Household, reading *models.MeterReading) models.Prediction {
+	hour := reading.Timestamp.Hour()
+
+	// Use the active ML model to predict price (includes house details for realism)
+	// The seed and house details are recorded so the prediction can be recomputed exactly
+	model := ml.Active()
+	seed := ml.SeedFor(reading.MeterID, reading.Timestamp)
+	features := models.FeaturesOf(household)
+	result := model.Predict(ml.Input{
+		Household:   features.Household(),
+		Hour:        hour,
+		Temperature: reading.Temperature,
+		Consumption: reading.ConsumptionKwh,
+		Time:        reading.Timestamp,
+		Seed:        seed,
+	})
+	predictedPrice, confidence := result.Price, result.Confidence
+
+	// Simulate actual market price for comparison
+	actualPrice := ml.GenerateActualPrice(predictedPrice, hour, seed)
+
+	readingID := reading.ID
+	return models.Prediction{
+		ReadingID:      &readingID,
+		UserID:         household.UserID,
+		HouseID:        household.ID,
+		MeterID:        reading.MeterID,
+		Timestamp:      reading.Timestamp,
+		Hour:           hour,
+		Temperature:    reading.Temperature,
+		ConsumptionKwh: reading.ConsumptionKwh,
+		PredictedPrice: predictedPrice,
+		ActualPrice:    actualPrice,
+		Confidence:     confidence,
+		ModelName:      model.Name(),
+		ModelVersion:   model.Version(),
+		Seed:           seed,
+		Features:       features,
+	}
+}
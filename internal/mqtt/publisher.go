@@ -0,0 +1,215 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"energy-prediction/internal/ml"
+	"energy-prediction/internal/models"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Publishing defaults, overridable via environment variables
+const (
+	defaultPredictionTopic = "energy/predictions/{meterId}"
+	defaultForecastTopic   = "energy/forecast/{houseId}"
+	defaultPublishQoS      = 1
+)
+
+// Delivery tracking limits: at most maxWatchedDeliveries publishes are
+// watched for errors at a time, each for up to deliveryTimeout
+const (
+	maxWatchedDeliveries = 256
+	deliveryTimeout      = 10 * time.Second
+)
+
+// MessagePublisher is the part of the Paho client used for publishing
+type MessagePublisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token
+}
+
+// activePublisher publishes predictions of the running gateway (nil if
+// publishing is disabled or MQTT is not connected). It is swapped by the
+// MQTT client while ingestion workers read it.
+var activePublisher atomic.Pointer[Publisher]
+
+// ActivePublisher returns the running publisher, or nil
+func ActivePublisher() *Publisher {
+	return activePublisher.Load()
+}
+
+// StopPublisher stops the active publisher, if any
+func StopPublisher() {
+	if p := activePublisher.Swap(nil); p != nil {
+		p.Stop()
+	}
+}
+
+// Publisher sends new predictions and 24-hour forecasts to in-home displays.
+// Predictions go to the meter's topic; the forecast is retained on the
+// house's topic, so a display gets it as soon as it subscribes. A house's
+// forecast is refreshed at most once per hour. Publishing never waits for
+// the broker: a single goroutine watches pending deliveries and logs errors.
+type Publisher struct {
+	client          MessagePublisher
+	predictionTopic string // {meterId} and {houseId} are substituted
+	forecastTopic   string
+	qos             byte
+
+	mu         sync.Mutex
+	forecastAt map[string]time.Time // house ID -> hour of the last published forecast
+
+	watchMu    sync.RWMutex // guards stopped against concurrent send/Stop
+	stopped    bool
+	deliveries chan delivery
+}
+
+// delivery is a publish whose outcome is still pending
+type delivery struct {
+	topic string
+	token pahomqtt.Token
+}
+
+// ForecastMessage is the retained payload on a house's forecast topic
+type ForecastMessage struct {
+	HouseID     string                      `json:"houseId"`
+	MeterID     string                      `json:"meterId"`
+	GeneratedAt string                      `json:"generatedAt"`
+	Forecast    []models.PredictionResponse `json:"forecast"`
+}
+
+// StartPublisher makes client the active publisher, unless publishing is
+// switched off. Returns nil if disabled.
+//
+// Configuration:
+//   - MQTT_PUBLISH_ENABLED: "false" to stop publishing predictions (default true)
+//   - MQTT_PREDICTION_TOPIC: prediction topic template (default energy/predictions/{meterId})
+//   - MQTT_FORECAST_TOPIC: retained forecast topic template (default energy/forecast/{houseId})
+//   - MQTT_PUBLISH_QOS: QoS of published messages, 0-2 (default 1)
+func StartPublisher(client MessagePublisher) *Publisher {
+	if os.Getenv("MQTT_PUBLISH_ENABLED") == "false" {
+		log.Println("Prediction publishing over MQTT is disabled")
+		StopPublisher()
+		return nil
+	}
+
+	p := &Publisher{
+		client:          client,
+		predictionTopic: os.Getenv("MQTT_PREDICTION_TOPIC"),
+		forecastTopic:   os.Getenv("MQTT_FORECAST_TOPIC"),
+		qos:             defaultPublishQoS,
+		forecastAt:      make(map[string]time.Time),
+		deliveries:      make(chan delivery, maxWatchedDeliveries),
+	}
+	if p.predictionTopic == "" {
+		p.predictionTopic = defaultPredictionTopic
+	}
+	if p.forecastTopic == "" {
+		p.forecastTopic = defaultForecastTopic
+	}
+	if value := os.Getenv("MQTT_PUBLISH_QOS"); value != "" {
+		qos, err := strconv.Atoi(value)
+		if err != nil || qos < 0 || qos > 2 {
+			log.Printf("Warning: invalid MQTT_PUBLISH_QOS=%q, using %d", value, defaultPublishQoS)
+		} else {
+			p.qos = byte(qos)
+		}
+	}
+
+	go p.watchDeliveries()
+	if previous := activePublisher.Swap(p); previous != nil {
+		previous.Stop()
+	}
+	log.Printf("✓ Publishing predictions to %s and forecasts to %s (QoS %d)", p.predictionTopic, p.forecastTopic, p.qos)
+	return p
+}
+
+// fillTopic fills in the meter and house of a topic template
+func fillTopic(template, meterID, houseID string) string {
+	return strings.NewReplacer("{meterId}", meterID, "{houseId}", houseID).Replace(template)
+}
+
+// PublishPredictions publishes saved predictions and refreshes the forecast
+// of their houses, given by meter ID. Publishing never blocks ingestion:
+// delivery errors are only logged.
+func (p *Publisher) PublishPredictions(predictions []models.Prediction, byMeter map[string]*models.Household) {
+	for i := range predictions {
+		prediction := &predictions[i]
+		p.send(fillTopic(p.predictionTopic, prediction.MeterID, prediction.HouseID), false, prediction.ToResponse())
+
+		if household, ok := byMeter[prediction.MeterID]; ok {
+			p.publishForecast(household, prediction.Temperature, time.Now())
+		}
+	}
+}
+
+// publishForecast publishes a house's retained 24-hour forecast, unless it
+// was already published this hour
+func (p *Publisher) publishForecast(household *models.Household, temperature float64, now time.Time) {
+	hour := now.Truncate(time.Hour)
+	p.mu.Lock()
+	if p.forecastAt[household.ID].Equal(hour) {
+		p.mu.Unlock()
+		return
+	}
+	p.forecastAt[household.ID] = hour
+	p.mu.Unlock()
+
+	p.send(fillTopic(p.forecastTopic, household.MeterID, household.ID), true, ForecastMessage{
+		HouseID:     household.ID,
+		MeterID:     household.MeterID,
+		GeneratedAt: now.Format(time.RFC3339),
+		Forecast:    ml.Get24HourForecast(household, temperature),
+	})
+}
+
+// Stop ends delivery tracking. Publishes still pending are no longer watched.
+func (p *Publisher) Stop() {
+	p.watchMu.Lock()
+	defer p.watchMu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.deliveries)
+	}
+}
+
+// send publishes a JSON message without waiting for the broker. If too many
+// deliveries are already pending, e.g. while the broker is down, this one is
+// not watched.
+func (p *Publisher) send(topic string, retained bool, message interface{}) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to encode message for %s: %v", topic, err)
+		return
+	}
+
+	token := p.client.Publish(topic, p.qos, retained, payload)
+
+	p.watchMu.RLock()
+	defer p.watchMu.RUnlock()
+	if p.stopped {
+		return
+	}
+	select {
+	case p.deliveries <- delivery{topic: topic, token: token}:
+	default:
+	}
+}
+
+// watchDeliveries logs publishes that fail or time out, one at a time
+func (p *Publisher) watchDeliveries() {
+	for d := range p.deliveries {
+		if !d.token.WaitTimeout(deliveryTimeout) {
+			log.Printf("Publish to %s not confirmed after %v", d.topic, deliveryTimeout)
+		} else if err := d.token.Error(); err != nil {
+			log.Printf("Failed to publish to %s: %v", d.topic, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// registerAnomalies are the flags of register readings whose consumption
+// could not be derived. They are stored with zero consumption and get no
+// prediction; the register is kept, so later readings derive from it (except
+// late registers, whose successor was already derived).
+var registerAnomalies = []string{
+	models.FlagBaseline,
+	models.FlagRegisterReset,
+	models.FlagNegativeDelta,
+	models.FlagImplausible,
+	models.FlagLateRegister,
+}
+
+// hasDerivedConsumption reports whether a reading's consumption can be
+// predicted from: interval readings always, register readings unless
+// flagged as an anomaly
+func hasDerivedConsumption(reading *models.MeterReading) bool {
+	for _, flag := range registerAnomalies {
+		if HasFlag(reading, flag) {
+			return false
+		}
+	}
+	return true
+}
+
+// deriveIntervals sets the consumption of readings that carry a cumulative
+// register from the meter's previous register reading, in the same batch or
+// stored. Callers must hold streamMu.
+//
+// A register below the previous one is a rollover if wrapping at
+// registerRollover gives a plausible delta, a reset (meter replaced) if the
+// new register is itself no more than a plausible delta above zero, and a
+// negative delta otherwise. A delta above maxPowerKw over the elapsed time
+// is implausible.
+//
+// A late register reading falls into an interval a stored register reading
+// already covers. Splitting it would change a consumption that was already
+// predicted from, so it gets zero consumption and FlagLateRegister instead,
+// and later readings of the batch do not derive from it.
+func deriveIntervals(readings []models.MeterReading) error {
+	var withRegister []*models.MeterReading
+	for i := range readings {
+		if readings[i].RegisterKwh != nil {
+			withRegister = append(withRegister, &readings[i])
+		}
+	}
+	sort.SliceStable(withRegister, func(i, j int) bool {
+		return withRegister[i].Timestamp.Before(withRegister[j].Timestamp)
+	})
+
+	previous := make(map[string]*models.MeterReading) // meter ID -> previous register reading in this batch
+	for _, reading := range withRegister {
+		if HasFlag(reading, models.FlagLate) {
+			counted, err := registerStoredAfter(reading)
+			if err != nil {
+				return err
+			}
+			if counted {
+				reading.ConsumptionKwh = 0
+				addFlag(reading, models.FlagLateRegister)
+				log.Printf("Warning: meter %s sent register %.3f kWh for %s after a newer register, not counted",
+					reading.MeterID, *reading.RegisterKwh, reading.Timestamp.Format(time.RFC3339))
+				continue
+			}
+		}
+
+		prev, ok := previous[reading.MeterID]
+		if !ok {
+			var err error
+			if prev, err = storedRegister(reading); err != nil {
+				return err
+			}
+		}
+		previous[reading.MeterID] = reading
+
+		if prev == nil {
+			reading.ConsumptionKwh = 0
+			addFlag(reading, models.FlagBaseline)
+			continue
+		}
+		flag, consumption := registerDelta(*prev.RegisterKwh, *reading.RegisterKwh,
+			reading.Timestamp.Sub(prev.Timestamp).Hours())
+		reading.ConsumptionKwh = consumption
+		if flag == "" {
+			continue
+		}
+		addFlag(reading, flag)
+		if flag != models.FlagRollover {
+			log.Printf("Warning: meter %s register went from %.3f to %.3f kWh (%s)",
+				reading.MeterID, *prev.RegisterKwh, *reading.RegisterKwh, flag)
+		}
+	}
+	return nil
+}
+
+// registerDelta returns the consumption between two register values read
+// hours apart, with the flag describing how it was derived
+func registerDelta(prev, current, hours float64) (flag string, consumption float64) {
+	maxDelta := stream.maxPowerKw * hours
+	delta := current - prev
+
+	if delta < 0 {
+		if wrapped := current + stream.registerRollover - prev; wrapped >= 0 && wrapped <= maxDelta {
+			return models.FlagRollover, wrapped
+		}
+		if current <= maxDelta {
+			return models.FlagRegisterReset, 0
+		}
+		return models.FlagNegativeDelta, 0
+	}
+	if delta > maxDelta {
+		return models.FlagImplausible, 0
+	}
+	return "", delta
+}
+
+// storedRegister returns the meter's newest stored register reading before
+// reading, or nil if there is none
+func storedRegister(reading *models.MeterReading) (*models.MeterReading, error) {
+	var stored models.MeterReading
+	result := database.DB.
+		Where("meter_id = ? AND register_kwh IS NOT NULL AND timestamp < ?", reading.MeterID, reading.Timestamp).
+		Order("timestamp DESC").Limit(1).Find(&stored)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find previous register of %s: %w", reading.MeterID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &stored, nil
+}
+
+// registerStoredAfter reports whether the meter has a stored register reading
+// newer than reading
+func registerStoredAfter(reading *models.MeterReading) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.MeterReading{}).
+		Where("meter_id = ? AND register_kwh IS NOT NULL AND timestamp > ?", reading.MeterID, reading.Timestamp).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to find newer registers of %s: %w", reading.MeterID, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,289 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"energy-prediction/internal/models"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// FormatSenML is the content type of SenML packs (RFC 8428, JSON encoding)
+const FormatSenML = "application/senml+json"
+
+// defaultSenMLTopic receives SenML packs, one topic per meter
+const defaultSenMLTopic = "energy/senml/+"
+
+// defaultSenMLEnergyName is the name of the energy record read from a pack
+const defaultSenMLEnergyName = "energy"
+
+// senmlRelativeTime is the RFC 8428 threshold below which times are relative
+// to the current time rather than Unix seconds
+const senmlRelativeTime = 1 << 28
+
+// SenML units mapped to readings, with the factor converting them to kWh
+// (energy) or °C (temperature)
+var (
+	senmlEnergyUnits      = map[string]float64{"kWh": 1, "Wh": 1e-3, "J": 1 / 3.6e6}
+	senmlTemperatureUnits = map[string]bool{"Cel": true}
+)
+
+// SenMLRecord is a SenML record. Base fields apply to the record they are in
+// and all later records of the pack, until they are set again.
+type SenMLRecord struct {
+	BaseName  string   `json:"bn,omitempty"`
+	BaseTime  float64  `json:"bt,omitempty"`
+	BaseUnit  string   `json:"bu,omitempty"`
+	BaseValue float64  `json:"bv,omitempty"`
+	BaseSum   float64  `json:"bs,omitempty"`
+	Name      string   `json:"n,omitempty"`
+	Unit      string   `json:"u,omitempty"`
+	Value     *float64 `json:"v,omitempty"`
+	Sum       *float64 `json:"s,omitempty"`
+	Time      float64  `json:"t,omitempty"`
+}
+
+// senmlTopic returns the SenML subscription.
+//
+// Configuration:
+//   - MQTT_SENML_TOPIC: SenML topic (default energy/senml/+)
+func senmlTopic() string {
+	if topic := os.Getenv("MQTT_SENML_TOPIC"); topic != "" {
+		return topic
+	}
+	return defaultSenMLTopic
+}
+
+// senmlEnergyName returns the name of the energy record read from a pack.
+//
+// Configuration:
+//   - SENML_ENERGY_NAME: name of the consumption record, after the device prefix (default energy)
+func senmlEnergyName() string {
+	if name := os.Getenv("SENML_ENERGY_NAME"); name != "" {
+		return name
+	}
+	return defaultSenMLEnergyName
+}
+
+// senmlLocalName strips the device prefix (up to the last ':' or '/') from
+// the full name of a record, e.g. urn:dev:mac:0024befffe804ff1:energy
+func senmlLocalName(name string) string {
+	return name[strings.LastIndexAny(name, ":/")+1:]
+}
+
+// subscribeToSenML subscribes to SenML packs with QoS 1
+func subscribeToSenML(client pahomqtt.Client, topic string) {
+	token := client.Subscribe(topic, 1, handleSenML)
+	if token.Wait() && token.Error() != nil {
+		log.Printf("Failed to subscribe to topic %s: %v", topic, token.Error())
+	} else {
+		log.Printf("✓ Subscribed to SenML topic: %s", topic)
+	}
+}
+
+// handleSenML processes SenML packs received via MQTT
+func handleSenML(client pahomqtt.Client, msg pahomqtt.Message) {
+	HandleSenMLMessage(msg.Topic(), msg.Payload())
+}
+
+// HandleSenMLMessage decodes a SenML pack received on energy/senml/{meterId}
+// and feeds its readings into ingestion. Undecodable packs are dead-lettered.
+func HandleSenMLMessage(topic string, payload []byte) {
+	log.Printf("Received SenML pack from topic %s", topic)
+
+	meterID, _ := parseMeterTopic(topic)
+	source := Source{Channel: models.ChannelMQTT, Topic: topic, Payload: payload, Format: FormatSenML}
+
+	readings, err := DecodeSenML(payload, meterID, time.Now())
+	if err != nil {
+		log.Printf("Failed to parse SenML pack: %v", err)
+		saveDeadLetters([]rejection{{source: source, meterID: meterID, reason: models.ReasonInvalidPayload, detail: err.Error()}})
+		return
+	}
+
+	if queued := SubmitReadings(readings, source); queued < len(readings) {
+		log.Printf("Ingestion queue full, dropped %d readings from %s", len(readings)-queued, meterID)
+	}
+}
+
+// DecodeSenML turns a SenML pack into readings of meterID. SenML names are
+// device specific (often URNs), so the meter comes from the topic or the
+// signing meter rather than from bn/n. Records are grouped by time. Of the
+// energy records (kWh, Wh or J), only the one named SENML_ENERGY_NAME after
+// the device prefix, or unnamed, is read: its value (v) is the consumption and
+// its sum (s) the cumulative register. Other energy records, such as export
+// or further channels, are ignored. A temperature record (Cel) sets that
+// reading's temperature. Records with other units, two energy values or sums
+// at the same time, or a time without an energy record reject the whole pack.
+func DecodeSenML(payload []byte, meterID string, now time.Time) ([]MeterData, error) {
+	if meterID == "" {
+		return nil, errors.New("no meter ID for SenML pack")
+	}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return nil, errors.New("empty payload")
+	}
+
+	var records []SenMLRecord
+	if err := json.Unmarshal(payload, &records); err != nil {
+		return nil, fmt.Errorf("SenML pack must be a JSON array of records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty SenML pack")
+	}
+	if len(records) > maxPayloadReadings {
+		return nil, fmt.Errorf("pack has %d records, at most %d are allowed", len(records), maxPayloadReadings)
+	}
+
+	type slot struct {
+		energy      float64
+		hasEnergy   bool
+		register    *float64
+		temperature *float64
+	}
+	slots := make(map[int64]*slot) // Unix nanoseconds (0: no time) -> reading
+	var baseName, baseUnit string
+	var baseTime, baseValue, baseSum float64
+	energyName := senmlEnergyName()
+
+	for i, record := range records {
+		if record.BaseName != "" {
+			baseName = record.BaseName
+		}
+		if record.BaseTime != 0 {
+			baseTime = record.BaseTime
+		}
+		if record.BaseUnit != "" {
+			baseUnit = record.BaseUnit
+		}
+		if record.BaseValue != 0 {
+			baseValue = record.BaseValue
+		}
+		if record.BaseSum != 0 {
+			baseSum = record.BaseSum
+		}
+
+		name := baseName + record.Name
+		unit := record.Unit
+		if unit == "" {
+			unit = baseUnit
+		}
+		if record.Value == nil && record.Sum == nil {
+			if record.Name == "" && record.Unit == "" {
+				continue // a record holding only base fields
+			}
+			return nil, fmt.Errorf("record %d (%s): missing numeric value (v) or sum (s)", i, name)
+		}
+		var value, sum float64
+		if record.Value != nil {
+			value = baseValue + *record.Value
+		}
+		if record.Sum != nil {
+			sum = baseSum + *record.Sum
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) || math.IsNaN(sum) || math.IsInf(sum, 0) {
+			return nil, fmt.Errorf("record %d (%s): value is not a finite number", i, name)
+		}
+
+		at := baseTime + record.Time
+		var key int64
+		if at != 0 {
+			t := time.Unix(0, int64(at*1e9))
+			if math.Abs(at) < senmlRelativeTime {
+				t = now.Add(time.Duration(at * 1e9))
+			}
+			key = t.UnixNano()
+		}
+		s, ok := slots[key]
+		if !ok {
+			s = &slot{}
+			slots[key] = s
+		}
+
+		if factor, ok := senmlEnergyUnits[unit]; ok {
+			if local := senmlLocalName(name); local != "" && local != energyName {
+				continue // another channel, such as export
+			}
+			if value < 0 || sum < 0 {
+				return nil, fmt.Errorf("record %d (%s): negative energy in %s", i, name, unit)
+			}
+			if (record.Value != nil && s.hasEnergy) || (record.Sum != nil && s.register != nil) {
+				return nil, fmt.Errorf("record %d (%s): ambiguous, more than one %q energy record at %s",
+					i, name, energyName, senmlTimeString(key))
+			}
+			if record.Value != nil {
+				s.energy = value * factor
+				s.hasEnergy = true
+			}
+			if record.Sum != nil {
+				register := sum * factor
+				s.register = &register
+			}
+			continue
+		}
+		if senmlTemperatureUnits[unit] {
+			if record.Value == nil {
+				return nil, fmt.Errorf("record %d (%s): temperatures need a value (v), sums (s) are only read for energy", i, name)
+			}
+			if s.temperature != nil {
+				return nil, fmt.Errorf("record %d (%s): more than one temperature at the same time", i, name)
+			}
+			s.temperature = &value
+			continue
+		}
+		if unit == "" {
+			return nil, fmt.Errorf("record %d (%s): missing unit (u or bu)", i, name)
+		}
+		return nil, fmt.Errorf("record %d (%s): unsupported unit %q, use kWh, Wh or J for energy and Cel for temperature",
+			i, name, unit)
+	}
+
+	keys := make([]int64, 0, len(slots))
+	for key, s := range slots {
+		if !s.hasEnergy && s.register == nil {
+			return nil, fmt.Errorf("%s has no energy record named %q", senmlTimeString(key), energyName)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	readings := make([]MeterData, len(keys))
+	for i, key := range keys {
+		s := slots[key]
+		readings[i] = MeterData{MeterID: meterID, ConsumptionKwh: s.energy, RegisterKwh: s.register}
+		if key != 0 {
+			readings[i].Timestamp = time.Unix(0, key).UTC().Format(time.RFC3339Nano)
+		}
+		if s.temperature != nil {
+			readings[i].Temperature = *s.temperature
+		}
+	}
+	return readings, nil
+}
+
+// senmlTimeString describes the time of a grouped record in errors
+func senmlTimeString(key int64) string {
+	if key == 0 {
+		return "receive time"
+	}
+	return time.Unix(0, key).UTC().Format(time.RFC3339)
+}
+
+// CheckSenMLContentType checks the content type of a SenML submission.
+// An empty content type and application/json are accepted as SenML JSON.
+func CheckSenMLContentType(contentType string) error {
+	switch strings.ToLower(contentType) {
+	case "", FormatSenML, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported content type %q, use %s", contentType, FormatSenML)
+	}
+}
@@ -0,0 +1,293 @@
+package mqtt
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"energy-prediction/internal/config"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Stream processing defaults, overridable via environment variables
+const (
+	defaultMaxClockSkew    = 5 * time.Minute
+	defaultLateWindow      = 24 * time.Hour
+	defaultReadingInterval = 15 * time.Minute
+
+	defaultRegisterRollover = 1000000 // kWh, a six-digit register
+	defaultMaxPowerKw       = 50      // more than a household connection can draw
+)
+
+// streamConfig controls how readings are checked against their meter's stream
+type streamConfig struct {
+	maxClockSkew time.Duration // how far ahead of the server clock a reading may be
+	flagFuture   bool          // accept and flag readings beyond maxClockSkew instead of rejecting
+	lateWindow   time.Duration // how far behind the meter's newest reading a reading may be
+	interval     time.Duration // expected time between two readings of a meter
+
+	registerRollover float64 // kWh at which a cumulative register wraps to zero
+	maxPowerKw       float64 // average power above which a register delta is implausible
+}
+
+var (
+	stream = streamConfig{
+		maxClockSkew: defaultMaxClockSkew,
+		lateWindow:   defaultLateWindow,
+		interval:     defaultReadingInterval,
+
+		registerRollover: defaultRegisterRollover,
+		maxPowerKw:       defaultMaxPowerKw,
+	}
+
+	// streamMu serializes checking and storing readings, so concurrent
+	// workers see each other's newest readings when looking for gaps
+	streamMu sync.Mutex
+)
+
+// configureStream reads the stream processing settings.
+//
+// Configuration:
+//   - INGEST_MAX_CLOCK_SKEW: how far in the future a timestamp may be (default 5m)
+//   - INGEST_FUTURE_READINGS: "reject" (default) or "flag" readings beyond the skew
+//   - INGEST_LATE_WINDOW: how far behind the meter's newest reading a late reading is accepted (default 24h)
+//   - INGEST_READING_INTERVAL: expected interval between readings, used for gap detection (default 15m)
+//   - METER_REGISTER_ROLLOVER_KWH: value at which cumulative registers wrap to zero (default 1000000)
+//   - METER_MAX_POWER_KW: average power above which a register delta is implausible (default 50)
+func configureStream() {
+	stream = streamConfig{
+		maxClockSkew: config.Duration("INGEST_MAX_CLOCK_SKEW", defaultMaxClockSkew),
+		flagFuture:   os.Getenv("INGEST_FUTURE_READINGS") == "flag",
+		lateWindow:   config.Duration("INGEST_LATE_WINDOW", defaultLateWindow),
+		interval:     config.Duration("INGEST_READING_INTERVAL", defaultReadingInterval),
+
+		registerRollover: config.Float("METER_REGISTER_ROLLOVER_KWH", defaultRegisterRollover),
+		maxPowerKw:       config.Float("METER_MAX_POWER_KW", defaultMaxPowerKw),
+	}
+}
+
+// ExpectedReadingInterval returns the interval meters are expected to report at
+func ExpectedReadingInterval() time.Duration {
+	return stream.interval
+}
+
+// parseTimestamp parses the timestamp sent by a meter. A missing timestamp
+// falls back to the receive time and flags the reading; an invalid one is
+// rejected rather than silently replaced.
+func parseTimestamp(value string, receivedAt time.Time) (time.Time, string, error) {
+	if value == "" {
+		return receivedAt, models.FlagEstimatedTime, nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("timestamp %q is not RFC 3339", value)
+	}
+	return timestamp, "", nil
+}
+
+// addFlag appends a quality flag to a reading
+func addFlag(reading *models.MeterReading, flag string) {
+	if reading.Flags == "" {
+		reading.Flags = flag
+	} else {
+		reading.Flags += "," + flag
+	}
+}
+
+// HasFlag reports whether a reading carries a quality flag
+func HasFlag(reading *models.MeterReading, flag string) bool {
+	for _, f := range strings.Split(reading.Flags, ",") {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStream orders readings per meter and checks each against the newest
+// stored reading of its meter:
+//   - readings too far in the future are rejected (or flagged)
+//   - readings older than the newest one are flagged late, or rejected if
+//     they are outside the late window
+//   - a reading that skips expected intervals opens a gap record
+//
+// Callers must hold streamMu until the returned readings are stored.
+func checkStream(readings []models.MeterReading, sources []Source, now time.Time) ([]models.MeterReading, []Source, []rejection, []models.ReadingGap, error) {
+	order := make([]int, len(readings))
+	meterIDs := make([]string, 0, len(readings))
+	for i := range readings {
+		order[i] = i
+		meterIDs = append(meterIDs, readings[i].MeterID)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := &readings[order[a]], &readings[order[b]]
+		if ra.MeterID != rb.MeterID {
+			return ra.MeterID < rb.MeterID
+		}
+		return ra.Timestamp.Before(rb.Timestamp)
+	})
+
+	newest, err := newestReadings(meterIDs)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var (
+		kept        = make([]models.MeterReading, 0, len(readings))
+		keptSources = make([]Source, 0, len(readings))
+		rejected    []rejection
+		gaps        []models.ReadingGap
+	)
+	reject := func(i int, reason, detail string) {
+		readingID := readings[i].ID
+		r := rejection{source: sources[i], meterID: readings[i].MeterID, reason: reason, detail: detail}
+		if readingID != 0 {
+			r.readingID = &readingID
+		}
+		rejected = append(rejected, r)
+	}
+
+	for _, i := range order {
+		reading := &readings[i]
+		latest, seen := newest[reading.MeterID]
+
+		switch {
+		case reading.Timestamp.After(now.Add(stream.maxClockSkew)):
+			if !stream.flagFuture {
+				reject(i, models.ReasonFutureTimestamp, fmt.Sprintf("timestamp %s is %v ahead of the server clock",
+					reading.Timestamp.Format(time.RFC3339), reading.Timestamp.Sub(now).Round(time.Second)))
+				continue
+			}
+			// Future readings never become the meter's newest reading
+			addFlag(reading, models.FlagFuture)
+
+		case !seen:
+			newest[reading.MeterID] = reading.Timestamp
+
+		case reading.Timestamp.After(latest):
+			if missing := missingReadings(latest, reading.Timestamp); missing > 0 {
+				gaps = append(gaps, models.ReadingGap{
+					MeterID:         reading.MeterID,
+					HouseID:         reading.HouseID,
+					Start:           latest,
+					End:             reading.Timestamp,
+					MissingReadings: missing,
+				})
+			}
+			newest[reading.MeterID] = reading.Timestamp
+
+		case reading.Timestamp.Before(latest):
+			if latest.Sub(reading.Timestamp) > stream.lateWindow {
+				reject(i, models.ReasonTooLate, fmt.Sprintf("timestamp %s is %v behind the newest reading, late window is %v",
+					reading.Timestamp.Format(time.RFC3339), latest.Sub(reading.Timestamp), stream.lateWindow))
+				continue
+			}
+			addFlag(reading, models.FlagLate)
+		}
+
+		kept = append(kept, *reading)
+		keptSources = append(keptSources, sources[i])
+	}
+
+	return kept, keptSources, rejected, gaps, nil
+}
+
+// newestReadings returns the newest stored reading time of each meter,
+// ignoring readings flagged as being in the future
+func newestReadings(meterIDs []string) (map[string]time.Time, error) {
+	var rows []models.MeterReading
+	err := database.DB.Table("meter_readings AS r").
+		Select("r.meter_id, r.timestamp").
+		Where("r.meter_id IN ?", meterIDs).
+		Where(`r.timestamp = (SELECT MAX(timestamp) FROM meter_readings
+			WHERE meter_id = r.meter_id AND (flags IS NULL OR flags NOT LIKE ?))`, "%"+models.FlagFuture+"%").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	newest := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		newest[row.MeterID] = row.Timestamp
+	}
+	return newest, nil
+}
+
+// missingReadings returns how many expected readings lie between two
+// consecutive readings. Jitter of up to half an interval is tolerated.
+func missingReadings(from, to time.Time) int {
+	elapsed := to.Sub(from)
+	if elapsed <= stream.interval+stream.interval/2 {
+		return 0
+	}
+	missing := int(math.Round(float64(elapsed)/float64(stream.interval))) - 1
+	if missing < 1 {
+		missing = 1
+	}
+	return missing
+}
+
+// saveGaps stores gaps detected in a batch and shrinks gaps that late
+// readings have filled in
+func saveGaps(gaps []models.ReadingGap, readings []models.MeterReading) {
+	if len(gaps) > 0 {
+		if err := database.DB.Create(&gaps).Error; err != nil {
+			log.Printf("Failed to save %d reading gaps: %v", len(gaps), err)
+		}
+		for _, gap := range gaps {
+			log.Printf("Gap detected for meter %s: %d readings missing between %s and %s",
+				gap.MeterID, gap.MissingReadings, gap.Start.Format(time.RFC3339), gap.End.Format(time.RFC3339))
+		}
+	}
+
+	for i := range readings {
+		if HasFlag(&readings[i], models.FlagLate) {
+			if err := fillGap(&readings[i]); err != nil {
+				log.Printf("Failed to update gaps for meter %s: %v", readings[i].MeterID, err)
+			}
+		}
+	}
+}
+
+// fillGap splits the gap a late reading falls into. The parts either side of
+// the reading are kept only while they still miss readings.
+func fillGap(reading *models.MeterReading) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var gap models.ReadingGap
+		result := tx.Where("meter_id = ? AND gap_start < ? AND gap_end > ?", reading.MeterID, reading.Timestamp, reading.Timestamp).
+			Limit(1).Find(&gap)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		if err := tx.Delete(&gap).Error; err != nil {
+			return err
+		}
+		for _, part := range [][2]time.Time{{gap.Start, reading.Timestamp}, {reading.Timestamp, gap.End}} {
+			missing := missingReadings(part[0], part[1])
+			if missing == 0 {
+				continue
+			}
+			split := models.ReadingGap{
+				MeterID:         gap.MeterID,
+				HouseID:         gap.HouseID,
+				Start:           part[0],
+				End:             part[1],
+				MissingReadings: missing,
+				DetectedAt:      gap.DetectedAt,
+			}
+			if err := tx.Create(&split).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
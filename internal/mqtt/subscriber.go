@@ -10,9 +10,6 @@ import (
 	"os"
 	"time"
 
-	"energy-prediction/internal/blockchain"
-	"energy-prediction/internal/database"
-	"energy-prediction/internal/ml"
 	"energy-prediction/internal/models"
 
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
@@ -33,32 +30,45 @@ type MeterData struct {
 	Timestamp      string  `json:"timestamp"`
 	Temperature    float64 `json:"temperature"`
 	ConsumptionKwh float64 `json:"consumptionKwh"`
+	MessageID      string  `json:"messageId,omitempty"` // optional, used for deduplication
+	// RegisterKwh is the cumulative import register. If set, ConsumptionKwh
+	// is derived from the meter's previous register reading.
+	RegisterKwh *float64 `json:"registerKwh,omitempty"`
+}
+
+// Source describes where a reading came from
+type Source struct {
+	Channel string // models.ChannelMQTT or models.ChannelHTTP
+	Topic   string // MQTT topic, empty for HTTP
+	Payload []byte // raw message, kept if the reading is dead-lettered
+	Format  string // payload format, FormatJSON if empty
 }
 
 // NewSubscriber creates a new MQTT subscriber client.
 // It connects to the broker and subscribes to the energy data topic.
-func NewSubscriber() (*Client, error) {
-	// Get broker URL from environment or use default
-	brokerURL := os.Getenv("MQTT_BROKER")
-	if brokerURL == "" {
-		brokerURL = "tcp://localhost:1883"
-	}
-
+func NewSubscriber(cfg *ConnectionConfig) (*Client, error) {
 	topic := os.Getenv("MQTT_TOPIC")
 	if topic == "" {
-		topic = "energy/meters/+" // + is wildcard for any meter
+		topic = "energy/meters/#" // any meter, with or without a format suffix
 	}
+	status := statusTopic()
+	senml := senmlTopic()
+	p1 := dsmrTopic()
 
 	// Configure MQTT client options
-	opts := pahomqtt.NewClientOptions()
-	opts.AddBroker(brokerURL)
-	opts.SetClientID("energy-prediction-subscriber")
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT configuration: %w", err)
+	}
 	opts.SetCleanSession(true)
 	opts.SetAutoReconnect(true)
 	opts.SetConnectionLostHandler(onConnectionLost)
 	opts.SetOnConnectHandler(func(c pahomqtt.Client) {
 		log.Println("✓ MQTT connected, subscribing to topic:", topic)
 		subscribeToTopic(c, topic)
+		subscribeToStatus(c, status)
+		subscribeToSenML(c, senml)
+		subscribeToDSMR(c, p1)
 	})
 
 	// Create and connect client
@@ -72,6 +82,10 @@ func NewSubscriber() (*Client, error) {
 		client: client,
 		topic:  topic,
 	}
+	log.Printf("✓ MQTT client %s connected to %s", cfg.ClientID, cfg.Info().BrokerURL)
+
+	// Send predictions back to in-home displays over the same connection
+	StartPublisher(client)
 
 	return ActiveClient, nil
 }
@@ -86,6 +100,17 @@ func subscribeToTopic(client pahomqtt.Client, topic string) {
 	}
 }
 
+// subscribeToStatus subscribes to meter status messages, including the
+// Last Will the broker publishes when a meter disconnects ungracefully
+func subscribeToStatus(client pahomqtt.Client, topic string) {
+	token := client.Subscribe(topic, 1, handleMeterStatus)
+	if token.Wait() && token.Error() != nil {
+		log.Printf("Failed to subscribe to topic %s: %v", topic, token.Error())
+	} else {
+		log.Printf("✓ Subscribed to status topic: %s", topic)
+	}
+}
+
 // onConnectionLost handles MQTT disconnection
 func onConnectionLost(client pahomqtt.Client, err error) {
 	log.Printf("MQTT connection lost: %v", err)
@@ -93,91 +118,115 @@ func onConnectionLost(client pahomqtt.Client, err error) {
 
 // ProcessMeterData processes incoming meter data (from MQTT or HTTP).
 // This is the core handler that:
-// 1. Uses ML to predict the energy price
-// 2. Logs the prediction to the blockchain
-// 3. Saves everything to the database
-func ProcessMeterData(data MeterData) {
-	// Find the household associated with this meter
-	var household models.Household
-	if err := database.DB.Where("meter_id = ? AND status = ?", data.MeterID, "active").First(&household).Error; err != nil {
-		// Log as debug rather than error if it's just an archived house still pulsing
-		log.Printf("Ignoring data for meter %s: node not found or not active", data.MeterID)
-		return
-	}
+// 1. Stores the raw reading
+// 2. Uses ML to predict the energy price
+// 3. Saves the prediction and queues it for the blockchain
+//
+// Rejected readings are saved as dead letters. It runs synchronously; live
+// traffic goes through Submit and the pipeline.
+func ProcessMeterData(data MeterData, source Source) {
+	items := []ingestItem{{data: data, source: source, receivedAt: time.Now()}}
+	saveDeadLetters(storeBatch(items, defaultStoreAttempts, defaultStoreBackoff))
+}
 
-	// Parse timestamp
-	timestamp, err := time.Parse(time.RFC3339, data.Timestamp)
-	if err != nil {
-		timestamp = time.Now()
-	}
+// handleMeterData processes incoming messages from smart meters via MQTT.
+func handleMeterData(client pahomqtt.Client, msg pahomqtt.Message) {
+	HandleMeterMessage(msg.Topic(), msg.Payload())
+}
 
-	// Use ML model to predict price (now includes house details for realism)
-	predictedPrice, confidence := ml.PredictPrice(
-		&household,
-		timestamp.Hour(),
-		data.Temperature,
-		data.ConsumptionKwh,
-	)
-
-	// Simulate actual market price for comparison
-	actualPrice := ml.GenerateActualPrice(predictedPrice, timestamp.Hour())
-
-	// Create prediction record
-	prediction := models.Prediction{
-		UserID:         household.UserID,
-		HouseID:        household.ID,
-		MeterID:        data.MeterID,
-		Timestamp:      timestamp,
-		Hour:           timestamp.Hour(),
-		Temperature:    data.Temperature,
-		ConsumptionKwh: data.ConsumptionKwh,
-		PredictedPrice: predictedPrice,
-		ActualPrice:    actualPrice,
-		Confidence:     confidence,
-	}
+// HandleMeterMessage decodes a meter message received on topic and feeds
+// its readings into ingestion. The format is picked by the topic suffix
+// (energy/meters/{meterId}/cbor); a message may carry one reading, an array
+// or a compact batch. Undecodable messages and readings of another meter
+// than the topic's are dead-lettered.
+func HandleMeterMessage(topic string, payload []byte) {
+	log.Printf("Received message from topic %s", topic)
 
-	// Save to database first
-	if err := database.DB.Create(&prediction).Error; err != nil {
-		log.Printf("Failed to save prediction: %v", err)
+	_, format := parseMeterTopic(topic)
+	source := Source{Channel: models.ChannelMQTT, Topic: topic, Payload: payload, Format: format}
+
+	// Parse meter data
+	readings, err := DecodeReadings(payload, format)
+	if err != nil {
+		log.Printf("Failed to parse meter data: %v", err)
+		saveDeadLetters([]rejection{{source: source, reason: models.ReasonInvalidPayload, detail: err.Error()}})
 		return
 	}
 
-	// Log to blockchain (async)
-	go func() {
-		txHash, err := blockchain.LogPrediction(&prediction)
-		if err != nil {
-			log.Printf("Failed to log to blockchain: %v", err)
-			return
+	// A meter may only publish its own readings
+	sources := readingSources(source, readings)
+	accepted := readings[:0]
+	acceptedSources := make([]Source, 0, len(readings))
+	var rejected []rejection
+	for i := range readings {
+		if r := checkTopicMeter(sources[i], readings[i].MeterID); r != nil {
+			log.Printf("Rejecting reading for meter %q published on %s", readings[i].MeterID, topic)
+			rejected = append(rejected, *r)
+			continue
 		}
+		accepted = append(accepted, readings[i])
+		acceptedSources = append(acceptedSources, sources[i])
+	}
+	saveDeadLetters(rejected)
 
-		// Update prediction with blockchain transaction
-		database.DB.Model(&prediction).Updates(map[string]interface{}{
-			"blockchain_tx":        txHash,
-			"blockchain_confirmed": true,
-		})
-		log.Printf("✓ Prediction %d logged to blockchain: %s", prediction.ID, txHash)
-	}()
-
-	log.Printf("✓ Prediction created: Meter=%s, Price=€%.4f, Confidence=%d%%",
-		data.MeterID, predictedPrice, confidence)
+	// Never block the Paho callback: a full queue drops the reading
+	for i := range accepted {
+		if !Submit(accepted[i], acceptedSources[i]) {
+			log.Printf("Ingestion queue full, dropped reading from %s", accepted[i].MeterID)
+		}
+	}
 }
 
-// handleMeterData processes incoming messages from smart meters via MQTT.
-func handleMeterData(client pahomqtt.Client, msg pahomqtt.Message) {
-	log.Printf("Received message from topic %s", msg.Topic())
+// SubmitReadings feeds decoded readings into ingestion and returns how many
+// were queued; the rest were dropped because the queue is full.
+func SubmitReadings(readings []MeterData, source Source) int {
+	sources := readingSources(source, readings)
+	queued := 0
+	for i := range readings {
+		if Submit(readings[i], sources[i]) {
+			queued++
+		}
+	}
+	return queued
+}
 
-	// Parse meter data
-	var data MeterData
-	if err := json.Unmarshal(msg.Payload(), &data); err != nil {
-		log.Printf("Failed to parse meter data: %v", err)
-		return
+// readingSources gives every reading of a payload its own source. A single
+// JSON reading keeps the raw payload; readings from batches, CBOR and SenML
+// are re-encoded as JSON, so a dead letter holds just the rejected reading.
+func readingSources(source Source, readings []MeterData) []Source {
+	sources := make([]Source, len(readings))
+	for i := range readings {
+		sources[i] = source
+		if len(readings) == 1 && (source.Format == "" || source.Format == FormatJSON) {
+			continue
+		}
+		sources[i].Format = FormatJSON
+		sources[i].Payload, _ = json.Marshal(readings[i])
 	}
+	return sources
+}
 
-	ProcessMeterData(data)
+// checkTopicMeter rejects an MQTT reading whose meter ID differs from the
+// meter in its topic (energy/meters/{meterId}[/format])
+func checkTopicMeter(source Source, meterID string) *rejection {
+	if source.Channel != models.ChannelMQTT {
+		return nil
+	}
+	topicMeter, _ := parseMeterTopic(source.Topic)
+	if topicMeter == meterID {
+		return nil
+	}
+	return &rejection{
+		source:  source,
+		meterID: meterID,
+		reason:  models.ReasonMeterMismatch,
+		detail:  fmt.Sprintf("payload meter %q does not match topic meter %q", meterID, topicMeter),
+	}
 }
 
 // Disconnect cleanly closes the MQTT connection
 func (c *Client) Disconnect() {
+	StopPublisher()
 	c.client.Disconnect(1000) // Wait 1 second for pending messages
 	log.Println("MQTT client disconnected")
 }
@@ -0,0 +1,387 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"energy-prediction/internal/blockchain"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+)
+
+// logTestPrediction stores a prediction and logs it to the simulated chain
+func logTestPrediction(t *testing.T, meterID string, price float64) *models.Prediction {
+	t.Helper()
+
+	prediction := models.Prediction{
+		UserID:         1,
+		HouseID:        "house_001",
+		MeterID:        meterID,
+		Timestamp:      time.Now(),
+		Hour:           time.Now().Hour(),
+		PredictedPrice: price,
+		Confidence:     90,
+	}
+	if err := database.DB.Create(&prediction).Error; err != nil {
+		t.Fatalf("Failed to create prediction: %v", err)
+	}
+
+	txHash, err := blockchain.LogPrediction(&prediction)
+	if err != nil {
+		t.Fatalf("Failed to log prediction: %v", err)
+	}
+	prediction.BlockchainTx = txHash
+	return &prediction
+}
+
+func TestBlockchainSurvivesRestart(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	prediction := logTestPrediction(t, "household_1", 0.1234)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	head := blockchain.GetBlockNumber()
+
+	// Simulate a restart of the API gateway
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Re-init failed: %v", err)
+	}
+
+	if got := blockchain.GetBlockNumber(); got != head {
+		t.Errorf("Expected head block %d after restart, got %d", head, got)
+	}
+
+	valid, _, err := blockchain.VerifyTransaction(prediction.BlockchainTx)
+	if err != nil || !valid {
+		t.Errorf("Expected transaction to verify after restart, got valid=%v err=%v", valid, err)
+	}
+}
+
+func TestChainStoreRestoresHeadAndLinks(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	logTestPrediction(t, "household_1", 0.1100)
+	logTestPrediction(t, "household_2", 0.1200)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	head := blockchain.GetBlockNumber()
+	headBlock, err := blockchain.GetBlock(head)
+	if err != nil {
+		t.Fatalf("GetBlock failed: %v", err)
+	}
+
+	// Stop the ledger and reload the chain from the database only
+	blockchain.Stop()
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Re-init failed: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if got := blockchain.GetBlockNumber(); got != head {
+		t.Errorf("Expected height %d after restart, got %d", head, got)
+	}
+	restored, err := blockchain.GetBlock(head)
+	if err != nil || restored.Hash != headBlock.Hash {
+		t.Fatalf("Expected head hash %s after restart, got %+v (err=%v)", headBlock.Hash, restored, err)
+	}
+	report, err := blockchain.CheckIntegrity()
+	if err != nil || !report.Valid {
+		t.Fatalf("Expected the restored chain to be valid, got %+v (err=%v)", report, err)
+	}
+
+	// New blocks extend the restored head
+	logTestPrediction(t, "household_3", 0.1300)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	next, err := blockchain.GetBlock(head + 1)
+	if err != nil || next.PrevHash != headBlock.Hash {
+		t.Errorf("Expected block %d to link to %s, got %+v (err=%v)", head+1, headBlock.Hash, next, err)
+	}
+	if report, err := blockchain.CheckIntegrity(); err != nil || !report.Valid || report.HeadBlock != head+1 {
+		t.Errorf("Expected a valid chain up to block %d, got %+v (err=%v)", head+1, report, err)
+	}
+}
+
+func TestBlockProducerBatchesTransactions(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	head := blockchain.GetBlockNumber()
+
+	predictions := []*models.Prediction{
+		logTestPrediction(t, "household_1", 0.1100),
+		logTestPrediction(t, "household_2", 0.1200),
+		logTestPrediction(t, "household_3", 0.1300),
+	}
+
+	// Nothing is confirmed until the block is sealed
+	valid, log, err := blockchain.VerifyTransaction(predictions[0].BlockchainTx)
+	if err != nil || valid || log.Status != "pending" {
+		t.Fatalf("Expected pending transaction before sealing, got valid=%v log=%+v err=%v", valid, log, err)
+	}
+
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if got := blockchain.GetBlockNumber(); got != head+1 {
+		t.Fatalf("Expected a single new block %d, head is %d", head+1, got)
+	}
+	block, err := blockchain.GetBlock(head + 1)
+	if err != nil {
+		t.Fatalf("GetBlock failed: %v", err)
+	}
+	if len(block.Transactions) != len(predictions) {
+		t.Errorf("Expected %d transactions in block, got %d", len(predictions), len(block.Transactions))
+	}
+
+	for _, p := range predictions {
+		valid, log, err := blockchain.VerifyTransaction(p.BlockchainTx)
+		if err != nil || !valid {
+			t.Errorf("Expected %s to verify, got valid=%v err=%v", p.BlockchainTx, valid, err)
+			continue
+		}
+		if log.Status != "confirmed" || log.BlockNumber != block.Number {
+			t.Errorf("Expected confirmed log in block %d, got %+v", block.Number, log)
+		}
+	}
+}
+
+func TestChainIntegrityDetectsTampering(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	logTestPrediction(t, "household_1", 0.1100)
+	tampered := logTestPrediction(t, "household_2", 0.1200)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	report, err := blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if !report.Valid {
+		t.Fatalf("Expected untouched chain to be valid, got issue %+v", report.FirstIssue)
+	}
+
+	// Change the stored price after it was logged
+	database.DB.Model(tampered).Update("predicted_price", 0.0500)
+
+	report, err = blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.Valid || report.FirstIssue == nil {
+		t.Fatal("Expected tampered prediction to be detected")
+	}
+	if report.FirstIssue.Kind != blockchain.IssuePredictionTampered || report.FirstIssue.PredictionID != tampered.ID {
+		t.Errorf("Unexpected issue: %+v", report.FirstIssue)
+	}
+}
+
+func TestChainIntegrityDetectsMissingBlocks(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	genesis := blockchain.GetBlockNumber()
+	for _, meterID := range []string{"household_1", "household_2"} {
+		logTestPrediction(t, meterID, 0.1100)
+		if err := blockchain.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+	if head := blockchain.GetBlockNumber(); head != genesis+2 {
+		t.Fatalf("Expected 2 blocks after genesis, head is %d", head)
+	}
+
+	// Removing a middle block leaves a gap in the numbering
+	database.DB.Where("number = ?", genesis+1).Delete(&models.ChainBlock{})
+	database.DB.Where("block_number = ?", genesis+1).Delete(&models.ChainTransaction{})
+	report, err := blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.Valid || report.FirstIssue == nil || report.FirstIssue.Kind != blockchain.IssueMissingBlock ||
+		report.FirstIssue.BlockNumber != genesis+2 {
+		t.Errorf("Expected the missing block to be reported, got %+v", report.FirstIssue)
+	}
+
+	// Without genesis the first block does not start the chain
+	database.DB.Where("number = ?", genesis).Delete(&models.ChainBlock{})
+	report, err = blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.Valid || report.FirstIssue == nil || report.FirstIssue.Kind != blockchain.IssueBrokenLink ||
+		report.FirstIssue.BlockNumber != genesis+2 {
+		t.Errorf("Expected the missing genesis to be reported, got %+v", report.FirstIssue)
+	}
+}
+
+func TestInclusionProofVerifiesOffline(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+
+	// Five transactions give an odd-sized Merkle tree
+	var predictions []*models.Prediction
+	for i := 0; i < 5; i++ {
+		predictions = append(predictions, logTestPrediction(t, "household_1", 0.1000+float64(i)/100))
+	}
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// Seal a later block so the proof carries a prev-hash chain
+	logTestPrediction(t, "household_2", 0.2000)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	for _, p := range predictions {
+		proof, err := blockchain.GetInclusionProof(p.BlockchainTx, 0)
+		if err != nil {
+			t.Fatalf("GetInclusionProof failed: %v", err)
+		}
+		if len(proof.Chain) != 1 {
+			t.Errorf("Expected 1 header in prev-hash chain, got %d", len(proof.Chain))
+		}
+		if err := blockchain.VerifyProof(proof); err != nil {
+			t.Errorf("Expected proof for %s to verify: %v", p.BlockchainTx, err)
+		}
+	}
+
+	// Any change to the proven transaction must break the proof
+	proof, _ := blockchain.GetInclusionProof(predictions[2].BlockchainTx, 0)
+	proof.Transaction.Data = strings.Replace(proof.Transaction.Data, "0.1200", "0.0100", 1)
+	if err := blockchain.VerifyProof(proof); err == nil {
+		t.Error("Expected proof with tampered data to fail verification")
+	}
+
+	proof, _ = blockchain.GetInclusionProof(predictions[2].BlockchainTx, 0)
+	proof.Siblings[0].Hash = proof.LeafHash
+	if err := blockchain.VerifyProof(proof); err == nil {
+		t.Error("Expected proof with tampered sibling to fail verification")
+	}
+}
+
+func TestPredictionSignaturesSurviveKeyRotation(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+
+	before := logTestPrediction(t, "household_1", 0.1100)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// Restart with a different key
+	t.Setenv("SIGNING_KEY", "HyAhIiMkJSYnKCkqKywtLi8wMTIzNDU2Nzg5Ojs8PT4=")
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Re-init failed: %v", err)
+	}
+	after := logTestPrediction(t, "household_2", 0.1200)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	keys, activeKeyID, err := blockchain.GetSigningKeys()
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Expected 2 signing keys, got %d (err=%v)", len(keys), err)
+	}
+
+	for _, p := range []*models.Prediction{before, after} {
+		valid, _, err := blockchain.VerifyTransaction(p.BlockchainTx)
+		if err != nil || !valid {
+			t.Errorf("Expected %s to verify after rotation, got valid=%v err=%v", p.BlockchainTx, valid, err)
+		}
+	}
+
+	var stored models.Prediction
+	database.DB.First(&stored, after.ID)
+	if stored.SignatureKeyID != activeKeyID {
+		t.Errorf("Expected new prediction to be signed with active key %s, got %s", activeKeyID, stored.SignatureKeyID)
+	}
+
+	// A field that is not part of the chain payload is still covered by the signature
+	database.DB.Model(before).Update("actual_price", 0.9999)
+	if valid, _, _ := blockchain.VerifyTransaction(before.BlockchainTx); valid {
+		t.Error("Expected tampered prediction to fail signature verification")
+	}
+}
+
+func TestLegacyUnsignedPredictionsVerify(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	prediction := logTestPrediction(t, "household_1", 0.1100)
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// Predictions logged before signing was introduced carry no signature
+	database.DB.Model(prediction).Updates(map[string]interface{}{"signature": "", "signature_key_id": ""})
+	valid, _, err := blockchain.VerifyTransaction(prediction.BlockchainTx)
+	if err != nil || !valid {
+		t.Errorf("Expected a legacy unsigned prediction to verify, got valid=%v err=%v", valid, err)
+	}
+	report, err := blockchain.CheckIntegrity()
+	if err != nil || !report.Valid {
+		t.Errorf("Expected the chain to stay valid, got %+v (%v)", report.FirstIssue, err)
+	}
+}
+
+func TestCanonicalPredictionEscapesText(t *testing.T) {
+	a := models.Prediction{HouseID: "house|1", MeterID: "m"}
+	b := models.Prediction{HouseID: "house", MeterID: "1|m"}
+	if string(blockchain.CanonicalPrediction(&a)) == string(blockchain.CanonicalPrediction(&b)) {
+		t.Errorf("Expected distinct encodings, both are %s", blockchain.CanonicalPrediction(&a))
+	}
+	if encoded := string(blockchain.CanonicalPrediction(&a)); !strings.Contains(encoded, "|house%7C1|m|") {
+		t.Errorf("Expected the house ID to be escaped, got %s", encoded)
+	}
+
+	// The region is escaped as in the chain payload's features field
+	c := models.Prediction{Features: &models.HouseholdFeatures{Region: "Trentino|Alto Adige", Members: 2}}
+	if encoded := string(blockchain.CanonicalPrediction(&c)); !strings.HasSuffix(encoded, "|Trentino%7CAlto%20Adige|2||0|0") {
+		t.Errorf("Expected the region to be escaped, got %s", encoded)
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"energy-prediction/internal/auth"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/dsmr"
+	"energy-prediction/internal/handlers"
+	"energy-prediction/internal/models"
+	"energy-prediction/internal/mqtt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testTelegram builds a DSMR 5 telegram with a valid CRC, at the given time
+// in Dutch winter time
+func testTelegram(at time.Time, importT1, importT2 float64) []byte {
+	stamp := at.In(time.FixedZone("UTC+1", 3600)).Format("060102150405") + "W"
+	body := "/ISK5\\2M550T-1012\r\n\r\n" +
+		"1-3:0.2.8(50)\r\n" +
+		"0-0:1.0.0(" + stamp + ")\r\n" +
+		"0-0:96.1.1(4530303434303037313331363130303137)\r\n" +
+		fmt.Sprintf("1-0:1.8.1(%010.3f*kWh)\r\n", importT1) +
+		fmt.Sprintf("1-0:1.8.2(%010.3f*kWh)\r\n", importT2) +
+		"1-0:2.8.1(000012.345*kWh)\r\n" +
+		"1-0:2.8.2(000000.000*kWh)\r\n" +
+		"0-0:96.14.0(0002)\r\n" +
+		"1-0:1.7.0(00.452*kW)\r\n" +
+		"1-0:2.7.0(00.000*kW)\r\n" +
+		"0-1:24.2.1(" + stamp + ")(01234.567*m3)\r\n" +
+		"!"
+	return []byte(body + fmt.Sprintf("%04X\r\n", dsmr.CRC16([]byte(body))))
+}
+
+func TestDSMRTelegramParsing(t *testing.T) {
+	if crc := dsmr.CRC16([]byte("123456789")); crc != 0xBB3D {
+		t.Errorf("Expected the CRC-16/ARC check value BB3D, got %04X", crc)
+	}
+
+	at := time.Date(2026, 1, 10, 8, 15, 0, 0, time.UTC)
+	telegram, err := dsmr.Parse(testTelegram(at, 1581.123, 1123.456))
+	if err != nil {
+		t.Fatalf("Expected the telegram to parse: %v", err)
+	}
+	if !telegram.Timestamp.Equal(at) || telegram.Version != "50" || telegram.Tariff != 2 ||
+		telegram.EquipmentID != "E0044007131610017" {
+		t.Errorf("Unexpected telegram header fields: %+v", telegram)
+	}
+	if telegram.ImportT1Kwh != 1581.123 || telegram.ImportT2Kwh != 1123.456 || telegram.ExportT1Kwh != 12.345 ||
+		telegram.PowerImportKw != 0.452 {
+		t.Errorf("Unexpected registers: %+v", telegram)
+	}
+	if telegram.Gas == nil || telegram.Gas.M3 != 1234.567 || !telegram.Gas.Timestamp.Equal(at) {
+		t.Errorf("Unexpected gas reading: %+v", telegram.Gas)
+	}
+
+	valid := testTelegram(at, 1581.123, 1123.456)
+	for name, tc := range map[string]struct {
+		telegram []byte
+		want     string
+	}{
+		"tampered":    {bytes.Replace(valid, []byte("1581.123"), []byte("1581.124"), 1), "CRC mismatch"},
+		"no CRC":      {valid[:bytes.IndexByte(valid, '!')+1], "missing CRC"},
+		"no footer":   {valid[:bytes.IndexByte(valid, '!')], "no telegram footer"},
+		"no header":   {[]byte("1-0:1.8.1(001581.123*kWh)"), "no telegram header"},
+		"wrong unit":  {withCRC("/X\r\n1-0:1.8.1(001581.123*Wh)\r\n1-0:1.8.2(0*kWh)\r\n!"), "expected a value in kWh"},
+		"no register": {withCRC("/X\r\n1-0:1.7.0(00.452*kW)\r\n!"), "no import registers"},
+	} {
+		if _, err := dsmr.Parse(tc.telegram); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+// withCRC appends the CRC to a telegram ending in "!"
+func withCRC(telegram string) []byte {
+	return []byte(telegram + fmt.Sprintf("%04X", dsmr.CRC16([]byte(telegram))))
+}
+
+func TestDSMRIngestion(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	house := createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	base := time.Now().UTC().Truncate(15 * time.Minute).Add(-time.Hour)
+
+	// The first telegram starts the register; the next one yields its interval
+	mqtt.HandleDSMRMessage("energy/dsmr/household_1", testTelegram(base, 1581.123, 1123.456))
+	mqtt.HandleDSMRMessage("energy/dsmr/household_1", testTelegram(base.Add(15*time.Minute), 1581.523, 1123.656))
+
+	var readings []models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp ASC").Find(&readings)
+	if len(readings) != 2 {
+		t.Fatalf("Expected 2 readings, got %d", len(readings))
+	}
+	if !mqtt.HasFlag(&readings[0], models.FlagBaseline) || readings[0].ConsumptionKwh != 0 ||
+		readings[0].RegisterKwh == nil || math.Abs(*readings[0].RegisterKwh-2704.579) > 1e-9 {
+		t.Errorf("Expected a baseline reading holding the register, got %+v", readings[0])
+	}
+	if math.Abs(readings[1].ConsumptionKwh-0.6) > 1e-9 || readings[1].Flags != "" || !readings[1].Timestamp.Equal(base.Add(15*time.Minute)) {
+		t.Errorf("Expected 0.6 kWh derived from the registers, got %+v", readings[1])
+	}
+	var predictions []models.Prediction
+	database.DB.Where("meter_id = ?", house.MeterID).Find(&predictions)
+	if len(predictions) != 1 {
+		t.Fatalf("Expected a prediction for the derived interval only, got %d", len(predictions))
+	}
+	// The telegram is in Dutch winter time, and so is the hour it is banded by
+	if local := base.Add(15 * time.Minute).In(time.FixedZone("UTC+1", 3600)); predictions[0].Hour != local.Hour() {
+		t.Errorf("Expected the prediction for local hour %d, got %d", local.Hour(), predictions[0].Hour)
+	}
+
+	// A telegram failing the CRC is dead-lettered
+	bad := bytes.Replace(testTelegram(base.Add(30*time.Minute), 1582, 1124), []byte("1582.000"), []byte("1592.000"), 1)
+	mqtt.HandleDSMRMessage("energy/dsmr/household_1", bad)
+	var letter models.DeadLetter
+	database.DB.Last(&letter)
+	if letter.Reason != models.ReasonInvalidPayload || letter.ContentType != mqtt.FormatDSMR ||
+		letter.MeterID != house.MeterID || !strings.Contains(letter.Detail, "CRC mismatch") {
+		t.Errorf("Expected a CRC dead letter, got %+v", letter)
+	}
+
+	// Over HTTP the telegram is sent as text/plain by the signing meter
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/ingest/dsmr", auth.MeterAuthMiddleware(), handlers.SubmitDSMR)
+	_, secret, err := auth.ProvisionMeter(database.DB, house.MeterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(nonce string, body []byte) int {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/ingest/dsmr", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set(auth.HeaderMeterID, house.MeterID)
+		req.Header.Set(auth.HeaderMeterTimestamp, timestamp)
+		req.Header.Set(auth.HeaderMeterNonce, nonce)
+		req.Header.Set(auth.HeaderMeterSignature, auth.SignMeterRequest(secret, timestamp, nonce, body))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post("n-1", testTelegram(base.Add(30*time.Minute), 1581.923, 1123.756)); code != http.StatusAccepted {
+		t.Errorf("Expected the telegram to be accepted, got %d", code)
+	}
+	if code := post("n-2", bad); code != http.StatusBadRequest {
+		t.Errorf("Expected a CRC mismatch to be refused, got %d", code)
+	}
+
+	var last models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp DESC").First(&last)
+	if math.Abs(last.ConsumptionKwh-0.5) > 1e-9 || last.Channel != models.ChannelHTTP {
+		t.Errorf("Expected 0.5 kWh from the HTTP telegram, got %+v", last)
+	}
+
+	// A telegram posted over HTTP has no topic: it is reprocessed for the
+	// meter that signed it
+	stored := models.DeadLetter{
+		Channel:     models.ChannelHTTP,
+		MeterID:     house.MeterID,
+		Payload:     string(testTelegram(base.Add(45*time.Minute), 1582.223, 1123.856)),
+		ContentType: mqtt.FormatDSMR,
+		Reason:      models.ReasonStorageError,
+	}
+	database.DB.Create(&stored)
+	if err := mqtt.ReprocessDeadLetter(&stored); err != nil {
+		t.Fatalf("Expected the HTTP DSMR dead letter to be reprocessed: %v", err)
+	}
+	var reprocessed models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp DESC").First(&reprocessed)
+	if !reprocessed.Timestamp.Equal(base.Add(45*time.Minute)) || math.Abs(reprocessed.ConsumptionKwh-0.4) > 1e-9 {
+		t.Errorf("Expected 0.4 kWh from the reprocessed telegram, got %+v", reprocessed)
+	}
+}
@@ -0,0 +1,1016 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"energy-prediction/internal/auth"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/handlers"
+	"energy-prediction/internal/models"
+	"energy-prediction/internal/mqtt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// createTestHouse stores a household owned by user 1
+func createTestHouse(t *testing.T, id, meterID string, status models.HouseholdStatus) *models.Household {
+	t.Helper()
+
+	house := models.Household{
+		ID:          id,
+		UserID:      1,
+		HouseName:   "Test House " + id,
+		Address:     "Via Roma 1",
+		City:        "Milano",
+		Region:      "Lombardia",
+		Country:     "Italy",
+		Members:     3,
+		HeatingType: models.HeatingGas,
+		AreaSqm:     90,
+		YearBuilt:   1990,
+		MeterID:     meterID,
+		Status:      status,
+	}
+	if err := database.DB.Create(&house).Error; err != nil {
+		t.Fatalf("Failed to create house: %v", err)
+	}
+	return &house
+}
+
+// asUser stands in for the JWT middleware in handler tests
+func asUser(userID uint, role models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auth.ContextUserID, userID)
+		c.Set(auth.ContextRole, role)
+		c.Next()
+	}
+}
+
+func TestReadingsStoredForEveryMeter(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	createTestHouse(t, "house_002", "household_2", models.StatusArchived)
+
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:00:00Z", Temperature: 4.5, ConsumptionKwh: 1.2}, mqtt.Source{Channel: models.ChannelMQTT})
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-12T08:00:00Z", Temperature: 6, ConsumptionKwh: 0.9}, mqtt.Source{Channel: models.ChannelHTTP})
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_2", Timestamp: "2026-01-10T08:00:00Z", ConsumptionKwh: 2.0}, mqtt.Source{Channel: models.ChannelMQTT})
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_99", Timestamp: "2026-01-10T08:00:00Z", ConsumptionKwh: 3.0}, mqtt.Source{Channel: models.ChannelMQTT})
+
+	var readings int64
+	database.DB.Model(&models.MeterReading{}).Count(&readings)
+	if readings != 4 {
+		t.Errorf("Expected all 4 readings to be stored, got %d", readings)
+	}
+
+	// Only the active house gets predictions, each linked to its reading
+	var predictions []models.Prediction
+	database.DB.Order("id ASC").Find(&predictions)
+	if len(predictions) != 2 {
+		t.Fatalf("Expected 2 predictions, got %d", len(predictions))
+	}
+	var reading models.MeterReading
+	if predictions[0].ReadingID == nil || database.DB.First(&reading, *predictions[0].ReadingID).Error != nil {
+		t.Fatalf("Expected prediction to reference its reading, got %v", predictions[0].ReadingID)
+	}
+	if reading.ConsumptionKwh != 1.2 || reading.Channel != models.ChannelMQTT || reading.ReceivedAt.IsZero() {
+		t.Errorf("Unexpected reading: %+v", reading)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/houses/:house_id/readings", asUser(1, models.RoleUser), handlers.GetHouseReadings)
+
+	get := func(url string) (int, []models.MeterReading) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+
+		var body struct {
+			Readings []models.MeterReading `json:"readings"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Readings
+	}
+
+	if code, list := get("/api/houses/house_001/readings?from=2026-01-11"); code != http.StatusOK || len(list) != 1 || list[0].Channel != models.ChannelHTTP {
+		t.Errorf("Expected the HTTP reading after Jan 11, got %d %+v", code, list)
+	}
+	if code, list := get("/api/houses/house_001/readings?to=2026-01-10"); code != http.StatusOK || len(list) != 1 {
+		t.Errorf("Expected the reading on Jan 10, got %d %+v", code, list)
+	}
+	if code, list := get("/api/houses/house_002/readings"); code != http.StatusOK || len(list) != 1 {
+		t.Errorf("Expected archived house readings to be kept, got %d %+v", code, list)
+	}
+	if code, _ := get("/api/houses/house_001/readings?from=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid time range, got %d", code)
+	}
+}
+
+func TestPipelineBatchesReadings(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+
+	t.Setenv("INGEST_WORKERS", "1")
+	t.Setenv("INGEST_BATCH_SIZE", "10")
+	t.Setenv("INGEST_FLUSH_INTERVAL", "1s")
+	pipeline := mqtt.StartPipeline()
+
+	start := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 25; i++ {
+		data := mqtt.MeterData{
+			MeterID:        "household_1",
+			Timestamp:      start.Add(time.Duration(i) * 15 * time.Minute).Format(time.RFC3339),
+			ConsumptionKwh: 0.5,
+		}
+		if !mqtt.Submit(data, mqtt.Source{Channel: models.ChannelMQTT}) {
+			t.Fatalf("Reading %d was dropped", i)
+		}
+	}
+
+	// Stop drains the queue before returning
+	pipeline.Stop()
+
+	stats := pipeline.Stats()
+	if stats.Processed != 25 || stats.Batches != 3 {
+		t.Errorf("Expected 25 readings in 3 batches, got %d in %d", stats.Processed, stats.Batches)
+	}
+
+	var readings, predictions, queued int64
+	database.DB.Model(&models.MeterReading{}).Count(&readings)
+	database.DB.Model(&models.Prediction{}).Count(&predictions)
+	database.DB.Model(&models.BlockchainOutbox{}).Count(&queued)
+	if readings != 25 || predictions != 25 || queued != 25 {
+		t.Errorf("Expected 25 readings, predictions and outbox entries, got %d/%d/%d", readings, predictions, queued)
+	}
+
+	// A stopped pipeline drops new readings and counts them
+	if pipeline.Submit(mqtt.MeterData{MeterID: "household_1"}, mqtt.Source{Channel: models.ChannelHTTP}) {
+		t.Error("Expected submit after stop to be rejected")
+	}
+	if stats := pipeline.Stats(); stats.Dropped != 1 || stats.Received != 26 {
+		t.Errorf("Expected 1 dropped of 26 received, got %d of %d", stats.Dropped, stats.Received)
+	}
+}
+
+func TestPipelineDeadLettersStorageErrors(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+
+	t.Setenv("INGEST_WORKERS", "1")
+	t.Setenv("INGEST_STORE_ATTEMPTS", "2")
+	t.Setenv("INGEST_STORE_BACKOFF", "1ms")
+	pipeline := mqtt.StartPipeline()
+
+	// Meters cannot be looked up while the table is unavailable
+	database.DB.Exec("ALTER TABLE households RENAME TO households_offline")
+	start := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		data := mqtt.MeterData{
+			MeterID:        "household_1",
+			Timestamp:      start.Add(time.Duration(i) * 15 * time.Minute).Format(time.RFC3339),
+			ConsumptionKwh: 0.5,
+		}
+		payload, _ := json.Marshal(data)
+		mqtt.Submit(data, mqtt.Source{Channel: models.ChannelMQTT, Topic: "energy/meters/household_1", Payload: payload})
+	}
+	pipeline.Stop()
+	database.DB.Exec("ALTER TABLE households_offline RENAME TO households")
+
+	var letters []models.DeadLetter
+	database.DB.Order("id ASC").Find(&letters)
+	if len(letters) != 3 {
+		t.Fatalf("Expected every reading to be dead-lettered, got %d letters", len(letters))
+	}
+	for _, letter := range letters {
+		if letter.Reason != models.ReasonStorageError || letter.MeterID != "household_1" || letter.Payload == "" {
+			t.Errorf("Expected a storage error with the payload, got %+v", letter)
+		}
+	}
+
+	// Once the database is back, reprocessing ingests the readings
+	for i := range letters {
+		if err := mqtt.ReprocessDeadLetter(&letters[i]); err != nil {
+			t.Errorf("Reprocess failed: %v", err)
+		}
+	}
+	var readings, predictions int64
+	database.DB.Model(&models.MeterReading{}).Count(&readings)
+	database.DB.Model(&models.Prediction{}).Count(&predictions)
+	if readings != 3 || predictions != 3 {
+		t.Errorf("Expected 3 readings and predictions after reprocessing, got %d/%d", readings, predictions)
+	}
+}
+
+func TestDeadLettersReprocessAndPurge(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	unknown := mqtt.MeterData{MeterID: "household_7", Timestamp: "2026-01-10T08:00:00Z", ConsumptionKwh: 1.1}
+	payload, _ := json.Marshal(unknown)
+	mqtt.ProcessMeterData(unknown, mqtt.Source{Channel: models.ChannelMQTT, Topic: "energy/meters/household_7", Payload: payload})
+	mqtt.ProcessMeterData(mqtt.MeterData{ConsumptionKwh: 0.3}, mqtt.Source{Channel: models.ChannelHTTP, Payload: []byte(`{"consumptionKwh":0.3}`)})
+
+	var letters []models.DeadLetter
+	database.DB.Order("id ASC").Find(&letters)
+	if len(letters) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %d", len(letters))
+	}
+	if letters[0].Reason != models.ReasonUnknownMeter || letters[0].Topic != "energy/meters/household_7" ||
+		letters[0].Payload != string(payload) || letters[0].ReadingID == nil {
+		t.Errorf("Unexpected dead letter for unknown meter: %+v", letters[0])
+	}
+	if letters[1].Reason != models.ReasonMissingMeterID {
+		t.Errorf("Expected missing meter ID, got %s", letters[1].Reason)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/dead-letters/reprocess", handlers.AdminReprocessDeadLetters)
+	router.DELETE("/admin/dead-letters", handlers.AdminPurgeDeadLetters)
+
+	reprocess := func() (reprocessed int, failed int) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/dead-letters/reprocess", strings.NewReader(`{"meterId":"household_7"}`))
+		router.ServeHTTP(w, req)
+
+		var body struct {
+			Reprocessed int               `json:"reprocessed"`
+			Failed      []json.RawMessage `json:"failed"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Reprocessed, len(body.Failed)
+	}
+
+	// Still unknown: the letter stays and counts the attempt
+	if ok, failed := reprocess(); ok != 0 || failed != 1 {
+		t.Errorf("Expected reprocessing to fail, got %d ok, %d failed", ok, failed)
+	}
+
+	// After the meter is assigned, the stored reading gets its prediction
+	createTestHouse(t, "house_007", "household_7", models.StatusActive)
+	if ok, failed := reprocess(); ok != 1 || failed != 0 {
+		t.Errorf("Expected reprocessing to succeed, got %d ok, %d failed", ok, failed)
+	}
+
+	var prediction models.Prediction
+	if err := database.DB.Where("meter_id = ?", "household_7").First(&prediction).Error; err != nil {
+		t.Fatalf("Expected a prediction for household_7: %v", err)
+	}
+	var reading models.MeterReading
+	database.DB.First(&reading, *letters[0].ReadingID)
+	if prediction.ReadingID == nil || *prediction.ReadingID != reading.ID || reading.HouseID != "house_007" {
+		t.Errorf("Expected the stored reading to be reused, got prediction reading %v, house %q", prediction.ReadingID, reading.HouseID)
+	}
+
+	purge := func(query string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/admin/dead-letters"+query, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := purge(""); code != http.StatusBadRequest {
+		t.Errorf("Expected purge without filter to be refused, got %d", code)
+	}
+	if code := purge("?reason=missing_meter_id"); code != http.StatusOK {
+		t.Errorf("Expected purge to succeed, got %d", code)
+	}
+
+	var remaining int64
+	database.DB.Model(&models.DeadLetter{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected no dead letters left, got %d", remaining)
+	}
+}
+
+func TestReprocessPredictsReadingsOnce(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:00:00Z", ConsumptionKwh: 1.1},
+		mqtt.Source{Channel: models.ChannelHTTP})
+	var predicted models.MeterReading
+	database.DB.Where("meter_id = ?", "household_1").First(&predicted)
+
+	// The first register reading of a meter is only a baseline
+	register := 1250.0
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_2", Timestamp: "2026-01-10T08:00:00Z", RegisterKwh: &register},
+		mqtt.Source{Channel: models.ChannelHTTP})
+	createTestHouse(t, "house_002", "household_2", models.StatusActive)
+	var baseline models.MeterReading
+	database.DB.Where("meter_id = ?", "household_2").First(&baseline)
+	if !mqtt.HasFlag(&baseline, models.FlagBaseline) {
+		t.Fatalf("Expected a baseline reading, got flags %q", baseline.Flags)
+	}
+
+	// The baseline was dead-lettered for its unknown meter; add a letter for
+	// the reading that already has its prediction
+	var letters []models.DeadLetter
+	database.DB.Find(&letters)
+	if len(letters) != 1 || letters[0].ReadingID == nil || *letters[0].ReadingID != baseline.ID {
+		t.Fatalf("Expected a dead letter for the baseline reading, got %+v", letters)
+	}
+	predictedID := predicted.ID
+	letters = append(letters, models.DeadLetter{Channel: models.ChannelHTTP, MeterID: predicted.MeterID, Reason: models.ReasonInactiveHouse, ReadingID: &predictedID})
+	database.DB.Create(&letters[1])
+
+	for i := range letters {
+		if err := mqtt.ReprocessDeadLetter(&letters[i]); err != nil {
+			t.Errorf("Reprocess of reading %d failed: %v", *letters[i].ReadingID, err)
+		}
+	}
+
+	var predictions, remaining int64
+	database.DB.Model(&models.Prediction{}).Count(&predictions)
+	database.DB.Model(&models.DeadLetter{}).Count(&remaining)
+	if predictions != 1 || remaining != 0 {
+		t.Errorf("Expected the single prediction to be kept and the letters resolved, got %d predictions, %d letters", predictions, remaining)
+	}
+}
+
+func TestDuplicateReadingsAreSkipped(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	source := mqtt.Source{Channel: models.ChannelMQTT}
+	before := mqtt.DuplicateCount()
+
+	reading := mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:00:00Z", ConsumptionKwh: 1.2}
+	mqtt.ProcessMeterData(reading, source)
+	mqtt.ProcessMeterData(reading, source) // QoS 1 redelivery
+
+	// The same instant in another zone is the same reading
+	reading.Timestamp = "2026-01-10T09:00:00+01:00"
+	mqtt.ProcessMeterData(reading, source)
+
+	// With a message ID, deduplication uses it instead of the timestamp
+	tagged := mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:15:00Z", MessageID: "m-1"}
+	mqtt.ProcessMeterData(tagged, source)
+	tagged.Timestamp = "2026-01-10T08:16:00Z"
+	mqtt.ProcessMeterData(tagged, source)
+	tagged.MessageID = "m-2"
+	mqtt.ProcessMeterData(tagged, source)
+
+	var readings, predictions int64
+	database.DB.Model(&models.MeterReading{}).Count(&readings)
+	database.DB.Model(&models.Prediction{}).Count(&predictions)
+	if readings != 3 || predictions != 3 {
+		t.Errorf("Expected 3 readings and predictions, got %d and %d", readings, predictions)
+	}
+	if got := mqtt.DuplicateCount() - before; got != 3 {
+		t.Errorf("Expected 3 duplicates to be counted, got %d", got)
+	}
+}
+
+func TestStreamFlagsLateReadingsAndGaps(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	createTestHouse(t, "house_002", "household_2", models.StatusActive)
+	source := mqtt.Source{Channel: models.ChannelMQTT}
+	send := func(meterID, timestamp string) {
+		mqtt.ProcessMeterData(mqtt.MeterData{MeterID: meterID, Timestamp: timestamp, ConsumptionKwh: 0.5}, source)
+	}
+	at := func(t time.Time) string { return t.Format(time.RFC3339) }
+
+	base := time.Now().UTC().Truncate(time.Hour).Add(-6 * time.Hour)
+	send("household_1", at(base))
+	send("household_1", at(base.Add(15*time.Minute)))
+	send("household_1", at(base.Add(75*time.Minute))) // skips 3 readings
+	send("household_1", at(base.Add(45*time.Minute))) // late, fills part of the gap
+	send("household_1", at(base.Add(-30*time.Hour)))  // outside the late window
+	send("household_1", at(time.Now().Add(time.Hour)))
+	send("household_1", "yesterday")
+	send("household_2", "")
+
+	var reasons []string
+	database.DB.Model(&models.DeadLetter{}).Order("id ASC").Pluck("reason", &reasons)
+	want := []string{models.ReasonTooLate, models.ReasonFutureTimestamp, models.ReasonInvalidTimestamp}
+	if strings.Join(reasons, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected dead letters %v, got %v", want, reasons)
+	}
+
+	var estimated models.MeterReading
+	database.DB.Where("meter_id = ?", "household_2").First(&estimated)
+	if estimated.Flags != models.FlagEstimatedTime || time.Since(estimated.Timestamp) > time.Minute {
+		t.Errorf("Expected a reading without timestamp to use the receive time, got %+v", estimated)
+	}
+
+	// The late reading split the gap into two single missing readings
+	var gaps []models.ReadingGap
+	database.DB.Where("meter_id = ?", "household_1").Order("gap_start ASC").Find(&gaps)
+	if len(gaps) != 2 || gaps[0].MissingReadings != 1 || gaps[1].MissingReadings != 1 ||
+		!gaps[0].End.Equal(base.Add(45*time.Minute)) {
+		t.Fatalf("Expected the gap to be split around the late reading, got %+v", gaps)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/houses/:house_id/data-quality", asUser(1, models.RoleUser), handlers.GetHouseDataQuality)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/houses/house_001/data-quality?from="+at(base.Add(-time.Hour)), nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var quality struct {
+		Readings        int64            `json:"readings"`
+		Flagged         map[string]int64 `json:"flagged"`
+		MissingReadings int              `json:"missingReadings"`
+		Completeness    float64          `json:"completeness"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &quality)
+	if quality.Readings != 4 || quality.Flagged[models.FlagLate] != 1 || quality.MissingReadings != 2 {
+		t.Errorf("Unexpected data quality: %+v", quality)
+	}
+	if quality.Completeness < 66 || quality.Completeness > 67 {
+		t.Errorf("Expected 4 of 6 expected readings, got %.1f%%", quality.Completeness)
+	}
+}
+
+func TestMeterLiveness(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	createTestHouse(t, "house_002", "household_2", models.StatusActive)
+	source := mqtt.Source{Channel: models.ChannelMQTT}
+
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:00:00Z"}, source)
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_2", Timestamp: "2026-01-10T08:00:00Z"}, source)
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_99", Timestamp: "2026-01-10T08:00:00Z"}, source)
+
+	state := func(meterID string) models.MeterState {
+		var status models.MeterStatus
+		database.DB.Where("meter_id = ?", meterID).Limit(1).Find(&status)
+		return status.State
+	}
+	if state("household_1") != models.MeterOnline || state("household_99") != "" {
+		t.Fatalf("Expected only household meters to be tracked as online")
+	}
+
+	// Silence moves meters to stale, then offline (defaults: 30m, 2h)
+	now := time.Now()
+	if changed, err := mqtt.CheckLiveness(now.Add(45 * time.Minute)); err != nil || changed != 2 {
+		t.Fatalf("Expected 2 meters to turn stale, got %d (%v)", changed, err)
+	}
+	if state("household_1") != models.MeterStale {
+		t.Errorf("Expected stale, got %s", state("household_1"))
+	}
+	mqtt.CheckLiveness(now.Add(3 * time.Hour))
+	if state("household_1") != models.MeterOffline {
+		t.Errorf("Expected offline, got %s", state("household_1"))
+	}
+
+	// A new reading brings the meter back; its Last Will takes it offline at once
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:15:00Z"}, source)
+	if state("household_1") != models.MeterOnline {
+		t.Errorf("Expected the meter back online, got %s", state("household_1"))
+	}
+	mqtt.HandleMeterStatus("energy/status/household_1", []byte("offline"), time.Now())
+	if state("household_1") != models.MeterOffline {
+		t.Errorf("Expected the Last Will to take the meter offline, got %s", state("household_1"))
+	}
+	mqtt.HandleMeterStatus("energy/status/household_2", []byte("online"), time.Now())
+	if state("household_2") != models.MeterOnline {
+		t.Errorf("Expected the online status to revive the meter, got %s", state("household_2"))
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/houses/:house_id", asUser(1, models.RoleUser), handlers.GetHouse)
+	router.GET("/admin/dashboard", asUser(1, models.RoleAdmin), handlers.AdminDashboard)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/houses/house_001", nil)
+	router.ServeHTTP(w, req)
+	var house models.HouseholdResponse
+	json.Unmarshal(w.Body.Bytes(), &house)
+	if house.MeterState != models.MeterOffline || house.MeterLastSeenAt == nil {
+		t.Errorf("Expected the house to show its offline meter, got %s %v", house.MeterState, house.MeterLastSeenAt)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/admin/dashboard", nil)
+	router.ServeHTTP(w, req)
+	var dashboard models.AdminDashboardResponse
+	json.Unmarshal(w.Body.Bytes(), &dashboard)
+	if dashboard.ServiceStatus["meters"] != "degraded" || dashboard.MeterStates[models.MeterOffline] != 1 ||
+		len(dashboard.OfflineMeters) != 1 || dashboard.OfflineMeters[0].MeterID != "household_1" {
+		t.Errorf("Expected the offline meter on the dashboard, got %v %v %+v",
+			dashboard.ServiceStatus, dashboard.MeterStates, dashboard.OfflineMeters)
+	}
+}
+
+func TestMeterCredentials(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/houses", asUser(1, models.RoleUser), handlers.CreateHouse)
+	router.POST("/admin/meters/:meter_id/rotate", asUser(1, models.RoleAdmin), handlers.AdminRotateMeterSecret)
+	router.POST("/admin/meters/:meter_id/revoke", asUser(1, models.RoleAdmin), handlers.AdminRevokeMeterSecret)
+	router.POST("/api/simulate", auth.MeterAuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"meterId": auth.GetMeterID(c)})
+	})
+
+	// Creating a house provisions its meter secret, shown once
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/houses", strings.NewReader(
+		`{"houseName":"Casa","address":"Via Roma 1","city":"Milano","country":"Italy","members":2,"areaSqm":80,"yearBuilt":2000}`))
+	router.ServeHTTP(w, req)
+	var house models.HouseholdResponse
+	json.Unmarshal(w.Body.Bytes(), &house)
+	if w.Code != http.StatusCreated || house.MeterID == "" || len(house.MeterSecret) != 64 {
+		t.Fatalf("Expected a house with a meter secret, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body := []byte(`{"meterId":"` + house.MeterID + `","consumptionKwh":0.4}`)
+	send := func(secret, nonce string, at time.Time) int {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/simulate", bytes.NewReader(body))
+		req.Header.Set(auth.HeaderMeterID, house.MeterID)
+		req.Header.Set(auth.HeaderMeterTimestamp, timestamp)
+		req.Header.Set(auth.HeaderMeterNonce, nonce)
+		req.Header.Set(auth.HeaderMeterSignature, auth.SignMeterRequest(secret, timestamp, nonce, body))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	now := time.Now()
+	if code := send(house.MeterSecret, "n-1", now); code != http.StatusOK {
+		t.Errorf("Expected a signed request to pass, got %d", code)
+	}
+	if code := send(house.MeterSecret, "n-1", now); code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed nonce to be rejected, got %d", code)
+	}
+	if code := send(house.MeterSecret, "n-2", now.Add(-time.Hour)); code != http.StatusUnauthorized {
+		t.Errorf("Expected a stale timestamp to be rejected, got %d", code)
+	}
+	if code := send("wrong-secret", "n-3", now); code != http.StatusUnauthorized {
+		t.Errorf("Expected a bad signature to be rejected, got %d", code)
+	}
+
+	// Oversized bodies are refused before the signature is checked
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/simulate", bytes.NewReader(make([]byte, 1<<20+1)))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected an oversized body to be refused with 413, got %d", w.Code)
+	}
+
+	// Nonces are swept once they can no longer pass the timestamp check
+	if swept, err := auth.SweepNonces(now.Add(9 * time.Minute)); err != nil || swept != 0 {
+		t.Errorf("Expected recent nonces to be kept, swept %d (%v)", swept, err)
+	}
+	if swept, err := auth.SweepNonces(now.Add(11 * time.Minute)); err != nil || swept != 1 {
+		t.Errorf("Expected the expired nonce to be swept, swept %d (%v)", swept, err)
+	}
+
+	// Rotation replaces the secret; revocation disables it
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/meters/"+house.MeterID+"/rotate", nil)
+	router.ServeHTTP(w, req)
+	var rotated struct {
+		Secret string `json:"secret"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+	if w.Code != http.StatusOK || rotated.Secret == "" || rotated.Secret == house.MeterSecret {
+		t.Fatalf("Expected a new secret, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := send(house.MeterSecret, "n-4", now); code != http.StatusUnauthorized {
+		t.Errorf("Expected the old secret to be rejected, got %d", code)
+	}
+	if code := send(rotated.Secret, "n-5", now); code != http.StatusOK {
+		t.Errorf("Expected the rotated secret to pass, got %d", code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/meters/"+house.MeterID+"/revoke", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected revoke to succeed, got %d", w.Code)
+	}
+	if code := send(rotated.Secret, "n-6", now); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked secret to be rejected, got %d", code)
+	}
+
+	// Seeded meters without a secret are provisioned at startup; revoked
+	// meters keep their revoked secret
+	createTestHouse(t, "house_090", "household_90", models.StatusActive)
+	if n, err := auth.ProvisionMissingMeters(database.DB); err != nil || n != 1 {
+		t.Fatalf("Expected 1 meter to be provisioned, got %d (%v)", n, err)
+	}
+	var credentials []models.MeterCredential
+	database.DB.Order("meter_id ASC").Find(&credentials)
+	if len(credentials) != 2 || credentials[0].Status != models.CredentialRevoked ||
+		credentials[1].MeterID != "household_90" || credentials[1].Status != models.CredentialActive {
+		t.Errorf("Unexpected credentials after provisioning: %+v", credentials)
+	}
+	if n, _ := auth.ProvisionMissingMeters(database.DB); n != 0 {
+		t.Errorf("Expected provisioning to be idempotent, got %d", n)
+	}
+
+	// Over MQTT a meter can only publish on its own topic
+	mqtt.HandleMeterMessage("energy/meters/household_99", body)
+	var letter models.DeadLetter
+	database.DB.Last(&letter)
+	if letter.Reason != models.ReasonMeterMismatch {
+		t.Errorf("Expected a meter mismatch dead letter, got %q", letter.Reason)
+	}
+	var readings int64
+	database.DB.Model(&models.MeterReading{}).Count(&readings)
+	if readings != 0 {
+		t.Errorf("Expected no reading to be stored, got %d", readings)
+	}
+}
+
+func TestMeterPayloadFormats(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	house := createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	base := time.Now().UTC().Truncate(15 * time.Minute).Add(-6 * time.Hour)
+	at := func(slot int) string { return base.Add(time.Duration(slot) * 15 * time.Minute).Format(time.RFC3339) }
+	cbor := func(v interface{}) []byte {
+		var payload []byte
+		if err := codec.NewEncoderBytes(&payload, &codec.CborHandle{}).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		return payload
+	}
+	countReadings := func() int64 {
+		var n int64
+		database.DB.Model(&models.MeterReading{}).Where("meter_id = ?", house.MeterID).Count(&n)
+		return n
+	}
+
+	// A JSON array, one reading of which claims another meter
+	mqtt.HandleMeterMessage("energy/meters/household_1", []byte(`[
+		{"meterId":"household_1","timestamp":"`+at(0)+`","consumptionKwh":0.5},
+		{"meterId":"household_1","timestamp":"`+at(1)+`","consumptionKwh":0.6},
+		{"meterId":"household_2","timestamp":"`+at(1)+`","consumptionKwh":0.7}]`))
+	if n := countReadings(); n != 2 {
+		t.Errorf("Expected 2 readings from the JSON array, got %d", n)
+	}
+	var letter models.DeadLetter
+	database.DB.Last(&letter)
+	if letter.Reason != models.ReasonMeterMismatch || !strings.Contains(letter.Payload, `"household_2"`) ||
+		strings.Contains(letter.Payload, `"household_1"`) {
+		t.Errorf("Expected a dead letter holding only the mismatched reading, got %+v", letter)
+	}
+
+	// CBOR, selected by the topic suffix: a single reading and an array
+	mqtt.HandleMeterMessage("energy/meters/household_1/cbor",
+		cbor(mqtt.MeterData{MeterID: "household_1", Timestamp: at(2), ConsumptionKwh: 0.8, Temperature: 4}))
+	mqtt.HandleMeterMessage("energy/meters/household_1/cbor", cbor([]mqtt.MeterData{
+		{MeterID: "household_1", Timestamp: at(3), ConsumptionKwh: 0.9},
+		{MeterID: "household_1", Timestamp: at(4), ConsumptionKwh: 1.0},
+	}))
+	if n := countReadings(); n != 5 {
+		t.Errorf("Expected 5 readings after the CBOR messages, got %d", n)
+	}
+
+	// A compact batch: base time plus per-row deltas
+	mqtt.HandleMeterMessage("energy/meters/household_1/json", []byte(`{"m":"household_1","t":`+
+		strconv.FormatInt(base.Add(75*time.Minute).Unix(), 10)+`,"r":[[0,1.1,3.5],[900,1.2],[900,1.3]]}`))
+	var last models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp DESC").First(&last)
+	if n := countReadings(); n != 8 || !last.Timestamp.Equal(base.Add(105*time.Minute)) || last.ConsumptionKwh != 1.3 {
+		t.Errorf("Expected the compact batch to expand to 3 readings, got %d, last %v %.1f kWh", n, last.Timestamp, last.ConsumptionKwh)
+	}
+
+	// An undecodable CBOR message is dead-lettered base64 encoded and can be reprocessed
+	mqtt.HandleMeterMessage("energy/meters/household_1/cbor", []byte{0x01})
+	letter = models.DeadLetter{}
+	database.DB.Last(&letter)
+	if letter.Reason != models.ReasonInvalidPayload || letter.ContentType != mqtt.FormatCBOR || letter.Payload != "AQ==" {
+		t.Errorf("Expected an invalid CBOR dead letter, got %+v", letter)
+	}
+	letter.Payload = base64.StdEncoding.EncodeToString(cbor(mqtt.MeterData{MeterID: "household_1", Timestamp: at(8), ConsumptionKwh: 1.4}))
+	if err := mqtt.ReprocessDeadLetter(&letter); err != nil || countReadings() != 9 {
+		t.Errorf("Expected the repaired CBOR dead letter to be ingested: %v", err)
+	}
+
+	if _, err := mqtt.DecodeReadings([]byte(`{"m":"household_1","t":1736496000,"r":[[-5,1]]}`), mqtt.FormatJSON); err == nil {
+		t.Error("Expected a negative delta to be rejected")
+	}
+
+	// Over HTTP the format follows the content type
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/simulate", auth.MeterAuthMiddleware(), handlers.SubmitMeterData)
+	_, secret, err := auth.ProvisionMeter(database.DB, house.MeterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(contentType, nonce string, body []byte) int {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/simulate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(auth.HeaderMeterID, house.MeterID)
+		req.Header.Set(auth.HeaderMeterTimestamp, timestamp)
+		req.Header.Set(auth.HeaderMeterNonce, nonce)
+		req.Header.Set(auth.HeaderMeterSignature, auth.SignMeterRequest(secret, timestamp, nonce, body))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	body := cbor([]mqtt.MeterData{
+		{MeterID: "household_1", Timestamp: at(9), ConsumptionKwh: 1.5},
+		{MeterID: "household_1", Timestamp: at(10), ConsumptionKwh: 1.6},
+	})
+	if code := post("application/cbor", "n-1", body); code != http.StatusAccepted || countReadings() != 11 {
+		t.Errorf("Expected the CBOR array to be accepted, got %d", code)
+	}
+	if code := post("text/plain", "n-2", []byte("0.5")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected an unsupported content type to be refused, got %d", code)
+	}
+	other := []byte(`[{"meterId":"household_2","timestamp":"` + at(11) + `","consumptionKwh":0.5}]`)
+	if code := post("application/json", "n-3", other); code != http.StatusForbidden {
+		t.Errorf("Expected readings of another meter to be refused, got %d", code)
+	}
+}
+
+func TestSenMLIngestion(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	house := createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	base := time.Now().UTC().Truncate(15 * time.Minute).Add(-2 * time.Hour)
+	bt := strconv.FormatInt(base.Unix(), 10)
+
+	// Energy in Wh and J is converted to kWh, temperature attaches to the same
+	// time and energy records with other names are ignored
+	readings, err := mqtt.DecodeSenML([]byte(`[
+		{"bn":"urn:dev:mac:0024befffe804ff1:","bt":`+bt+`,"n":"energy","u":"Wh","v":450},
+		{"n":"temperature","u":"Cel","v":4.5},
+		{"n":"export","u":"Wh","v":120},
+		{"n":"energy","u":"J","v":1800000,"t":900},
+		{"n":"export","u":"kWh","v":0.1,"t":900}]`), house.MeterID, time.Now())
+	if err != nil {
+		t.Fatalf("Expected the pack to decode: %v", err)
+	}
+	if len(readings) != 2 || readings[0].ConsumptionKwh != 0.45 || readings[0].Temperature != 4.5 ||
+		math.Abs(readings[1].ConsumptionKwh-0.5) > 1e-9 || readings[1].Timestamp != base.Add(15*time.Minute).Format(time.RFC3339) {
+		t.Errorf("Unexpected readings: %+v", readings)
+	}
+
+	// Times below 2^28 are relative to now
+	now := time.Date(2026, 1, 10, 8, 0, 0, 0, time.UTC)
+	readings, err = mqtt.DecodeSenML([]byte(`[{"bu":"kWh","v":0.2,"t":-900}]`), house.MeterID, now)
+	if err != nil || readings[0].Timestamp != "2026-01-10T07:45:00Z" {
+		t.Errorf("Expected a relative time, got %+v (%v)", readings, err)
+	}
+
+	for pack, want := range map[string]string{
+		`[{"n":"power","u":"W","v":350}]`:                                                  `unsupported unit "W"`,
+		`[{"n":"energy","v":0.3}]`:                                                         "missing unit",
+		`[{"n":"temperature","u":"Cel","s":4.5}]`:                                          "sums (s) are only read for energy",
+		`[{"bt":1736496000,"u":"Cel","v":4.5}]`:                                            "has no energy record",
+		`[{"bt":1736496000,"n":"export","u":"kWh","v":0.3}]`:                               `has no energy record named "energy"`,
+		`[{"bt":1736496000,"n":"energy","u":"kWh","v":0.3},{"n":"energy","u":"Wh","v":9}]`: "ambiguous",
+		`[{"bn":"dev:ch1/","bt":1736496000,"n":"energy","u":"kWh","v":0.3},{"bn":"dev:ch2/","n":"energy","u":"kWh","v":0.2}]`: "ambiguous",
+		`[{"bt":1736496000,"n":"energy","u":"kWh","s":10},{"u":"kWh","s":12}]`:                                                "ambiguous",
+		`{"n":"energy","u":"kWh","v":0.3}`: "JSON array",
+	} {
+		if _, err := mqtt.DecodeSenML([]byte(pack), house.MeterID, now); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %s to fail with %q, got %v", pack, want, err)
+		}
+	}
+
+	// Over MQTT the meter comes from the topic; bad packs are dead-lettered
+	mqtt.HandleSenMLMessage("energy/senml/household_1", []byte(`[{"bt":`+bt+`,"n":"energy","u":"kWh","v":0.7}]`))
+	mqtt.HandleSenMLMessage("energy/senml/household_1", []byte(`[{"n":"voltage","u":"V","v":230}]`))
+	var reading models.MeterReading
+	if err := database.DB.Where("meter_id = ?", house.MeterID).First(&reading).Error; err != nil ||
+		reading.ConsumptionKwh != 0.7 || !reading.Timestamp.Equal(base) {
+		t.Errorf("Expected the SenML reading to be stored, got %+v (%v)", reading, err)
+	}
+	var letter models.DeadLetter
+	database.DB.Last(&letter)
+	if letter.Reason != models.ReasonInvalidPayload || letter.ContentType != mqtt.FormatSenML ||
+		!strings.Contains(letter.Detail, `unsupported unit "V"`) {
+		t.Errorf("Expected an invalid SenML dead letter, got %+v", letter)
+	}
+	mqtt.HandleSenMLMessage("energy/senml/household_1", []byte(`[
+		{"bt":`+bt+`,"n":"energy","u":"kWh","v":0.4,"t":3600},{"n":"energy","u":"kWh","v":0.2,"t":3600}]`))
+	var ambiguous models.DeadLetter
+	database.DB.Last(&ambiguous)
+	if ambiguous.Reason != models.ReasonInvalidPayload || !strings.Contains(ambiguous.Detail, "ambiguous") {
+		t.Errorf("Expected an ambiguous SenML pack to be dead-lettered, got %+v", ambiguous)
+	}
+
+	// The energy record name is configurable
+	t.Setenv("SENML_ENERGY_NAME", "import")
+	readings, err = mqtt.DecodeSenML([]byte(`[{"bn":"urn:dev:mac:0024befffe804ff1:","n":"energy","u":"kWh","v":0.9},
+		{"n":"import","u":"kWh","v":0.3}]`), house.MeterID, now)
+	if err != nil || len(readings) != 1 || readings[0].ConsumptionKwh != 0.3 {
+		t.Errorf("Expected the import record to be read, got %+v (%v)", readings, err)
+	}
+	t.Setenv("SENML_ENERGY_NAME", "")
+
+	// Over HTTP the meter is the signing meter
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/ingest/senml", auth.MeterAuthMiddleware(), handlers.SubmitSenML)
+	_, secret, err := auth.ProvisionMeter(database.DB, house.MeterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(contentType, nonce string, body []byte) int {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/ingest/senml", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(auth.HeaderMeterID, house.MeterID)
+		req.Header.Set(auth.HeaderMeterTimestamp, timestamp)
+		req.Header.Set(auth.HeaderMeterNonce, nonce)
+		req.Header.Set(auth.HeaderMeterSignature, auth.SignMeterRequest(secret, timestamp, nonce, body))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	pack := []byte(`[{"bt":` + bt + `,"bu":"Wh","n":"energy","v":500,"t":900},{"n":"energy","v":550,"t":1800}]`)
+	if code := post(mqtt.FormatSenML, "n-1", pack); code != http.StatusAccepted {
+		t.Errorf("Expected the SenML pack to be accepted, got %d", code)
+	}
+	var count int64
+	database.DB.Model(&models.MeterReading{}).Where("meter_id = ?", house.MeterID).Count(&count)
+	if count != 3 {
+		t.Errorf("Expected 3 readings, got %d", count)
+	}
+	if code := post(mqtt.FormatSenML, "n-2", []byte(`[{"u":"lx","v":3}]`)); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown unit to be refused, got %d", code)
+	}
+	if code := post("application/cbor", "n-3", pack); code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected SenML CBOR to be refused, got %d", code)
+	}
+
+	// A pack posted over HTTP has no topic: it is reprocessed for the meter
+	// that signed it
+	stored := models.DeadLetter{
+		Channel:     models.ChannelHTTP,
+		MeterID:     house.MeterID,
+		Payload:     `[{"bt":` + bt + `,"n":"energy","u":"kWh","v":0.8,"t":2700}]`,
+		ContentType: mqtt.FormatSenML,
+		Reason:      models.ReasonStorageError,
+	}
+	database.DB.Create(&stored)
+	if err := mqtt.ReprocessDeadLetter(&stored); err != nil {
+		t.Fatalf("Expected the HTTP SenML dead letter to be reprocessed: %v", err)
+	}
+	var reprocessed models.MeterReading
+	if err := database.DB.Where("meter_id = ? AND timestamp = ?", house.MeterID, base.Add(45*time.Minute)).
+		First(&reprocessed).Error; err != nil || reprocessed.ConsumptionKwh != 0.8 {
+		t.Errorf("Expected the reprocessed SenML reading to be stored, got %+v (%v)", reprocessed, err)
+	}
+}
+
+func TestCumulativeRegisterReadings(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	house := createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	base := time.Now().UTC().Truncate(15 * time.Minute).Add(-3 * time.Hour)
+
+	// Register values 15 minutes apart; 50 kW allows at most 12.5 kWh per interval
+	steps := []struct {
+		register    float64
+		consumption float64
+		flag        string
+	}{
+		{999999.5, 0, models.FlagBaseline},
+		{0.3, 0.8, models.FlagRollover},
+		{1.0, 0.7, ""},
+		{0.2, 0, models.FlagRegisterReset},
+		{0.5, 0.3, ""},
+		{100, 0, models.FlagImplausible},
+		{80, 0, models.FlagNegativeDelta},
+		{80.4, 0.4, ""},
+	}
+	for i, step := range steps {
+		register := step.register
+		data := mqtt.MeterData{
+			MeterID:     house.MeterID,
+			Timestamp:   base.Add(time.Duration(i) * 15 * time.Minute).Format(time.RFC3339),
+			RegisterKwh: &register,
+		}
+		mqtt.ProcessMeterData(data, mqtt.Source{Channel: models.ChannelHTTP})
+	}
+
+	var readings []models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp ASC").Find(&readings)
+	if len(readings) != len(steps) {
+		t.Fatalf("Expected %d readings, got %d", len(steps), len(readings))
+	}
+	predicted := 0
+	for i, step := range steps {
+		reading := readings[i]
+		if math.Abs(reading.ConsumptionKwh-step.consumption) > 1e-6 || reading.Flags != step.flag ||
+			reading.RegisterKwh == nil || *reading.RegisterKwh != step.register {
+			t.Errorf("Step %d: expected %.1f kWh flagged %q, got %.4f kWh flagged %q", i, step.consumption, step.flag,
+				reading.ConsumptionKwh, reading.Flags)
+		}
+		if step.flag == "" || step.flag == models.FlagRollover {
+			predicted++
+		}
+	}
+
+	// Anomalies are stored, but never reach the model
+	var predictions []models.Prediction
+	database.DB.Where("meter_id = ?", house.MeterID).Find(&predictions)
+	if len(predictions) != predicted {
+		t.Errorf("Expected %d predictions, got %d", predicted, len(predictions))
+	}
+	for _, p := range predictions {
+		if p.ConsumptionKwh <= 0 || p.ConsumptionKwh > 1 {
+			t.Errorf("Expected predictions from derived intervals only, got %.4f kWh", p.ConsumptionKwh)
+		}
+	}
+
+	// SenML energy sums are cumulative registers too
+	next := base.Add(time.Duration(len(steps)) * 15 * time.Minute)
+	pack := []byte(`[{"bt":` + strconv.FormatInt(next.Unix(), 10) + `,"n":"energy","u":"Wh","s":80900}]`)
+	senml, err := mqtt.DecodeSenML(pack, house.MeterID, time.Now())
+	if err != nil || len(senml) != 1 || senml[0].RegisterKwh == nil || *senml[0].RegisterKwh != 80.9 {
+		t.Fatalf("Expected a register reading from the SenML sum, got %+v (%v)", senml, err)
+	}
+	mqtt.ProcessMeterData(senml[0], mqtt.Source{Channel: models.ChannelMQTT, Topic: "energy/senml/household_1"})
+	var last models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp DESC").First(&last)
+	if math.Abs(last.ConsumptionKwh-0.5) > 1e-6 || last.Flags != "" {
+		t.Errorf("Expected 0.5 kWh derived from the SenML sum, got %+v", last)
+	}
+}
+
+func TestLateRegisterReadingsCountedOnce(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	house := createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	base := time.Now().UTC().Truncate(15 * time.Minute).Add(-2 * time.Hour)
+
+	// t0, t2, then t1 arrives late; t3 follows in order
+	send := func(step int, register float64) {
+		data := mqtt.MeterData{
+			MeterID:     house.MeterID,
+			Timestamp:   base.Add(time.Duration(step) * 15 * time.Minute).Format(time.RFC3339),
+			RegisterKwh: &register,
+		}
+		mqtt.ProcessMeterData(data, mqtt.Source{Channel: models.ChannelHTTP})
+	}
+	send(0, 100)
+	send(2, 101.5)
+	send(1, 100.6)
+
+	var total float64
+	database.DB.Model(&models.MeterReading{}).Where("meter_id = ?", house.MeterID).
+		Select("COALESCE(SUM(consumption_kwh), 0)").Scan(&total)
+	if math.Abs(total-1.5) > 1e-6 {
+		t.Errorf("Expected the readings to add up to register(t2) - register(t0) = 1.5 kWh, got %.4f", total)
+	}
+
+	var late models.MeterReading
+	database.DB.Where("meter_id = ? AND timestamp = ?", house.MeterID, base.Add(15*time.Minute)).First(&late)
+	if late.ConsumptionKwh != 0 || !mqtt.HasFlag(&late, models.FlagLate) || !mqtt.HasFlag(&late, models.FlagLateRegister) {
+		t.Errorf("Expected the late register reading to be flagged with no consumption, got %+v", late)
+	}
+
+	// The next reading derives from t2, not from the late t1
+	send(3, 102)
+	var last models.MeterReading
+	database.DB.Where("meter_id = ?", house.MeterID).Order("timestamp DESC").First(&last)
+	if math.Abs(last.ConsumptionKwh-0.5) > 1e-6 || last.Flags != "" {
+		t.Errorf("Expected 0.5 kWh derived from t2, got %+v", last)
+	}
+
+	var predictions int64
+	database.DB.Model(&models.Prediction{}).Where("meter_id = ?", house.MeterID).Count(&predictions)
+	if predictions != 2 {
+		t.Errorf("Expected predictions for t2 and t3 only, got %d", predictions)
+	}
+}
@@ -0,0 +1,286 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"energy-prediction/internal/blockchain"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// fakeEthNode is a minimal JSON-RPC node that mines every transaction instantly.
+// While rejectSends is set, eth_sendTransaction returns an RPC error.
+func fakeEthNode(t *testing.T, rejectSends *atomic.Bool) *httptest.Server {
+	var mu sync.Mutex
+	inputs := make(map[string]string)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int               `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid JSON-RPC request: %v", err)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		var result interface{}
+		if req.Method == "eth_sendTransaction" && rejectSends != nil && rejectSends.Load() {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"jsonrpc": "2.0", "id": req.ID,
+				"error": map[string]interface{}{"code": -32000, "message": "node is syncing"},
+			})
+			return
+		}
+		switch req.Method {
+		case "eth_chainId":
+			result = "0x7a69"
+		case "eth_accounts":
+			result = []string{"0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"}
+		case "eth_blockNumber":
+			result = "0x10"
+		case "eth_sendTransaction":
+			var tx map[string]string
+			json.Unmarshal(req.Params[0], &tx)
+			hash := fmt.Sprintf("0x%064x", len(inputs)+1)
+			inputs[hash] = tx["data"]
+			result = hash
+		case "eth_getTransactionByHash", "eth_getTransactionReceipt":
+			var hash string
+			json.Unmarshal(req.Params[0], &hash)
+			input, ok := inputs[hash]
+			if !ok {
+				break // null result
+			}
+			if req.Method == "eth_getTransactionByHash" {
+				result = map[string]string{"hash": hash, "input": input, "blockNumber": "0x10"}
+			} else {
+				result = map[string]string{"transactionHash": hash, "blockNumber": "0x10", "gasUsed": "0x5a3c", "status": "0x1"}
+			}
+		default:
+			t.Errorf("Unexpected JSON-RPC method %s", req.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+func TestEthereumLedgerUsesReceipts(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	node := fakeEthNode(t, nil)
+	defer node.Close()
+
+	t.Setenv("BLOCKCHAIN_BACKEND", blockchain.BackendEthereum)
+	t.Setenv("BLOCKCHAIN_CONTRACT_ADDRESS", "0x5FbDB2315678afecb367f032d93F642f64180aa3")
+	t.Setenv("ETH_RPC_URL", node.URL)
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+
+	prediction := logTestPrediction(t, "household_1", 0.1234)
+
+	valid, log, err := blockchain.VerifyTransaction(prediction.BlockchainTx)
+	if err != nil || !valid {
+		t.Fatalf("Expected transaction to verify, got valid=%v err=%v", valid, err)
+	}
+	if log.GasUsed != 0x5a3c || log.BlockNumber != 0x10 {
+		t.Errorf("Expected receipt gas/block to be recorded, got gas=%d block=%d", log.GasUsed, log.BlockNumber)
+	}
+	if log.ContractAddress != "0x5FbDB2315678afecb367f032d93F642f64180aa3" {
+		t.Errorf("Expected configured contract address, got %s", log.ContractAddress)
+	}
+
+	tx, err := blockchain.GetTransaction(prediction.BlockchainTx)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if tx.PredictionID != prediction.ID || !strings.HasPrefix(tx.Data, "PREDICTION|") {
+		t.Errorf("Unexpected on-chain transaction: %+v", tx)
+	}
+
+	var stored models.Prediction
+	database.DB.First(&stored, prediction.ID)
+	if !stored.BlockchainConfirmed {
+		t.Error("Expected prediction to be marked as confirmed")
+	}
+
+	if _, err := blockchain.GetInclusionProof(prediction.BlockchainTx, 0); err != blockchain.ErrNotSupported {
+		t.Errorf("Expected inclusion proofs to be unsupported, got %v", err)
+	}
+}
+
+func TestOutboxRetriesFailedLogging(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	var rejectSends atomic.Bool
+	rejectSends.Store(true)
+	node := fakeEthNode(t, &rejectSends)
+	defer node.Close()
+
+	t.Setenv("BLOCKCHAIN_BACKEND", blockchain.BackendEthereum)
+	t.Setenv("ETH_RPC_URL", node.URL)
+	t.Setenv("BLOCKCHAIN_RETRY_INTERVAL", "1h")
+	t.Setenv("BLOCKCHAIN_RETRY_BASE_DELAY", "1ms")
+	t.Setenv("BLOCKCHAIN_RETRY_MAX_ATTEMPTS", "2")
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+
+	prediction := models.Prediction{
+		UserID:         1,
+		HouseID:        "house_001",
+		MeterID:        "household_1",
+		Timestamp:      time.Now(),
+		PredictedPrice: 0.2,
+		Confidence:     80,
+	}
+	database.DB.Create(&prediction)
+	if err := blockchain.Enqueue(database.DB, prediction.ID); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	logsOf := func() []models.BlockchainLog {
+		var logs []models.BlockchainLog
+		database.DB.Where("prediction_id = ?", prediction.ID).Order("id ASC").Find(&logs)
+		return logs
+	}
+
+	// The node rejects the transaction; the log shows the retry
+	if _, err := blockchain.ProcessOutbox(); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+	if logs := logsOf(); len(logs) != 1 || logs[0].Status != "pending" || !strings.Contains(logs[0].Error, "node is syncing") {
+		t.Fatalf("Expected a pending log with the error while retrying, got %+v", logs)
+	}
+
+	// The second attempt fails as well, so the entry and its log are failed
+	time.Sleep(5 * time.Millisecond)
+	if _, err := blockchain.ProcessOutbox(); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+	entries, total, err := blockchain.ListOutbox("failed", 10)
+	if err != nil || total != 1 {
+		t.Fatalf("Expected 1 failed outbox entry, got %d (err=%v)", total, err)
+	}
+	if entries[0].Attempts != 2 || !strings.Contains(entries[0].LastError, "node is syncing") {
+		t.Errorf("Expected attempts and error to be recorded, got %+v", entries[0])
+	}
+	if logs := logsOf(); len(logs) != 1 || logs[0].Status != "failed" || logs[0].Error == "" {
+		t.Errorf("Expected a failed log with its error, got %+v", logs)
+	}
+
+	// Once the node recovers, a re-drive logs the prediction
+	rejectSends.Store(false)
+	if n, err := blockchain.Redrive(nil); err != nil || n != 1 {
+		t.Fatalf("Expected 1 entry to be re-driven, got %d (err=%v)", n, err)
+	}
+	if _, err := blockchain.ProcessOutbox(); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+
+	var stored models.Prediction
+	database.DB.First(&stored, prediction.ID)
+	if stored.BlockchainTx == "" || !stored.BlockchainConfirmed {
+		t.Errorf("Expected prediction to be logged and confirmed, got tx=%q confirmed=%v", stored.BlockchainTx, stored.BlockchainConfirmed)
+	}
+	if logs := logsOf(); len(logs) != 1 || logs[0].TransactionHash != stored.BlockchainTx || logs[0].Status != "confirmed" || logs[0].Error != "" {
+		t.Errorf("Expected the log row to carry the sent transaction, got %+v", logs)
+	}
+
+	// Logging again reuses the transaction instead of sending a second one
+	if err := blockchain.Enqueue(database.DB, prediction.ID); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if _, err := blockchain.ProcessOutbox(); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+	if logs := logsOf(); len(logs) != 1 {
+		t.Errorf("Expected no second transaction, got %+v", logs)
+	}
+	if _, total, _ := blockchain.ListOutbox("", 10); total != 0 {
+		t.Errorf("Expected outbox to be empty, got %d entries", total)
+	}
+}
+
+func TestOutboxDoesNotResendRecordedTransactions(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	node := fakeEthNode(t, nil)
+	defer node.Close()
+
+	t.Setenv("BLOCKCHAIN_BACKEND", blockchain.BackendEthereum)
+	t.Setenv("ETH_RPC_URL", node.URL)
+	t.Setenv("BLOCKCHAIN_RETRY_INTERVAL", "1h")
+	t.Setenv("BLOCKCHAIN_RETRY_BASE_DELAY", "1ms")
+
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+
+	// The first update of a log row fails, as if the database went away
+	// right after the transaction was sent
+	var failLogUpdate atomic.Bool
+	failLogUpdate.Store(true)
+	database.DB.Callback().Update().Before("gorm:update").Register("test:fail_log_update", func(db *gorm.DB) {
+		if db.Statement.Schema != nil && db.Statement.Schema.Table == "blockchain_log" && failLogUpdate.CompareAndSwap(true, false) {
+			db.AddError(errors.New("database is locked"))
+		}
+	})
+
+	prediction := models.Prediction{
+		UserID:         1,
+		HouseID:        "house_001",
+		MeterID:        "household_1",
+		Timestamp:      time.Now(),
+		PredictedPrice: 0.2,
+		Confidence:     80,
+	}
+	database.DB.Create(&prediction)
+	if err := blockchain.Enqueue(database.DB, prediction.ID); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if _, err := blockchain.ProcessOutbox(); err != nil {
+			t.Fatalf("ProcessOutbox failed: %v", err)
+		}
+	}
+	if failLogUpdate.Load() {
+		t.Fatal("Expected the log row update to have failed")
+	}
+
+	var stored models.Prediction
+	database.DB.First(&stored, prediction.ID)
+	var logs []models.BlockchainLog
+	database.DB.Where("prediction_id = ?", prediction.ID).Find(&logs)
+	if len(logs) != 1 || logs[0].TransactionHash != fmt.Sprintf("0x%064x", 1) || logs[0].TransactionHash != stored.BlockchainTx {
+		t.Errorf("Expected the sent transaction to be recorded once and not resent, got %+v", logs)
+	}
+	if _, total, _ := blockchain.ListOutbox("", 10); total != 0 {
+		t.Errorf("Expected outbox to be empty, got %d entries", total)
+	}
+}
@@ -0,0 +1,579 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"energy-prediction/internal/blockchain"
+	"energy-prediction/internal/database"
+	"energy-prediction/internal/handlers"
+	"energy-prediction/internal/ml"
+	"energy-prediction/internal/models"
+	"energy-prediction/internal/mqtt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flatPredictor predicts the same price for every input
+type flatPredictor struct{}
+
+func (flatPredictor) Name() string    { return "flat" }
+func (flatPredictor) Version() string { return "v2" }
+func (flatPredictor) Predict(ml.Input) ml.Result {
+	return ml.Result{Price: 0.2, Confidence: 80}
+}
+
+// createPriceHistory stores ten days of hourly predictions from January 1,
+// 2026 for three houses that differ in every attribute, with the rules
+// model's price as the actual price
+func createPriceHistory(t *testing.T) []models.Prediction {
+	t.Helper()
+
+	houses := []*models.Household{
+		createTestHouse(t, "house_001", "household_1", models.StatusActive),
+		createTestHouse(t, "house_002", "household_2", models.StatusActive),
+		createTestHouse(t, "house_003", "household_3", models.StatusActive),
+	}
+	database.DB.Model(houses[1]).Updates(map[string]interface{}{"region": "Sicilia", "household_members": 5, "heating_type": models.HeatingHeatPump, "area_sqm": 180, "year_built": 2020})
+	database.DB.Model(houses[2]).Updates(map[string]interface{}{"region": "Lazio", "household_members": 1, "heating_type": models.HeatingElectric, "area_sqm": 45, "year_built": 1965})
+	database.DB.Find(&houses[1], "id = ?", "house_002")
+	database.DB.Find(&houses[2], "id = ?", "house_003")
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var predictions []models.Prediction
+	for _, house := range houses {
+		for i := 0; i < 240; i++ {
+			at := start.Add(time.Duration(i) * time.Hour)
+			temperature := -2 + float64(i%30)
+			consumption := 0.5 + float64(i%7)*0.6
+			price := ml.RulesV1{}.Predict(ml.Input{Household: house, Hour: at.Hour(), Temperature: temperature, Consumption: consumption, Time: at}).Price
+			predictions = append(predictions, models.Prediction{
+				UserID: 1, HouseID: house.ID, MeterID: house.MeterID, Timestamp: at, Hour: at.Hour(),
+				Temperature: temperature, ConsumptionKwh: consumption, PredictedPrice: price, ActualPrice: price, Confidence: 90,
+			})
+		}
+	}
+	if err := database.DB.CreateInBatches(predictions, 200).Error; err != nil {
+		t.Fatalf("Failed to create predictions: %v", err)
+	}
+	return predictions
+}
+
+func TestPredictorRegistry(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	if id := ml.ModelID(ml.Active()); id != ml.DefaultModel {
+		t.Fatalf("Expected %s to be active by default, got %s", ml.DefaultModel, id)
+	}
+	if err := ml.SetActive("flat-v9"); err == nil {
+		t.Error("Expected an unknown model to be rejected")
+	}
+
+	ml.Register(flatPredictor{})
+	if err := ml.SetActive("flat-v2"); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+	defer ml.SetActive(ml.DefaultModel)
+
+	var active int
+	for _, info := range ml.Models() {
+		if info.Active {
+			active++
+			if info.ID != "flat-v2" {
+				t.Errorf("Expected flat-v2 to be active, got %+v", info)
+			}
+		}
+	}
+	if active != 1 {
+		t.Errorf("Expected exactly one active model, got %d", active)
+	}
+
+	// New predictions record the model that made them
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T08:00:00Z", Temperature: 4.5, ConsumptionKwh: 1.2}, mqtt.Source{Channel: models.ChannelMQTT})
+
+	var prediction models.Prediction
+	if err := database.DB.First(&prediction).Error; err != nil {
+		t.Fatalf("Expected a prediction: %v", err)
+	}
+	if prediction.ModelName != "flat" || prediction.ModelVersion != "v2" || prediction.PredictedPrice != 0.2 {
+		t.Errorf("Expected a flat-v2 prediction, got %s-%s at %.4f", prediction.ModelName, prediction.ModelVersion, prediction.PredictedPrice)
+	}
+	if forecast := ml.Get24HourForecast(nil, 10); forecast[0].ModelName != "flat" {
+		t.Errorf("Expected forecast from the active model, got %+v", forecast[0])
+	}
+
+	// The model is logged on chain and covered by the integrity check
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	txHash, err := blockchain.LogPrediction(&prediction)
+	if err != nil {
+		t.Fatalf("Failed to log prediction: %v", err)
+	}
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	tx, err := blockchain.GetTransaction(txHash)
+	if err != nil || !strings.Contains(tx.Data, "|flat|v2|") {
+		t.Fatalf("Expected payload to carry the model, got %+v (err=%v)", tx, err)
+	}
+
+	database.DB.Model(&prediction).Update("model_version", "v1")
+	report, err := blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.Valid || report.FirstIssue.Kind != blockchain.IssuePredictionTampered {
+		t.Errorf("Expected a changed model to be detected, got %+v", report.FirstIssue)
+	}
+}
+
+func TestRidgeModelTraining(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	predictions := createPriceHistory(t)
+
+	samples, err := ml.LoadSamples(time.Time{}, time.Time{})
+	if err != nil || len(samples) != len(predictions) {
+		t.Fatalf("Expected %d samples, got %d (err=%v)", len(predictions), len(samples), err)
+	}
+	if samples[0].Household == nil || !samples[len(samples)-1].Time.After(samples[0].Time) {
+		t.Fatalf("Expected samples with households, oldest first, got %+v", samples[0])
+	}
+
+	if _, err := ml.TrainRidge(samples[:10], 1); err == nil {
+		t.Error("Expected training on too few samples to fail")
+	}
+
+	split := len(samples) * 4 / 5
+	model, err := ml.TrainRidge(samples[:split], 1)
+	if err != nil {
+		t.Fatalf("TrainRidge failed: %v", err)
+	}
+	if metrics := ml.Evaluate(model, samples[split:]); metrics.Samples != len(samples)-split || metrics.MAPE > 5 {
+		t.Errorf("Expected a holdout MAPE below 5%%, got %+v", metrics)
+	}
+
+	// The artifact round-trips and is registered at startup
+	path := filepath.Join(t.TempDir(), "ridge.json")
+	if err := model.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	t.Setenv("ML_MODEL_FILE", path)
+	t.Setenv("ML_MODEL", ml.ModelID(model))
+	ml.Configure()
+	defer ml.SetActive(ml.DefaultModel)
+
+	active := ml.Active()
+	if ml.ModelID(active) != ml.ModelID(model) {
+		t.Fatalf("Expected %s to be active, got %s", ml.ModelID(model), ml.ModelID(active))
+	}
+	in := samples[len(samples)-1].Input
+	if got, want := active.Predict(in), model.Predict(in); got.Price != want.Price || got.Confidence != want.Confidence {
+		t.Errorf("Expected loaded model to predict %+v, got %+v", want, got)
+	}
+	if explanation := active.Predict(in).Explanation; explanation == nil || len(explanation.Factors) != 8 {
+		t.Errorf("Expected the ridge model to explain its price by 8 factors, got %+v", explanation)
+	} else {
+		product := explanation.BasePrice
+		for _, f := range explanation.Factors {
+			product *= f.Value
+		}
+		if math.Abs(product-explanation.Price) > 0.001 {
+			t.Errorf("Expected the factors to multiply to %.4f, got %.4f", explanation.Price, product)
+		}
+	}
+	if result := active.Predict(ml.Input{Hour: 20, Temperature: 10, Consumption: 1}); result.Price <= 0 || math.IsNaN(result.Price) {
+		t.Errorf("Expected a price without household details, got %+v", result)
+	}
+
+	// Artifacts trained on other features are rejected
+	var artifact map[string]interface{}
+	data, _ := os.ReadFile(path)
+	json.Unmarshal(data, &artifact)
+	artifact["features"] = []string{"temperature"}
+	data, _ = json.Marshal(artifact)
+	os.WriteFile(path, data, 0644)
+	if _, err := ml.LoadRidge(path); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("expected %d", len(model.Features))) {
+		t.Errorf("Expected a stale artifact to be rejected, got %v", err)
+	}
+}
+
+func TestBacktest(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	predictions := createPriceHistory(t)
+	ml.Register(flatPredictor{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/backtests", handlers.AdminRunBacktest)
+	router.GET("/admin/backtests", handlers.AdminGetBacktests)
+
+	post := func(body string) (int, []models.BacktestRun) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/backtests", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var resp struct {
+			RunID string               `json:"runId"`
+			Data  []models.BacktestRun `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	// Jan 2-4, the end date included
+	code, runs := post(`{"models": ["flat-v2", "rules-v1"], "from": "2026-01-02", "to": "2026-01-04"}`)
+	if code != http.StatusCreated || len(runs) != 2 {
+		t.Fatalf("Expected 2 backtest runs, got %d %+v", code, runs)
+	}
+	flat := runs[0]
+	if flat.ModelName != "flat" || flat.RunID == "" || flat.RunID != runs[1].RunID || flat.WindowFrom == nil {
+		t.Fatalf("Unexpected run: %+v", flat)
+	}
+
+	var want struct {
+		n                int
+		absolute, signed float64
+	}
+	for _, p := range predictions {
+		if p.Timestamp.Day() >= 2 && p.Timestamp.Day() <= 4 {
+			want.n++
+			want.absolute += math.Abs(0.2 - p.ActualPrice)
+			want.signed += 0.2 - p.ActualPrice
+		}
+	}
+	if flat.Samples != want.n || math.Abs(flat.MAE-want.absolute/float64(want.n)) > 1e-9 || math.Abs(flat.Bias-want.signed/float64(want.n)) > 1e-9 {
+		t.Errorf("Expected %d samples, MAE %.4f and bias %.4f, got %+v", want.n, want.absolute/float64(want.n), want.signed/float64(want.n), flat)
+	}
+	if rules := runs[1]; rules.MAPE > 5 || rules.RMSE >= flat.RMSE {
+		t.Errorf("Expected rules-v1 to track its own prices better than flat, got %+v", rules)
+	}
+
+	var breakdown ml.Breakdown
+	if err := json.Unmarshal(flat.Breakdown, &breakdown); err != nil {
+		t.Fatalf("Invalid breakdown: %v", err)
+	}
+	if len(breakdown.ByHour) != 24 || breakdown.ByHour[0].Group != "00" || len(breakdown.ByRegion) != 3 || len(breakdown.ByHeatingType) != 3 {
+		t.Errorf("Unexpected breakdown: %+v", breakdown)
+	}
+	for _, group := range breakdown.ByRegion {
+		if group.Samples != want.n/3 {
+			t.Errorf("Expected %d samples for %s, got %+v", want.n/3, group.Group, group)
+		}
+	}
+
+	// A trained model is only replayed on the predictions after its training
+	// cutoff, and so are the models compared with it
+	samples, _ := ml.LoadSamples(time.Time{}, time.Time{})
+	trainedUntil := time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC)
+	ridge, err := ml.TrainRidge(samples[:sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(trainedUntil) })], 1)
+	if err != nil {
+		t.Fatalf("TrainRidge failed: %v", err)
+	}
+	if !ridge.TrainingCutoff().After(samples[0].Time) || ridge.TrainingCutoff().After(trainedUntil) {
+		t.Errorf("Expected the training cutoff just after the newest training sample, got %s", ridge.TrainingCutoff())
+	}
+	ridge.ModelVersion = "v-holdout"
+	ridge.TrainedUntil = trainedUntil
+	ml.Register(ridge)
+
+	code, runs = post(`{"models": ["ridge-v-holdout", "rules-v1"]}`)
+	if code != http.StatusCreated || len(runs) != 2 || runs[0].Cutoff == nil || !runs[0].Cutoff.Equal(trainedUntil) ||
+		runs[0].Samples != 5*24*3 || runs[1].Samples != runs[0].Samples {
+		t.Fatalf("Expected both models over the 5 days after the training cutoff, got %d %+v", code, runs)
+	}
+	code, runs = post(`{"models": ["ridge-v-holdout"], "cutoff": "2026-01-08"}`)
+	if code != http.StatusCreated || runs[0].Samples != 3*24*3 || !runs[0].Cutoff.Equal(trainedUntil.Add(48*time.Hour)) {
+		t.Errorf("Expected a later cutoff to be kept, got %d %+v", code, runs)
+	}
+	if code, _ := post(`{"models": ["ridge-v-holdout"], "to": "2026-01-04"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a window the model was trained on, got %d", code)
+	}
+	if code, _ := post(`{"cutoff": "tomorrow"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid cutoff, got %d", code)
+	}
+
+	// Without models, every registered model is backtested on the predictions
+	// none of them was trained on
+	var cutoff time.Time
+	for _, info := range ml.Models() {
+		p, _ := ml.Get(info.ID)
+		if trained, ok := p.(ml.Trained); ok && trained.TrainingCutoff().After(cutoff) {
+			cutoff = trained.TrainingCutoff()
+		}
+	}
+	unseen := 0
+	for _, p := range predictions {
+		if !p.Timestamp.Before(cutoff) {
+			unseen++
+		}
+	}
+	if code, runs := post(""); code != http.StatusCreated || len(runs) != len(ml.Models()) || runs[0].Samples != unseen {
+		t.Errorf("Expected all models over the %d unseen predictions, got %d %+v", unseen, code, runs)
+	}
+	if code, _ := post(`{"models": ["flat-v9"]}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown model, got %d", code)
+	}
+	if code, _ := post(`{"from": "2027-01-01"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty window, got %d", code)
+	}
+
+	// Stored runs can be listed per model
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/backtests?model=flat-v2", nil)
+	router.ServeHTTP(w, req)
+	var list struct {
+		Data  []models.BacktestRun `json:"data"`
+		Total int64                `json:"total"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || list.Total != 2 || list.Data[0].ModelName != "flat" || len(list.Data[0].Breakdown) == 0 {
+		t.Errorf("Expected 2 stored flat-v2 runs, got %d %+v", w.Code, list)
+	}
+}
+
+// fixedClock always tells the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestReproduciblePredictions(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	// The same input gives the same price; only the seed varies volatility
+	at := time.Date(2026, 7, 15, 20, 0, 0, 0, time.UTC)
+	in := ml.Input{Hour: 20, Temperature: 30, Consumption: 1.5, Time: at, Seed: 42}
+	rules := ml.RulesV1{}
+	if a, b := rules.Predict(in), rules.Predict(in); a.Price != b.Price || a.Confidence != b.Confidence {
+		t.Errorf("Expected identical predictions, got %+v and %+v", a, b)
+	}
+	prices := map[float64]bool{}
+	for seed := int64(1); seed <= 20; seed++ {
+		in.Seed = seed
+		prices[rules.Predict(in).Price] = true
+	}
+	if len(prices) < 2 {
+		t.Error("Expected the seed to drive market volatility")
+	}
+	if ml.GenerateActualPrice(0.15, 20, 42) != ml.GenerateActualPrice(0.15, 20, 42) {
+		t.Error("Expected the actual price to be reproducible from its seed")
+	}
+
+	// Forecasts start at the injected clock
+	ml.SetClock(fixedClock(at))
+	defer ml.SetClock(nil)
+	first, second := ml.Get24HourForecast(nil, 20), ml.Get24HourForecast(nil, 20)
+	if first[0].Timestamp != at.Format(time.RFC3339) || first[5].PredictedPrice != second[5].PredictedPrice || first[5].Seed == 0 {
+		t.Errorf("Expected a reproducible forecast from %s, got %+v", at, first[0])
+	}
+
+	// A stored prediction records its seed and can be recomputed
+	createTestHouse(t, "house_001", "household_1", models.StatusActive)
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T20:00:00Z", Temperature: 1.5, ConsumptionKwh: 3.2}, mqtt.Source{Channel: models.ChannelMQTT})
+
+	var prediction models.Prediction
+	if err := database.DB.First(&prediction).Error; err != nil {
+		t.Fatalf("Expected a prediction: %v", err)
+	}
+	if prediction.Seed == 0 || prediction.Seed != ml.SeedFor("household_1", prediction.Timestamp) {
+		t.Fatalf("Expected the seed of household_1 at %s, got %d", prediction.Timestamp, prediction.Seed)
+	}
+	if f := prediction.Features; f == nil || f.Region != "Lombardia" || f.Members != 3 || f.AreaSqm != 90 {
+		t.Fatalf("Expected the household features to be recorded, got %+v", f)
+	}
+
+	// Editing the house afterwards does not change the recomputed price
+	database.DB.Model(&models.Household{}).Where("id = ?", "house_001").Updates(map[string]interface{}{
+		"region": "Sicilia", "household_members": 6, "heating_type": models.HeatingElectric, "area_sqm": 200, "year_built": 1950})
+	result, err := ml.Reproduce(&prediction)
+	if err != nil || result.Price != prediction.PredictedPrice || result.Confidence != prediction.Confidence {
+		t.Errorf("Expected to recompute %.4f (%d%%), got %+v (err=%v)", prediction.PredictedPrice, prediction.Confidence, result, err)
+	}
+	var edited models.Household
+	database.DB.First(&edited, "id = ?", "house_001")
+	live := ml.RulesV1{}.Predict(ml.Input{Household: &edited, Hour: prediction.Hour, Temperature: prediction.Temperature,
+		Consumption: prediction.ConsumptionKwh, Time: prediction.Timestamp, Seed: prediction.Seed})
+	if live.Price == prediction.PredictedPrice {
+		t.Errorf("Expected the edited house to price differently, got %.4f", live.Price)
+	}
+	unrecorded := prediction
+	unrecorded.Features = nil
+	if _, err := ml.Reproduce(&unrecorded); err == nil {
+		t.Error("Expected a prediction without household features not to be reproducible")
+	}
+	if actual := ml.GenerateActualPrice(prediction.PredictedPrice, prediction.Hour, prediction.Seed); actual != prediction.ActualPrice {
+		t.Errorf("Expected to recompute actual price %.4f, got %.4f", prediction.ActualPrice, actual)
+	}
+
+	// The seed is logged on chain and the verify endpoint recomputes the price
+	if err := blockchain.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer blockchain.Stop()
+	txHash, err := blockchain.LogPrediction(&prediction)
+	if err != nil {
+		t.Fatalf("Failed to log prediction: %v", err)
+	}
+	if err := blockchain.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	tx, err := blockchain.GetTransaction(txHash)
+	if err != nil || !strings.HasSuffix(tx.Data, fmt.Sprintf("|%d|Lombardia;3;natural_gas;90;1990", prediction.Seed)) {
+		t.Fatalf("Expected payload to carry the seed and household features, got %+v (err=%v)", tx, err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/blockchain/verify/:tx_hash", handlers.VerifyTransaction)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/blockchain/verify/"+txHash, nil)
+	router.ServeHTTP(w, req)
+	var verified struct {
+		Recomputation struct {
+			Reproduced     bool    `json:"reproduced"`
+			PredictedPrice float64 `json:"predictedPrice"`
+		} `json:"recomputation"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &verified)
+	if w.Code != http.StatusOK || !verified.Recomputation.Reproduced {
+		t.Errorf("Expected the logged prediction to be reproduced, got %d %s", w.Code, w.Body.String())
+	}
+
+	if report, err := blockchain.CheckIntegrity(); err != nil || !report.Valid {
+		t.Fatalf("Expected the chain to be intact, got %+v (err=%v)", report, err)
+	}
+	database.DB.Model(&prediction).Update("features", `{"region":"Sicilia","members":3,"heatingType":"natural_gas","areaSqm":90,"yearBuilt":1990}`)
+	report, err := blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.Valid || report.FirstIssue.Kind != blockchain.IssuePredictionTampered {
+		t.Errorf("Expected changed household features to be detected, got %+v", report.FirstIssue)
+	}
+
+	database.DB.Model(&prediction).Updates(map[string]interface{}{"seed": prediction.Seed + 1, "features": nil})
+	report, err = blockchain.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.Valid || report.FirstIssue.Kind != blockchain.IssuePredictionTampered {
+		t.Errorf("Expected a changed seed to be detected, got %+v", report.FirstIssue)
+	}
+}
+
+func TestPredictionExplanation(t *testing.T) {
+	SetupTestDB()
+	defer TeardownTestDB()
+
+	// Lombardia, 3 members, 90 m², gas heating built 1990
+	house := createTestHouse(t, "house_001", "household_1", models.StatusActive)
+
+	at := time.Date(2026, 1, 10, 20, 0, 0, 0, time.UTC)
+	result := ml.RulesV1{}.Predict(ml.Input{Household: house, Hour: 20, Temperature: 1, Consumption: 3.5, Time: at, Seed: 7})
+	explanation := result.Explanation
+	if explanation == nil || explanation.BasePrice != 0.12 || explanation.Price != result.Price || len(explanation.Factors) != 9 {
+		t.Fatalf("Expected an explanation of 9 factors, got %+v", explanation)
+	}
+	want := map[string]float64{"region": 1.05, "members": 1, "area": 1, "efficiency": 1.05, "season": 1.15, "timeBand": 1.4, "weather": 1.25, "consumption": 1.15}
+	sum := 0.0
+	for _, f := range explanation.Factors {
+		if value, ok := want[f.Name]; ok && f.Value != value {
+			t.Errorf("Expected %s to be %.2f, got %+v", f.Name, value, f)
+		}
+		if f.Detail == "" {
+			t.Errorf("Expected %s to describe its input", f.Name)
+		}
+		sum += f.Contribution
+	}
+	if math.Abs(explanation.BasePrice+sum-result.Price) > 0.001 {
+		t.Errorf("Expected contributions to add up to %.4f, got base %.4f + %.4f", result.Price, explanation.BasePrice, sum)
+	}
+	if f := explanation.Factors[5]; f.Name != "timeBand" || f.Detail != "20:00, evening peak" || f.Contribution <= 0 {
+		t.Errorf("Expected the evening peak to raise the price, got %+v", f)
+	}
+
+	// Forecast entries carry the explanation
+	if forecast := ml.Get24HourForecast(house, 10); forecast[0].Explanation == nil || forecast[0].Explanation.Price != forecast[0].PredictedPrice {
+		t.Errorf("Expected forecast entries to be explained, got %+v", forecast[0])
+	}
+
+	// Stored predictions are explained by recomputing them
+	mqtt.ProcessMeterData(mqtt.MeterData{MeterID: "household_1", Timestamp: "2026-01-10T20:00:00Z", Temperature: 1, ConsumptionKwh: 3.5}, mqtt.Source{Channel: models.ChannelMQTT})
+	var prediction models.Prediction
+	if err := database.DB.First(&prediction).Error; err != nil {
+		t.Fatalf("Expected a prediction: %v", err)
+	}
+	legacy := models.Prediction{UserID: 1, HouseID: "house_001", MeterID: "household_1", Timestamp: at, Hour: 20, PredictedPrice: 0.15, Confidence: 90}
+	database.DB.Create(&legacy)
+
+	gin.SetMode(gin.TestMode)
+	get := func(userID uint, id uint) (int, map[string]interface{}) {
+		router := gin.New()
+		router.GET("/api/predictions/:prediction_id/explain", asUser(userID, models.RoleUser), handlers.ExplainPrediction)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/predictions/%d/explain", id), nil)
+		router.ServeHTTP(w, req)
+
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, body := get(1, prediction.ID)
+	if code != http.StatusOK || body["reproduced"] != true {
+		t.Fatalf("Expected a reproduced explanation, got %d %v", code, body)
+	}
+	if factors := body["explanation"].(map[string]interface{})["factors"].([]interface{}); len(factors) != 9 {
+		t.Errorf("Expected 9 factors, got %v", factors)
+	}
+	if code, _ := get(2, prediction.ID); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's prediction, got %d", code)
+	}
+	if code, _ := get(1, legacy.ID); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a prediction without a model, got %d", code)
+	}
+	unrecorded := models.Prediction{UserID: 1, HouseID: "house_001", MeterID: "household_1", Timestamp: at, Hour: 20,
+		PredictedPrice: 0.15, Confidence: 90, ModelName: "rules", ModelVersion: "v1", Seed: 7}
+	database.DB.Create(&unrecorded)
+	if code, body := get(1, unrecorded.ID); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a prediction without household features, got %d %v", code, body)
+	}
+
+	// The explanation is built from the recorded household features, not
+	// from the house as edited since
+	database.DB.Model(house).Updates(map[string]interface{}{"region": "Sicilia", "household_members": 6, "area_sqm": 200})
+	code, body = get(1, prediction.ID)
+	if code != http.StatusOK || body["reproduced"] != true {
+		t.Fatalf("Expected the explanation to still reproduce the price, got %d %v", code, body)
+	}
+	details := map[string]string{}
+	for _, f := range body["explanation"].(map[string]interface{})["factors"].([]interface{}) {
+		factor := f.(map[string]interface{})
+		details[factor["name"].(string)] = factor["detail"].(string)
+	}
+	if details["region"] != "Lombardia" || details["members"] != "3 members" || details["area"] != "90 m²" {
+		t.Errorf("Expected the factors to describe the recorded house, got %v", details)
+	}
+	if features := body["features"].(map[string]interface{}); features["region"] != "Lombardia" {
+		t.Errorf("Expected the recorded features in the response, got %v", features)
+	}
+}
@@ -3,6 +3,7 @@ package tests
 import (
 	"fmt"
 	"os"
+	"testing"
 	"time"
 
 	"energy-prediction/internal/database"
@@ -12,17 +13,29 @@ import (
 	"gorm.io/gorm"
 )
 
-var testDB *gorm.DB
+var (
+	testDB     *gorm.DB
+	testDBName string
+)
+
+// testSigningKey is a fixed Ed25519 seed so tests never write a key file
+const testSigningKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+
+func TestMain(m *testing.M) {
+	os.Setenv("SIGNING_KEY", testSigningKey)
+	os.Exit(m.Run())
+}
 
 func SetupTestDB() {
-	dbName := fmt.Sprintf("test_%d.db", time.Now().UnixNano())
-	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	testDBName = fmt.Sprintf("test_%d.db", time.Now().UnixNano())
+	db, err := gorm.Open(sqlite.Open(testDBName), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
 
 	// Migrate the schema
-	db.AutoMigrate(&models.User{}, &models.Household{}, &models.Prediction{}, &models.Session{})
+	db.AutoMigrate(&models.User{}, &models.Household{}, &models.MeterReading{}, &models.DeadLetter{}, &models.ReadingGap{}, &models.MeterStatus{}, &models.MeterCredential{}, &models.MeterNonce{}, &models.Prediction{}, &models.Session{},
+		&models.BlockchainLog{}, &models.ChainBlock{}, &models.ChainTransaction{}, &models.SigningKey{}, &models.BlockchainOutbox{}, &models.BacktestRun{})
 
 	testDB = db
 	database.DB = db
@@ -32,6 +45,6 @@ func TeardownTestDB() {
 	if testDB != nil {
 		sqlDB, _ := testDB.DB()
 		sqlDB.Close()
-		os.Remove(testDB.Name()) // This might not work directly with GORM's name if it's complex, better to track filename
+		os.Remove(testDBName)
 	}
 }